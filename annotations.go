@@ -0,0 +1,481 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ==========================================
+// ANOTASI EBOOK (BOOKMARK HALAMAN, HIGHLIGHT, CATATAN)
+// ebook_history hanya menyimpan satu lastPage per buku; anotasi menyimpan
+// banyak penanda per halaman. Highlight ditambatkan ke rentang teks di
+// text layer halaman (offset karakter awal-akhir + kutipan teksnya), jadi
+// tetap bisa dicocokkan ulang walau tampilan reader berubah ukuran.
+// ==========================================
+
+const (
+	annotationBookmark  = "bookmark"
+	annotationHighlight = "highlight"
+	annotationNote      = "note"
+
+	annotationMaxNote  = 5000 // karakter
+	annotationMaxQuote = 2000
+)
+
+// Warna highlight yang dikenali reader
+var annotationColors = map[string]bool{
+	"yellow": true, "green": true, "blue": true, "pink": true, "purple": true,
+}
+
+// Nama warna untuk ekspor
+var annotationColorLabels = map[string]string{
+	"yellow": "kuning", "green": "hijau", "blue": "biru", "pink": "merah muda", "purple": "ungu",
+}
+
+type AnnotationAnchor struct {
+	Start int    `json:"start"` // offset karakter di text layer halaman
+	End   int    `json:"end"`
+	Quote string `json:"quote"` // teks yang dipilih
+}
+
+type EbookAnnotation struct {
+	ID        int               `json:"id"`
+	BookID    int               `json:"bookId"`
+	Kind      string            `json:"kind"`
+	Page      int               `json:"page"`
+	Anchor    *AnnotationAnchor `json:"anchor,omitempty"`
+	Color     string            `json:"color,omitempty"`
+	Note      string            `json:"note"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+const ebookAnnotationSelect = `
+	SELECT id, bookId, kind, page, anchorStart, anchorEnd, quote, color, note, createdAt, updatedAt
+	FROM ebook_annotations`
+
+func scanEbookAnnotation(rows *sql.Rows) (EbookAnnotation, error) {
+	var a EbookAnnotation
+	var start, end sql.NullInt64
+	var quote, color, note sql.NullString
+	err := rows.Scan(&a.ID, &a.BookID, &a.Kind, &a.Page, &start, &end, &quote, &color, &note, &a.CreatedAt, &a.UpdatedAt)
+	if start.Valid && end.Valid {
+		a.Anchor = &AnnotationAnchor{Start: int(start.Int64), End: int(end.Int64), Quote: quote.String}
+	}
+	a.Color, a.Note = color.String, note.String
+	return a, err
+}
+
+func loadEbookAnnotations(userID, bookID int, page int, kind string) ([]EbookAnnotation, error) {
+	query := ebookAnnotationSelect + " WHERE userId = ? AND bookId = ?"
+	args := []interface{}{userID, bookID}
+	if page > 0 {
+		query += " AND page = ?"
+		args = append(args, page)
+	}
+	if kind != "" {
+		query += " AND kind = ?"
+		args = append(args, kind)
+	}
+	rows, err := db.Query(query+" ORDER BY page, COALESCE(anchorStart, -1), id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []EbookAnnotation{}
+	for rows.Next() {
+		a, err := scanEbookAnnotation(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// Validasi isi anotasi; dipakai saat membuat dan mengubah
+func validateAnnotation(a *EbookAnnotation) string {
+	a.Note = strings.TrimSpace(a.Note)
+	a.Color = strings.ToLower(strings.TrimSpace(a.Color))
+
+	switch a.Kind {
+	case annotationBookmark:
+		a.Anchor, a.Color = nil, ""
+	case annotationHighlight:
+		if a.Anchor == nil {
+			return "Highlight wajib punya anchor teks"
+		}
+		if a.Color == "" {
+			a.Color = "yellow"
+		}
+	case annotationNote:
+		if a.Note == "" {
+			return "Catatan tidak boleh kosong"
+		}
+	default:
+		return "kind harus bookmark, highlight atau note"
+	}
+
+	if a.Page < 1 {
+		return "Halaman tidak valid"
+	}
+	if a.Color != "" && !annotationColors[a.Color] {
+		return "Warna tidak dikenal"
+	}
+	if utf8.RuneCountInString(a.Note) > annotationMaxNote {
+		return fmt.Sprintf("Catatan maksimal %d karakter", annotationMaxNote)
+	}
+	if a.Anchor != nil {
+		a.Anchor.Quote = strings.TrimSpace(a.Anchor.Quote)
+		if a.Anchor.Start < 0 || a.Anchor.End <= a.Anchor.Start {
+			return "Rentang anchor tidak valid"
+		}
+		if utf8.RuneCountInString(a.Anchor.Quote) > annotationMaxQuote {
+			return fmt.Sprintf("Kutipan maksimal %d karakter", annotationMaxQuote)
+		}
+	}
+	return ""
+}
+
+func anchorColumns(a *AnnotationAnchor) (interface{}, interface{}, interface{}) {
+	if a == nil {
+		return nil, nil, nil
+	}
+	return a.Start, a.End, a.Quote
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// /api/ebook/annotations dan /api/ebook/annotations/
+//
+//	GET    /api/ebook/annotations?bookId=1[&page=12][&kind=highlight]
+//	POST   /api/ebook/annotations           {"bookId","kind","page","anchor":{"start","end","quote"},"color","note"}
+//	PUT    /api/ebook/annotations/{id}      {"color","note","anchor"}
+//	DELETE /api/ebook/annotations/{id}
+//	GET    /api/ebook/annotations/export?bookId=1&format=md|pdf
+func ebookAnnotationsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	user := getCurrentUser(r)
+	if user.ID == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "User belum login"})
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/ebook/annotations"), "/")
+	if rest == "export" {
+		exportEbookAnnotations(w, r, user)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			listEbookAnnotations(w, r, user)
+		case http.MethodPost:
+			createEbookAnnotation(w, r, user)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Method not allowed"})
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(rest)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Anotasi tidak ditemukan"})
+		return
+	}
+	switch r.Method {
+	case http.MethodPut, http.MethodPatch:
+		updateEbookAnnotation(w, r, user, id)
+	case http.MethodDelete:
+		res, err := db.Exec("DELETE FROM ebook_annotations WHERE id = ? AND userId = ?", id, user.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Anotasi tidak ditemukan"})
+			return
+		}
+		json.NewEncoder(w).Encode(Response{Success: true, Message: "Anotasi dihapus"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Method not allowed"})
+	}
+}
+
+func listEbookAnnotations(w http.ResponseWriter, r *http.Request, user User) {
+	q := r.URL.Query()
+	bookID, err := strconv.Atoi(q.Get("bookId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "bookId tidak valid"})
+		return
+	}
+	page, _ := strconv.Atoi(q.Get("page"))
+
+	list, err := loadEbookAnnotations(user.ID, bookID, page, q.Get("kind"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func createEbookAnnotation(w http.ResponseWriter, r *http.Request, user User) {
+	var a EbookAnnotation
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Format JSON tidak valid"})
+		return
+	}
+	a.Kind = strings.ToLower(strings.TrimSpace(a.Kind))
+	if msg := validateAnnotation(&a); msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: msg})
+		return
+	}
+
+	var ebookFile sql.NullString
+	err := db.QueryRow("SELECT ebookFile FROM books WHERE id = ?", a.BookID).Scan(&ebookFile)
+	if err != nil || ebookFile.String == "" {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Ebook tidak ditemukan"})
+		return
+	}
+
+	// Satu bookmark cukup untuk satu halaman
+	if a.Kind == annotationBookmark {
+		var existing int
+		err := db.QueryRow("SELECT id FROM ebook_annotations WHERE userId = ? AND bookId = ? AND page = ? AND kind = ?",
+			user.ID, a.BookID, a.Page, annotationBookmark).Scan(&existing)
+		if err == nil {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false, "message": "Halaman sudah di-bookmark", "id": existing,
+			})
+			return
+		}
+	}
+
+	start, end, quote := anchorColumns(a.Anchor)
+	res, err := db.Exec(`
+		INSERT INTO ebook_annotations (userId, bookId, kind, page, anchorStart, anchorEnd, quote, color, note)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.ID, a.BookID, a.Kind, a.Page, start, end, quote, nullIfEmpty(a.Color), a.Note)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	id, _ := res.LastInsertId()
+	a.ID = int(id)
+	a.CreatedAt = time.Now()
+	a.UpdatedAt = a.CreatedAt
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true, "message": "Anotasi disimpan", "data": a,
+	})
+}
+
+// Hanya warna, catatan dan anchor yang bisa diubah; pindah halaman = buat baru
+func updateEbookAnnotation(w http.ResponseWriter, r *http.Request, user User, id int) {
+	rows, err := db.Query(ebookAnnotationSelect+" WHERE id = ? AND userId = ?", id, user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	var a EbookAnnotation
+	found := rows.Next()
+	if found {
+		a, err = scanEbookAnnotation(rows)
+	}
+	rows.Close()
+	if !found || err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Anotasi tidak ditemukan"})
+		return
+	}
+
+	var input struct {
+		Color  *string           `json:"color"`
+		Note   *string           `json:"note"`
+		Anchor *AnnotationAnchor `json:"anchor"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Format JSON tidak valid"})
+		return
+	}
+	if input.Color != nil {
+		a.Color = *input.Color
+	}
+	if input.Note != nil {
+		a.Note = *input.Note
+	}
+	if input.Anchor != nil {
+		a.Anchor = input.Anchor
+	}
+	if msg := validateAnnotation(&a); msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: msg})
+		return
+	}
+
+	start, end, quote := anchorColumns(a.Anchor)
+	_, err = db.Exec(`
+		UPDATE ebook_annotations SET anchorStart = ?, anchorEnd = ?, quote = ?, color = ?, note = ?, updatedAt = NOW()
+		WHERE id = ? AND userId = ?`,
+		start, end, quote, nullIfEmpty(a.Color), a.Note, id, user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	a.UpdatedAt = time.Now()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true, "message": "Anotasi diperbarui", "data": a,
+	})
+}
+
+// Ekspor semua anotasi satu buku sebagai Markdown atau PDF
+func exportEbookAnnotations(w http.ResponseWriter, r *http.Request, user User) {
+	q := r.URL.Query()
+	bookID, err := strconv.Atoi(q.Get("bookId"))
+	if err != nil {
+		http.Error(w, "bookId tidak valid", http.StatusBadRequest)
+		return
+	}
+	format := strings.ToLower(q.Get("format"))
+	if format == "" {
+		format = "md"
+	}
+	if format != "md" && format != "pdf" {
+		http.Error(w, "format harus md atau pdf", http.StatusBadRequest)
+		return
+	}
+
+	var title string
+	var author sql.NullString
+	if err := db.QueryRow("SELECT title, author FROM books WHERE id = ?", bookID).Scan(&title, &author); err != nil {
+		http.Error(w, "Buku tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	list, err := loadEbookAnnotations(user.ID, bookID, 0, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("catatan-%s", slugify(title))
+	if filename == "catatan-" {
+		filename = fmt.Sprintf("catatan-buku-%d", bookID)
+	}
+	exported := time.Now().Format("02-01-2006 15:04")
+
+	if format == "md" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.md"`, filename))
+		w.Write([]byte(annotationsMarkdown(title, author.String, exported, list)))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, filename))
+	w.Write(annotationsPDF(title, author.String, exported, list))
+}
+
+func annotationLabel(a EbookAnnotation) string {
+	switch a.Kind {
+	case annotationBookmark:
+		return "Bookmark"
+	case annotationHighlight:
+		return "Highlight " + annotationColorLabels[a.Color]
+	}
+	return "Catatan"
+}
+
+func annotationsMarkdown(title, author, exported string, list []EbookAnnotation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Catatan: %s\n\n", title)
+	if author != "" {
+		fmt.Fprintf(&b, "Penulis: %s  \n", author)
+	}
+	fmt.Fprintf(&b, "Diekspor: %s  \nJumlah anotasi: %d\n", exported, len(list))
+
+	page := 0
+	for _, a := range list {
+		if a.Page != page {
+			page = a.Page
+			fmt.Fprintf(&b, "\n## Halaman %d\n", page)
+		}
+		fmt.Fprintf(&b, "\n**%s**\n", annotationLabel(a))
+		if a.Anchor != nil && a.Anchor.Quote != "" {
+			for _, line := range strings.Split(a.Anchor.Quote, "\n") {
+				fmt.Fprintf(&b, "> %s\n", line)
+			}
+		}
+		if a.Note != "" {
+			if a.Anchor != nil && a.Anchor.Quote != "" {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "%s\n", a.Note)
+		}
+	}
+	if len(list) == 0 {
+		b.WriteString("\n_Belum ada anotasi untuk buku ini._\n")
+	}
+	return b.String()
+}
+
+func annotationsPDF(title, author, exported string, list []EbookAnnotation) []byte {
+	doc := newTextPDF("Catatan: " + title)
+	doc.paragraph("Catatan: "+title, 18, true, 0)
+	if author != "" {
+		doc.caption("Penulis: "+author, 10, 0)
+	}
+	doc.caption(fmt.Sprintf("Diekspor: %s - %d anotasi", exported, len(list)), 10, 0)
+
+	page := 0
+	for _, a := range list {
+		if a.Page != page {
+			page = a.Page
+			doc.space(12)
+			doc.paragraph(fmt.Sprintf("Halaman %d", page), 14, true, 0)
+		}
+		doc.space(6)
+		doc.paragraph(annotationLabel(a), 10, true, 0)
+		if a.Anchor != nil && a.Anchor.Quote != "" {
+			doc.caption("“"+a.Anchor.Quote+"”", 11, 14)
+		}
+		if a.Note != "" {
+			doc.paragraph(a.Note, 11, false, 0)
+		}
+	}
+	if len(list) == 0 {
+		doc.space(12)
+		doc.caption("Belum ada anotasi untuk buku ini.", 11, 0)
+	}
+	return doc.Bytes()
+}
@@ -0,0 +1,841 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// PENYIMPANAN FILE (BLOB STORE)
+// Sampul, ebook dan foto profil disimpan lewat BlobStore. Key blob sama
+// dengan path yang tersimpan di database (mis. uploads/covers/<hash>.jpg),
+// jadi URL /uploads/... tetap sama apa pun backend-nya.
+//
+//	STORAGE_BACKEND=local  (default) file di disk, relatif ke folder kerja
+//	STORAGE_BACKEND=s3     bucket S3 / kompatibel S3 (MinIO, R2, dll):
+//	                       S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY,
+//	                       S3_SECRET_KEY, S3_PREFIX (opsional),
+//	                       S3_PATH_STYLE=false untuk virtual-hosted style
+//	STORAGE_BACKEND=memory di memori saja, hilang saat restart (demo & test)
+//
+// Library yang butuh file di disk (parser PDF/EPUB, pdfcpu) memakai
+// blobLocalPath: untuk S3 blob diunduh sekali ke cache/blobs. Ukuran cache
+// dibatasi BLOB_CACHE_MAX_MB (default 2048); file yang paling lama tidak
+// dipakai dihapus lebih dulu.
+// File lama di disk dipindah dengan perintah: ./project migrate-storage
+// ==========================================
+
+var errBlobNotFound = errors.New("blob tidak ditemukan")
+
+type BlobInfo struct {
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+type BlobStore interface {
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Get(key string) (io.ReadCloser, BlobInfo, error)
+	Stat(key string) (BlobInfo, error)
+	Delete(key string) error
+	List(prefix string, fn func(key string, info BlobInfo) error) error
+}
+
+// Backend yang menyimpan blob sebagai file biasa (tanpa perlu cache)
+type blobLocalPather interface {
+	LocalPath(key string) string
+}
+
+const (
+	blobCacheDir = "cache/blobs"
+	// Hasil Stat backend remote dipakai ulang selama ini (request Range PDF.js
+	// bisa puluhan per halaman); blob berisi hash jadi isinya tidak berubah
+	blobStatTTL = 30 * time.Second
+	// File cache yang baru dipakai tidak dihapus walau cache penuh
+	blobCacheMinAge = time.Minute
+)
+
+var blobCacheMaxBytes = envMegabytes("BLOB_CACHE_MAX_MB", 2048)
+
+var blobs BlobStore = newLocalBlobStore(".")
+
+// Pilih backend dari env; dipanggil sekali di awal main
+func initBlobStore() {
+	switch backend := strings.ToLower(os.Getenv("STORAGE_BACKEND")); backend {
+	case "", "local":
+		blobs = newLocalBlobStore(".")
+	case "s3":
+		s, err := newS3BlobStoreFromEnv()
+		if err != nil {
+			log.Fatal("Konfigurasi S3 tidak valid: ", err)
+		}
+		blobs = s
+		fmt.Println("✅ Penyimpanan file: S3 bucket", s.bucket, "di", s.endpoint.Host)
+	case "memory":
+		blobs = newMemoryBlobStore()
+		fmt.Println("⚠ Penyimpanan file di memori: semua upload hilang saat server berhenti")
+	default:
+		log.Fatalf("STORAGE_BACKEND %q tidak dikenal (pakai local, s3 atau memory)", backend)
+	}
+}
+
+// Key harus path relatif yang bersih, tanpa ".." dan bukan file tersembunyi
+func cleanBlobKey(key string) (string, bool) {
+	k := path.Clean("/" + strings.ReplaceAll(key, "\\", "/"))[1:]
+	if k == "" || k != strings.TrimPrefix(key, "/") {
+		return "", false
+	}
+	for _, part := range strings.Split(k, "/") {
+		if strings.HasPrefix(part, ".") {
+			return "", false
+		}
+	}
+	return k, true
+}
+
+// ================= Backend disk lokal =================
+
+type localBlobStore struct {
+	root string
+}
+
+func newLocalBlobStore(root string) *localBlobStore {
+	return &localBlobStore{root: root}
+}
+
+func (s *localBlobStore) LocalPath(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+func (s *localBlobStore) Put(key string, r io.Reader, size int64, contentType string) error {
+	p := s.LocalPath(key)
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".blob-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *localBlobStore) Get(key string) (io.ReadCloser, BlobInfo, error) {
+	f, err := os.Open(s.LocalPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = errBlobNotFound
+		}
+		return nil, BlobInfo{}, err
+	}
+	st, err := f.Stat()
+	if err != nil || st.IsDir() {
+		f.Close()
+		return nil, BlobInfo{}, errBlobNotFound
+	}
+	return f, localBlobInfo(key, st), nil
+}
+
+func (s *localBlobStore) Stat(key string) (BlobInfo, error) {
+	st, err := os.Stat(s.LocalPath(key))
+	if err != nil || st.IsDir() {
+		if err == nil || os.IsNotExist(err) {
+			err = errBlobNotFound
+		}
+		return BlobInfo{}, err
+	}
+	return localBlobInfo(key, st), nil
+}
+
+func (s *localBlobStore) Delete(key string) error {
+	if err := os.Remove(s.LocalPath(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *localBlobStore) List(prefix string, fn func(key string, info BlobInfo) error) error {
+	root := s.LocalPath(prefix)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != root {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		st, err := d.Info()
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		return fn(key, localBlobInfo(key, st))
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func localBlobInfo(key string, st os.FileInfo) BlobInfo {
+	return BlobInfo{Size: st.Size(), ModTime: st.ModTime(), ContentType: mime.TypeByExtension(path.Ext(key))}
+}
+
+// ================= Backend memori =================
+
+type memoryBlob struct {
+	data []byte
+	info BlobInfo
+}
+
+type memoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string]memoryBlob
+}
+
+func newMemoryBlobStore() *memoryBlobStore {
+	return &memoryBlobStore{blobs: make(map[string]memoryBlob)}
+}
+
+// bytes.Reader + Close, supaya serveBlob tetap bisa melayani Range
+type memoryBlobReader struct{ *bytes.Reader }
+
+func (memoryBlobReader) Close() error { return nil }
+
+func (s *memoryBlobStore) Put(key string, r io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = memoryBlob{data: data, info: BlobInfo{Size: int64(len(data)), ModTime: time.Now(), ContentType: contentType}}
+	return nil
+}
+
+func (s *memoryBlobStore) Get(key string) (io.ReadCloser, BlobInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.blobs[key]
+	if !ok {
+		return nil, BlobInfo{}, errBlobNotFound
+	}
+	return memoryBlobReader{bytes.NewReader(b.data)}, b.info, nil
+}
+
+func (s *memoryBlobStore) Stat(key string) (BlobInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.blobs[key]
+	if !ok {
+		return BlobInfo{}, errBlobNotFound
+	}
+	return b.info, nil
+}
+
+func (s *memoryBlobStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+func (s *memoryBlobStore) List(prefix string, fn func(key string, info BlobInfo) error) error {
+	// Salin dulu supaya fn boleh memanggil Put / Delete
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.blobs))
+	for k := range s.blobs {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		info, err := s.Stat(k)
+		if err != nil {
+			continue
+		}
+		if err := fn(k, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ================= Backend S3 (Signature V4) =================
+
+type s3BlobStore struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	prefix    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	client    *http.Client
+}
+
+func newS3BlobStoreFromEnv() (*s3BlobStore, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "https://s3.amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT %q tidak valid", endpoint)
+	}
+	s := &s3BlobStore{
+		endpoint:  u,
+		region:    os.Getenv("S3_REGION"),
+		bucket:    os.Getenv("S3_BUCKET"),
+		prefix:    strings.Trim(os.Getenv("S3_PREFIX"), "/"),
+		accessKey: os.Getenv("S3_ACCESS_KEY"),
+		secretKey: os.Getenv("S3_SECRET_KEY"),
+		pathStyle: os.Getenv("S3_PATH_STYLE") != "false",
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if s.bucket == "" || s.accessKey == "" || s.secretKey == "" {
+		return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY dan S3_SECRET_KEY wajib diisi")
+	}
+	if s.prefix != "" {
+		s.prefix += "/"
+	}
+	return s, nil
+}
+
+// Encode gaya AWS: hanya karakter unreserved yang tidak di-escape
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func (s *s3BlobStore) request(method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := *s.endpoint
+	objPath := ""
+	if key != "" {
+		objPath = "/" + s.prefix + key
+	}
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		u.Path = basePath + "/" + s.bucket + objPath
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = basePath + objPath
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawPath = s3Escape(u.Path, true)
+
+	// Query kanonik: diurutkan & di-escape dengan aturan yang sama untuk URL dan tanda tangan
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, s3Escape(k, false)+"="+s3Escape(query.Get(k), false))
+	}
+	u.RawQuery = strings.Join(parts, "&")
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, u.RawPath, u.RawQuery, s3UnsignedPayload, time.Now().UTC())
+	return req, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// Body tidak ikut di-hash supaya upload bisa dialirkan tanpa dibaca dua kali
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// AWS Signature Version 4. payloadHash = hex SHA-256 body atau s3UnsignedPayload.
+func (s *s3BlobStore) sign(req *http.Request, canonicalPath, canonicalQuery, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonical := strings.Join([]string{
+		req.Method, canonicalPath, canonicalQuery, canonicalHeaders,
+		strings.Join(signed, ";"), payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	k := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	k = hmacSHA256(k, s.region)
+	k = hmacSHA256(k, "s3")
+	k = hmacSHA256(k, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(k, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, strings.Join(signed, ";"), signature))
+}
+
+// Error S3 berisi XML <Error><Code>..</Code><Message>..</Message></Error>
+func s3Error(resp *http.Response, op, key string) error {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	xml.Unmarshal(body, &e)
+	if e.Code == "" {
+		e.Code = resp.Status
+	}
+	return fmt.Errorf("s3 %s %s: %s %s", op, key, e.Code, e.Message)
+}
+
+func (s *s3BlobStore) do(req *http.Request) (*http.Response, error) {
+	return s.client.Do(req)
+}
+
+func (s *s3BlobStore) Put(key string, r io.Reader, size int64, contentType string) error {
+	req, err := s.request(http.MethodPut, key, nil, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody // panjang 0 dengan Body non-nil dikirim chunked
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp, "put", key)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func s3BlobInfo(h http.Header) BlobInfo {
+	info := BlobInfo{ContentType: h.Get("Content-Type")}
+	info.Size, _ = strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	info.ModTime, _ = http.ParseTime(h.Get("Last-Modified"))
+	return info
+}
+
+func (s *s3BlobStore) Get(key string) (io.ReadCloser, BlobInfo, error) {
+	req, err := s.request(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, BlobInfo{}, errBlobNotFound
+		}
+		return nil, BlobInfo{}, s3Error(resp, "get", key)
+	}
+	return resp.Body, s3BlobInfo(resp.Header), nil
+}
+
+func (s *s3BlobStore) Stat(key string) (BlobInfo, error) {
+	req, err := s.request(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return s3BlobInfo(resp.Header), nil
+	case http.StatusNotFound:
+		return BlobInfo{}, errBlobNotFound
+	}
+	return BlobInfo{}, fmt.Errorf("s3 head %s: %s", key, resp.Status)
+}
+
+func (s *s3BlobStore) Delete(key string) error {
+	req, err := s.request(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return s3Error(resp, "delete", key)
+}
+
+func (s *s3BlobStore) List(prefix string, fn func(key string, info BlobInfo) error) error {
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {s.prefix + prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		req, err := s.request(http.MethodGet, "", q, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := s.do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error(resp, "list", prefix)
+			resp.Body.Close()
+			return err
+		}
+		var page struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, c := range page.Contents {
+			key := strings.TrimPrefix(c.Key, s.prefix)
+			info := BlobInfo{Size: c.Size, ModTime: c.LastModified, ContentType: mime.TypeByExtension(path.Ext(key))}
+			if err := fn(key, info); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// ================= Helper =================
+
+// Path file di disk untuk blob: langsung untuk backend lokal, selain itu
+// diunduh ke cache/blobs. Cache dianggap basi jika ukuran / waktu ubah berbeda.
+func blobLocalPath(key string) (string, error) {
+	key, ok := cleanBlobKey(key)
+	if !ok {
+		return "", errBlobNotFound
+	}
+	if lp, ok := blobs.(blobLocalPather); ok {
+		p := lp.LocalPath(key)
+		if _, err := blobs.Stat(key); err != nil {
+			return "", err
+		}
+		return p, nil
+	}
+
+	info, err := cachedBlobStat(key)
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(blobCacheDir, filepath.FromSlash(key))
+	if st, err := os.Stat(p); err == nil && st.Size() == info.Size && st.ModTime().Equal(info.ModTime) {
+		touchBlobCache(key, st.Size())
+		return p, nil
+	}
+
+	rc, info, err := blobs.Get(key)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".dl-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, rc)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	os.Chtimes(tmp.Name(), info.ModTime, info.ModTime)
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return "", err
+	}
+	touchBlobCache(key, info.Size)
+	evictBlobCache()
+	return p, nil
+}
+
+// Catatan cache/blobs untuk backend remote: hasil Stat terakhir dan kapan
+// file cache terakhir dipakai (dasar penghapusan saat cache penuh)
+type blobCacheEntry struct {
+	info   BlobInfo
+	statAt time.Time
+	size   int64 // ukuran file di cache/blobs; 0 = belum / tidak diunduh
+	usedAt time.Time
+}
+
+var (
+	blobCacheMu    sync.Mutex
+	blobCacheIndex map[string]*blobCacheEntry
+	blobCacheBytes int64
+)
+
+// Index dibangun dari isi cache/blobs saat pertama dipakai (sisa proses sebelumnya)
+func blobCacheEntryLocked(key string) *blobCacheEntry {
+	if blobCacheIndex == nil {
+		blobCacheIndex = make(map[string]*blobCacheEntry)
+		filepath.WalkDir(blobCacheDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+				return nil
+			}
+			rel, err := filepath.Rel(blobCacheDir, p)
+			st, serr := d.Info()
+			if err != nil || serr != nil {
+				return nil
+			}
+			blobCacheIndex[filepath.ToSlash(rel)] = &blobCacheEntry{size: st.Size(), usedAt: st.ModTime()}
+			blobCacheBytes += st.Size()
+			return nil
+		})
+	}
+	e := blobCacheIndex[key]
+	if e == nil {
+		e = &blobCacheEntry{}
+		blobCacheIndex[key] = e
+	}
+	return e
+}
+
+// Stat backend dengan cache singkat; blob yang tidak ada tidak di-cache
+func cachedBlobStat(key string) (BlobInfo, error) {
+	blobCacheMu.Lock()
+	e := blobCacheEntryLocked(key)
+	if !e.statAt.IsZero() && time.Since(e.statAt) < blobStatTTL {
+		info := e.info
+		blobCacheMu.Unlock()
+		return info, nil
+	}
+	blobCacheMu.Unlock()
+
+	info, err := blobs.Stat(key)
+	if err != nil {
+		return info, err
+	}
+	blobCacheMu.Lock()
+	e = blobCacheEntryLocked(key)
+	e.info, e.statAt = info, time.Now()
+	blobCacheMu.Unlock()
+	return info, nil
+}
+
+func touchBlobCache(key string, size int64) {
+	blobCacheMu.Lock()
+	defer blobCacheMu.Unlock()
+	e := blobCacheEntryLocked(key)
+	blobCacheBytes += size - e.size
+	e.size, e.usedAt = size, time.Now()
+}
+
+func forgetBlobCache(key string) {
+	blobCacheMu.Lock()
+	defer blobCacheMu.Unlock()
+	if e := blobCacheIndex[key]; e != nil {
+		blobCacheBytes -= e.size
+		delete(blobCacheIndex, key)
+	}
+}
+
+// Hapus file cache yang paling lama tidak dipakai sampai di bawah 90% batas
+func evictBlobCache() {
+	blobCacheMu.Lock()
+	defer blobCacheMu.Unlock()
+
+	var files []string
+	for key, e := range blobCacheIndex {
+		switch {
+		case e.size > 0:
+			files = append(files, key)
+		case time.Since(e.statAt) > blobStatTTL:
+			delete(blobCacheIndex, key) // hanya catatan Stat yang sudah basi
+		}
+	}
+	if blobCacheBytes <= blobCacheMaxBytes {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return blobCacheIndex[files[i]].usedAt.Before(blobCacheIndex[files[j]].usedAt) })
+
+	target := blobCacheMaxBytes / 10 * 9
+	for _, key := range files {
+		if blobCacheBytes <= target {
+			break
+		}
+		e := blobCacheIndex[key]
+		if time.Since(e.usedAt) < blobCacheMinAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(blobCacheDir, filepath.FromSlash(key))); err != nil && !os.IsNotExist(err) {
+			continue
+		}
+		blobCacheBytes -= e.size
+		delete(blobCacheIndex, key)
+	}
+}
+
+// Hapus blob beserta salinan cache-nya
+func deleteBlob(key string) error {
+	key, ok := cleanBlobKey(key)
+	if !ok {
+		return nil
+	}
+	os.Remove(filepath.Join(blobCacheDir, filepath.FromSlash(key)))
+	forgetBlobCache(key)
+	return blobs.Delete(key)
+}
+
+// Kirim blob ke client; If-Modified-Since & Range ditangani ServeContent
+// untuk backend lokal, backend lain dialirkan langsung.
+func serveBlob(w http.ResponseWriter, r *http.Request, key string) {
+	key, ok := cleanBlobKey(key)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	rc, info, err := blobs.Get(key)
+	if err != nil {
+		if err != errBlobNotFound {
+			log.Println("Gagal membaca file", key+":", err)
+		}
+		http.NotFound(w, r)
+		return
+	}
+	defer rc.Close()
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), info.ModTime, rs)
+		return
+	}
+
+	if !info.ModTime.IsZero() {
+		if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !info.ModTime.Truncate(time.Second).After(ims) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if info.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.Copy(w, rc)
+}
+
+// Simpan file lokal ke blob store jika key belum ada (file bawaan seperti sampul default)
+func ensureBlobFromFile(key, src string) {
+	if _, err := blobs.Stat(key); err == nil {
+		return
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		log.Printf("⚠ Warning: %s tidak ditemukan", src)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if err := blobs.Put(key, f, st.Size(), mime.TypeByExtension(path.Ext(key))); err != nil {
+		log.Printf("⚠ Gagal menyimpan %s: %v", key, err)
+		return
+	}
+	fmt.Println("✅ File bawaan disimpan:", key)
+}
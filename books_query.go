@@ -0,0 +1,352 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ==========================================
+// QUERY DAFTAR BUKU: PAGINATION, SORTING, PROJECTION
+// Dipakai listBooksHandler & getBookmarksHandler
+// ==========================================
+
+const (
+	bookListDefaultLimit = 20
+	bookListMaxLimit     = 100
+)
+
+// Jumlah peminjaman yang benar-benar terjadi (dipakai sebagai "popularity")
+const bookPopularityExpr = `(SELECT COUNT(*) FROM transactions t
+	WHERE t.book_id = b.id AND t.status IN ('DIPINJAM', 'DIKEMBALIKAN', 'HILANG'))`
+
+// Ekspresi SQL untuk tiap kunci sort. NULL diganti nilai default agar keyset cursor konsisten.
+var bookSortExprs = map[string]string{
+	"title":      "COALESCE(b.title, '')",
+	"author":     "COALESCE(b.author, '')",
+	"year":       "COALESCE(b.year, 0)",
+	"created_at": "UNIX_TIMESTAMP(b.created_at)",
+	"popularity": bookPopularityExpr,
+	"rating":     "b.rating_avg",
+	"reviews":    "b.rating_count",
+}
+
+// Field JSON yang boleh dipilih lewat ?fields=
+var bookListFields = map[string]bool{
+	"id": true, "title": true, "author": true, "year": true, "genre": true, "category": true,
+	"type": true, "stock": true, "fineAmount": true, "description": true, "coverFile": true,
+	"location": true, "ebookFile": true, "popularity": true, "ratingAvg": true, "ratingCount": true,
+	"coverColor": true, "coverVariants": true,
+}
+
+// Parameter list buku hasil parsing query string
+type bookListQuery struct {
+	Sort      string // kosong = urut id (perilaku lama)
+	Desc      bool
+	Limit     int
+	Page      int
+	Cursor    *bookCursor
+	Fields    []string
+	Paginated bool  // true jika client minta page/limit/cursor -> response pakai envelope
+	RankedIDs []int // urutan hasil search (sort=relevance), diisi applyBookSearch
+	Facets    []string
+}
+
+// Posisi terakhir untuk cursor pagination (keyset)
+type bookCursor struct {
+	Value interface{} `json:"v"`
+	ID    int         `json:"id"`
+}
+
+// Parse ?sort=&order=&page=&limit=&cursor=&fields=&facets=
+// sort juga menerima awalan "-" untuk descending, contoh sort=-year
+func parseBookListQuery(q url.Values) (bookListQuery, error) {
+	lq := bookListQuery{Limit: bookListDefaultLimit, Page: 1}
+
+	if s := q.Get("sort"); s != "" {
+		if strings.HasPrefix(s, "-") {
+			lq.Desc = true
+			s = strings.TrimPrefix(s, "-")
+		}
+		if _, ok := bookSortExprs[s]; !ok && s != "relevance" {
+			return lq, fmt.Errorf("sort tidak valid, pilihan: relevance, title, author, year, created_at, popularity, rating, reviews")
+		}
+		lq.Sort = s
+	}
+	switch strings.ToLower(q.Get("order")) {
+	case "desc":
+		lq.Desc = true
+	case "asc":
+		lq.Desc = false
+	case "":
+	default:
+		return lq, fmt.Errorf("order harus asc atau desc")
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return lq, fmt.Errorf("limit tidak valid")
+		}
+		if n > bookListMaxLimit {
+			n = bookListMaxLimit
+		}
+		lq.Limit = n
+		lq.Paginated = true
+	}
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return lq, fmt.Errorf("page tidak valid")
+		}
+		lq.Page = n
+		lq.Paginated = true
+	}
+	if _, ok := q["cursor"]; ok {
+		lq.Paginated = true
+		if v := q.Get("cursor"); v != "" {
+			c, err := decodeBookCursor(v)
+			if err != nil {
+				return lq, fmt.Errorf("cursor tidak valid")
+			}
+			lq.Cursor = &c
+		}
+	}
+
+	// Facet hanya bisa dikirim lewat envelope
+	facets, err := parseBookFacets(q.Get("facets"))
+	if err != nil {
+		return lq, err
+	}
+	if len(facets) > 0 {
+		lq.Facets = facets
+		lq.Paginated = true
+	}
+
+	if v := q.Get("fields"); v != "" {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "" {
+				continue
+			}
+			if !bookListFields[f] {
+				return lq, fmt.Errorf("field tidak dikenal: %s", f)
+			}
+			lq.Fields = append(lq.Fields, f)
+		}
+	}
+	return lq, nil
+}
+
+func (lq bookListQuery) wantsField(field string) bool {
+	for _, f := range lq.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeBookCursor(c bookCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeBookCursor(s string) (bookCursor, error) {
+	var c bookCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(raw, &c)
+	return c, err
+}
+
+// Hasil query list buku
+type bookListResult struct {
+	Books      []map[string]interface{}
+	Total      int
+	NextCursor string
+	HasMore    bool
+}
+
+// Jalankan query list buku. from harus memakai alias "b" untuk tabel books,
+// contoh: "books b" atau "shelf_items i JOIN shelves s ON s.id = i.shelfId JOIN books b ON i.bookId = b.id".
+func queryBookList(from string, conditions []string, args []interface{}, lq bookListQuery) (bookListResult, error) {
+	var res bookListResult
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	sortExpr := "b.id"
+	if lq.Sort == "relevance" {
+		// Posisi buku di hasil search; ID berupa int sehingga aman ditulis langsung
+		if len(lq.RankedIDs) > 0 {
+			ids := make([]string, len(lq.RankedIDs))
+			for i, id := range lq.RankedIDs {
+				ids[i] = strconv.Itoa(id)
+			}
+			sortExpr = "FIELD(b.id, " + strings.Join(ids, ",") + ")"
+		}
+	} else if lq.Sort != "" {
+		sortExpr = bookSortExprs[lq.Sort]
+	}
+	dir, cmp := "ASC", ">"
+	if lq.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	// Subquery popularity cukup berat, hanya dihitung jika dibutuhkan
+	popularityExpr := "0"
+	if lq.Sort == "popularity" || lq.wantsField("popularity") {
+		popularityExpr = bookPopularityExpr
+	}
+
+	query := `
+        SELECT b.id, b.title, b.author, b.year, b.genre, b.category, b.type, b.stockMax, b.fineAmount,
+               b.description, b.coverFile, b.location, b.ebookFile, b.rating_avg, b.rating_count, ` + sortExpr + ` AS sortValue, ` + popularityExpr + ` AS popularity,
+               cv.color, cv.variants
+        FROM ` + from + `
+        LEFT JOIN cover_variants cv ON cv.coverFile = b.coverFile` + where
+	queryArgs := append([]interface{}{}, args...)
+
+	if lq.Paginated {
+		if err := db.QueryRow("SELECT COUNT(*) FROM "+from+where, args...).Scan(&res.Total); err != nil {
+			return res, err
+		}
+
+		// Keyset: lanjut setelah (sortValue, id) terakhir
+		if lq.Cursor != nil {
+			if where == "" {
+				query += " WHERE "
+			} else {
+				query += " AND "
+			}
+			query += "(" + sortExpr + " " + cmp + " ? OR (" + sortExpr + " = ? AND b.id " + cmp + " ?))"
+			queryArgs = append(queryArgs, lq.Cursor.Value, lq.Cursor.Value, lq.Cursor.ID)
+		}
+	}
+
+	query += " ORDER BY " + sortExpr + " " + dir + ", b.id " + dir
+
+	if lq.Paginated {
+		query += " LIMIT ?"
+		queryArgs = append(queryArgs, lq.Limit+1)
+		if lq.Cursor == nil {
+			query += " OFFSET ?"
+			queryArgs = append(queryArgs, (lq.Page-1)*lq.Limit)
+		}
+	}
+
+	rows, err := db.Query(query, queryArgs...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var year, stockMax, fineAmount, popularity, ratingCount sql.NullInt64
+		var ratingAvg sql.NullFloat64
+		var title, author, genre, category, tipe, description, coverFile, location, ebookFile sql.NullString
+		var coverColor, coverVariants sql.NullString
+		var sortValue interface{}
+
+		if err := rows.Scan(&id, &title, &author, &year, &genre, &category, &tipe,
+			&stockMax, &fineAmount, &description, &coverFile, &location, &ebookFile, &ratingAvg, &ratingCount, &sortValue, &popularity, &coverColor, &coverVariants); err != nil {
+			return res, err
+		}
+
+		if lq.Paginated && len(res.Books) == lq.Limit {
+			res.HasMore = true
+			break
+		}
+
+		book := map[string]interface{}{
+			"id":          id,
+			"title":       title.String,
+			"author":      author.String,
+			"year":        int(year.Int64),
+			"genre":       genre.String,
+			"category":    category.String,
+			"type":        tipe.String,
+			"stock":       int(stockMax.Int64),
+			"fineAmount":  int(fineAmount.Int64),
+			"description": description.String,
+			"coverFile":   coverFile.String,
+			"location":    location.String,
+			"ebookFile":   ebookFile.String,
+			"ratingAvg":   ratingAvg.Float64,
+			"ratingCount": int(ratingCount.Int64),
+			// thumbnail JPEG/WebP & warna placeholder (lihat covers.go)
+			"coverColor":    coverColor.String,
+			"coverVariants": coverVariantsJSON(coverVariants),
+		}
+		if lq.Sort == "popularity" {
+			book["popularity"] = int(popularity.Int64)
+		}
+		res.Books = append(res.Books, projectBookFields(book, lq.Fields, int(popularity.Int64)))
+
+		// Driver MySQL mengembalikan []byte untuk kolom ekspresi
+		if b, ok := sortValue.([]byte); ok {
+			sortValue = string(b)
+		}
+		res.NextCursor = encodeBookCursor(bookCursor{Value: sortValue, ID: id})
+	}
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+
+	if !res.HasMore {
+		res.NextCursor = ""
+	}
+	return res, nil
+}
+
+// Ambil hanya field yang diminta (?fields=), tanpa fields = semua
+func projectBookFields(book map[string]interface{}, fields []string, popularity int) map[string]interface{} {
+	if len(fields) == 0 {
+		return book
+	}
+	out := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if f == "popularity" {
+			out[f] = popularity
+			continue
+		}
+		out[f] = book[f]
+	}
+	return out
+}
+
+// Bentuk response: array (perilaku lama) atau envelope jika client minta pagination
+func bookListResponse(res bookListResult, lq bookListQuery) interface{} {
+	books := res.Books
+	if books == nil {
+		books = []map[string]interface{}{}
+	}
+	if !lq.Paginated {
+		return res.Books
+	}
+
+	envelope := map[string]interface{}{
+		"data":       books,
+		"total":      res.Total,
+		"limit":      lq.Limit,
+		"hasMore":    res.HasMore,
+		"nextCursor": nil,
+	}
+	if lq.Cursor == nil {
+		envelope["page"] = lq.Page
+	}
+	if res.NextCursor != "" {
+		envelope["nextCursor"] = res.NextCursor
+	}
+	return envelope
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HugoSmits86/nativewebp"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ==========================================
+// PEMROSESAN SAMPUL
+// Setiap file sampul dibuatkan thumbnail beberapa lebar dalam JPEG dan WebP,
+// plus warna dominan untuk placeholder selagi gambar dimuat:
+//
+//	uploads/covers/thumbs/<nama-sampul>-<ekstensi>-sm|md|lg.jpg|webp
+//
+// Hasil dicatat per file di cover_variants. Nama sampul berupa hash isi
+// (lihat uploads.go), jadi sampul yang dipakai beberapa buku cukup diproses
+// sekali dan sampul yang diganti otomatis diproses ulang. Sampul baru masuk
+// antrean saat diupload; sweeper berkala mengisi sampul lama (backfill) dan
+// mencoba ulang yang gagal dengan jeda 1, 2, 4, ... jam.
+// ==========================================
+
+const (
+	coverDone   = "selesai"
+	coverFailed = "gagal"
+
+	coverThumbDir    = "uploads/covers/thumbs"
+	coverSweepEvery  = 30 * time.Minute
+	coverMaxPixels   = 40 << 20 // gambar lebih besar ditolak (decompression bomb)
+	coverJPEGQuality = 82
+	coverMaxAttempts = 5 // setelah ini sampul gagal tidak dicoba lagi otomatis
+)
+
+var coverSizes = []struct {
+	Name  string
+	Width int
+}{{"sm", 160}, {"md", 320}, {"lg", 640}}
+
+// Satu ukuran thumbnail; path relatif seperti coverFile
+type CoverVariant struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	JPEG   string `json:"jpeg"`
+	WebP   string `json:"webp"`
+}
+
+var (
+	coverQueue = make(chan string, 1024)
+
+	// Sampul yang sudah ada di antrean (hindari proses ganda)
+	coverPendingMu sync.Mutex
+	coverPending   = make(map[string]bool)
+)
+
+func startCoverProcessor() {
+	go func() {
+		for file := range coverQueue {
+			coverPendingMu.Lock()
+			delete(coverPending, file)
+			coverPendingMu.Unlock()
+			processCover(file)
+		}
+	}()
+	go func() {
+		for {
+			sweepCovers()
+			time.Sleep(coverSweepEvery)
+		}
+	}()
+}
+
+// Masukkan sampul ke antrean (tidak memblokir; jika penuh diambil sweeper berikutnya)
+func queueCoverProcessing(coverFile string) {
+	if coverFile == "" {
+		return
+	}
+	coverPendingMu.Lock()
+	defer coverPendingMu.Unlock()
+	if coverPending[coverFile] {
+		return
+	}
+	select {
+	case coverQueue <- coverFile:
+		coverPending[coverFile] = true
+	default:
+	}
+}
+
+// Antrekan sampul buku yang belum pernah diproses, atau gagal dan jedanya sudah lewat
+func sweepCovers() {
+	rows, err := db.Query(`
+		SELECT DISTINCT b.coverFile FROM books b
+		LEFT JOIN cover_variants cv ON cv.coverFile = b.coverFile
+		WHERE b.coverFile IS NOT NULL AND b.coverFile <> ''
+		  AND (cv.coverFile IS NULL
+		       OR (cv.status = ? AND cv.attempts < ?
+		           AND cv.processedAt <= NOW() - INTERVAL POW(2, cv.attempts - 1) HOUR))`,
+		coverFailed, coverMaxAttempts)
+	if err != nil {
+		log.Println("Sweep sampul gagal:", err)
+		return
+	}
+	var files []string
+	for rows.Next() {
+		var f string
+		if rows.Scan(&f) == nil {
+			files = append(files, f)
+		}
+	}
+	rows.Close()
+
+	for _, f := range files {
+		queueCoverProcessing(f)
+	}
+}
+
+// Buat thumbnail & warna dominan satu file sampul lalu catat hasilnya
+func processCover(coverFile string) {
+	var exists int
+	if db.QueryRow("SELECT COUNT(*) FROM cover_variants WHERE coverFile = ? AND status = ?", coverFile, coverDone).Scan(&exists); exists > 0 {
+		return
+	}
+
+	width, height, dominant, variants, err := buildCoverVariants(coverFile)
+	if err != nil {
+		log.Printf("Proses sampul %s gagal: %v", coverFile, err)
+		db.Exec(`
+			INSERT INTO cover_variants (coverFile, status, error, attempts, processedAt) VALUES (?, ?, ?, 1, NOW())
+			ON DUPLICATE KEY UPDATE status = VALUES(status), error = VALUES(error), attempts = attempts + 1, processedAt = NOW()`,
+			coverFile, coverFailed, truncateRunes(err.Error(), 255))
+		return
+	}
+
+	raw, _ := json.Marshal(variants)
+	if _, err := db.Exec(`
+		INSERT INTO cover_variants (coverFile, status, width, height, color, variants, error, processedAt)
+		VALUES (?, ?, ?, ?, ?, ?, NULL, NOW())
+		ON DUPLICATE KEY UPDATE status = VALUES(status), width = VALUES(width), height = VALUES(height),
+			color = VALUES(color), variants = VALUES(variants), error = NULL, attempts = 0, processedAt = NOW()`,
+		coverFile, coverDone, width, height, nullIfEmpty(dominant), string(raw)); err != nil {
+		log.Println("Gagal menyimpan hasil proses sampul:", err)
+	}
+}
+
+func buildCoverVariants(coverFile string) (int, int, string, map[string]CoverVariant, error) {
+	key, ok := cleanBlobKey(coverFile)
+	if !ok {
+		return 0, 0, "", nil, fmt.Errorf("path sampul tidak valid")
+	}
+	local, err := blobLocalPath(key)
+	if err != nil {
+		return 0, 0, "", nil, err
+	}
+	f, err := os.Open(local)
+	if err != nil {
+		return 0, 0, "", nil, err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, "", nil, fmt.Errorf("format gambar tidak dikenali: %v", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > coverMaxPixels {
+		return 0, 0, "", nil, fmt.Errorf("ukuran gambar %dx%d tidak didukung", cfg.Width, cfg.Height)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return 0, 0, "", nil, err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, 0, "", nil, err
+	}
+	b := img.Bounds()
+
+	base := coverThumbDir + "/" + coverThumbBase(key)
+	variants := make(map[string]CoverVariant, len(coverSizes))
+	var prev *CoverVariant
+	for _, size := range coverSizes {
+		w := size.Width
+		if w > b.Dx() {
+			w = b.Dx() // tidak diperbesar
+		}
+		// Gambar kecil: ukuran berikutnya sama dengan sebelumnya, pakai file yang sama
+		if prev != nil && prev.Width == w {
+			variants[size.Name] = *prev
+			continue
+		}
+		h := (b.Dy()*w + b.Dx()/2) / b.Dx()
+		if h < 1 {
+			h = 1
+		}
+		thumb := image.NewRGBA(image.Rect(0, 0, w, h))
+		xdraw.CatmullRom.Scale(thumb, thumb.Bounds(), img, b, draw.Src, nil)
+
+		v := CoverVariant{Width: w, Height: h, JPEG: base + "-" + size.Name + ".jpg", WebP: base + "-" + size.Name + ".webp"}
+
+		var buf bytes.Buffer
+		if err := nativewebp.Encode(&buf, thumb, nil); err != nil {
+			return 0, 0, "", nil, fmt.Errorf("encode WebP: %v", err)
+		}
+		if err := blobs.Put(v.WebP, &buf, int64(buf.Len()), mimeWebP); err != nil {
+			return 0, 0, "", nil, err
+		}
+
+		// JPEG tidak punya transparansi: latar putih seperti tampilan kartu katalog
+		flat := image.NewRGBA(thumb.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), thumb, image.Point{}, draw.Over)
+		buf.Reset()
+		if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: coverJPEGQuality}); err != nil {
+			return 0, 0, "", nil, fmt.Errorf("encode JPEG: %v", err)
+		}
+		if err := blobs.Put(v.JPEG, &buf, int64(buf.Len()), mimeJPEG); err != nil {
+			return 0, 0, "", nil, err
+		}
+
+		variants[size.Name] = v
+		prev = &v
+	}
+	return b.Dx(), b.Dy(), dominantColor(img), variants, nil
+}
+
+// Nama dasar thumbnail: ekstensi ikut masuk supaya logo.png & logo.jpg tidak bertabrakan
+func coverThumbBase(key string) string {
+	name := path.Base(key)
+	ext := path.Ext(name)
+	if ext == "" {
+		return name
+	}
+	return strings.TrimSuffix(name, ext) + "-" + strings.ToLower(ext[1:])
+}
+
+// Warna dominan (#rrggbb): gambar diperkecil, warna dikelompokkan per 4 bit
+// tiap kanal lalu diambil rata-rata kelompok terbanyak. Piksel transparan
+// (logo PNG tanpa latar) diabaikan; "" jika seluruhnya transparan.
+func dominantColor(img image.Image) string {
+	small := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	xdraw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	type bucket struct{ r, g, b, n int }
+	buckets := make(map[int]*bucket)
+	var best *bucket
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			c := small.RGBAAt(x, y)
+			if c.A < 128 {
+				continue
+			}
+			// RGBA premultiplied -> warna asli
+			r, g, bl := int(c.R)*255/int(c.A), int(c.G)*255/int(c.A), int(c.B)*255/int(c.A)
+			k := (r>>4)<<8 | (g>>4)<<4 | bl>>4
+			bk := buckets[k]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[k] = bk
+			}
+			bk.r, bk.g, bk.b, bk.n = bk.r+r, bk.g+g, bk.b+bl, bk.n+1
+			if best == nil || bk.n > best.n {
+				best = bk
+			}
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.n, best.g/best.n, best.b/best.n)
+}
+
+// Hapus thumbnail & catatan proses sampul yang filenya sudah dihapus
+func deleteCoverVariants(coverFile string) {
+	var raw sql.NullString
+	db.QueryRow("SELECT variants FROM cover_variants WHERE coverFile = ?", coverFile).Scan(&raw)
+	var variants map[string]CoverVariant
+	if json.Unmarshal([]byte(raw.String), &variants) == nil {
+		for _, v := range variants {
+			deleteBlob(v.JPEG)
+			deleteBlob(v.WebP)
+		}
+	}
+	db.Exec("DELETE FROM cover_variants WHERE coverFile = ?", coverFile)
+}
+
+// Nilai JSON variants untuk response buku (null jika belum diproses)
+func coverVariantsJSON(raw sql.NullString) interface{} {
+	if !raw.Valid || raw.String == "" {
+		return nil
+	}
+	return json.RawMessage(raw.String)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDominantColor(t *testing.T) {
+	solid := func(c color.Color) image.Image {
+		img := image.NewNRGBA(image.Rect(0, 0, 40, 60))
+		for y := 0; y < 60; y++ {
+			for x := 0; x < 40; x++ {
+				img.Set(x, y, c)
+			}
+		}
+		return img
+	}
+	// Atas 2/3 merah, bawah 1/3 biru
+	split := image.NewNRGBA(image.Rect(0, 0, 30, 90))
+	for y := 0; y < 90; y++ {
+		for x := 0; x < 30; x++ {
+			c := color.NRGBA{200, 30, 40, 255}
+			if y >= 60 {
+				c = color.NRGBA{20, 40, 200, 255}
+			}
+			split.Set(x, y, c)
+		}
+	}
+	// Logo transparan: hanya sebagian kecil piksel yang terlihat
+	logo := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 24; y < 40; y++ {
+		for x := 24; x < 40; x++ {
+			logo.Set(x, y, color.NRGBA{10, 120, 60, 255})
+		}
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+		want string
+	}{
+		{"putih", solid(color.White), "#ffffff"},
+		{"merah", solid(color.NRGBA{200, 30, 40, 255}), "#c81e28"},
+		{"grayscale", solid(color.Gray{128}), "#808080"},
+		{"warna terbanyak menang", split, "#c81e28"},
+		{"piksel transparan diabaikan", logo, "#0a783c"},
+		{"seluruhnya transparan", image.NewNRGBA(image.Rect(0, 0, 10, 10)), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dominantColor(tt.img); got != tt.want {
+				t.Errorf("dominantColor = %q, ingin %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoverThumbBase(t *testing.T) {
+	tests := map[string]string{
+		"uploads/covers/logo.png":   "logo-png",
+		"uploads/covers/logo.jpg":   "logo-jpg",
+		"uploads/covers/abc.WEBP":   "abc-webp",
+		"uploads/covers/tanpa-ekst": "tanpa-ekst",
+	}
+	for in, want := range tests {
+		if got := coverThumbBase(in); got != want {
+			t.Errorf("coverThumbBase(%q) = %q, ingin %q", in, got, want)
+		}
+	}
+}
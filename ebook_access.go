@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// AKSES EBOOK TERPROTEKSI
+// File di uploads/ebooks tidak lagi dilayani FileServer publik. Reader
+// mendapat URL bertanda tangan (HMAC) yang berlaku singkat dan terikat ke
+// user & buku; endpoint stream mengecek ulang hak akses lalu melayani file
+// lewat http.ServeContent (mendukung Range untuk PDF.js dan conditional GET).
+//
+// Kebijakan akses per buku (books.ebookAccess):
+//
+//	member  semua member yang login boleh membaca (default)
+//	loan    hanya member dengan pinjaman digital aktif (lihat ebook_loans.go)
+//
+// Judul berlisensi terbatas (ebookLicenses > 0) selalu memakai aturan loan.
+// Admin selalu boleh membaca.
+// ==========================================
+
+const (
+	ebookAccessMember = "member"
+	ebookAccessLoan   = "loan"
+
+	ebookURLTTL = 30 * time.Minute
+)
+
+// Kunci HMAC: EBOOK_URL_SECRET, atau acak per proses (URL lama gugur saat restart)
+var ebookURLKey = loadEbookURLKey()
+
+func loadEbookURLKey() []byte {
+	if s := os.Getenv("EBOOK_URL_SECRET"); s != "" {
+		return []byte(s)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal("Gagal membuat kunci URL ebook:", err)
+	}
+	return key
+}
+
+func validEbookAccess(v string) bool {
+	return v == ebookAccessMember || v == ebookAccessLoan
+}
+
+func ebookURLSignature(userID, bookID int, exp int64) string {
+	mac := hmac.New(sha256.New, ebookURLKey)
+	fmt.Fprintf(mac, "%d:%d:%d", userID, bookID, exp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// URL stream bertanda tangan untuk user & buku tertentu
+func signedEbookURL(userID, bookID int) (string, time.Time) {
+	exp := time.Now().Add(ebookURLTTL)
+	return fmt.Sprintf("/ebooks/stream/%d?u=%d&exp=%d&sig=%s",
+		bookID, userID, exp.Unix(), ebookURLSignature(userID, bookID, exp.Unix())), exp
+}
+
+// Cek hak baca; mengembalikan path file ebook, atau status HTTP & pesan jika ditolak
+func ebookEntitlement(userID int, role string, bookID int) (string, int, string) {
+	var file, access sql.NullString
+	var licenses int
+	err := db.QueryRow("SELECT ebookFile, ebookAccess, ebookLicenses FROM books WHERE id = ?", bookID).Scan(&file, &access, &licenses)
+	if err != nil || file.String == "" {
+		return "", http.StatusNotFound, "Ebook tidak ditemukan"
+	}
+	if role == "admin" {
+		return file.String, 0, ""
+	}
+	if (access.String == ebookAccessLoan || licenses > 0) && !hasActiveEbookLoan(userID, bookID) {
+		return "", http.StatusForbidden, "Ebook ini hanya bisa dibaca saat sedang dipinjam"
+	}
+	return file.String, 0, ""
+}
+
+// Path ebook dari database harus tetap di dalam uploads/ebooks
+func ebookDiskPath(file string) (string, bool) {
+	p := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(file, "/")))
+	base := filepath.Join("uploads", "ebooks")
+	return p, strings.HasPrefix(p, base+string(filepath.Separator))
+}
+
+// Kirim file ebook; Range, If-Range dan If-None-Match ditangani ServeContent.
+// PDF untuk member dikirim sebagai salinan ber-watermark (lihat watermark.go).
+func serveEbookFile(w http.ResponseWriter, r *http.Request, userID int, role string, bookID int, file string, exp time.Time) {
+	p, ok := ebookDiskPath(file)
+	if !ok {
+		http.Error(w, "Ebook tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	name := filepath.Base(p)
+	p, err := blobLocalPath(filepath.ToSlash(p))
+	if err != nil {
+		http.Error(w, "Ebook tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if watermarkMode != watermarkOff && role != "admin" && strings.EqualFold(filepath.Ext(p), ".pdf") {
+		stamped, err := watermarkedEbook(p, userID, bookID)
+		if err != nil {
+			log.Printf("Watermark ebook %d untuk user %d gagal: %v", bookID, userID, err)
+			http.Error(w, "Gagal menyiapkan ebook", http.StatusInternalServerError)
+			return
+		}
+		p = stamped
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		http.Error(w, "Ebook tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.Error(w, "Ebook tidak ditemukan", http.StatusNotFound)
+		return
+	}
+
+	// Boleh di-cache browser pemilik URL selama URL masih berlaku, tidak oleh proxy
+	maxAge := 0
+	if !exp.IsZero() {
+		maxAge = int(time.Until(exp).Seconds())
+	}
+	if maxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d, no-transform", maxAge))
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache, no-transform")
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	w.Header().Set("Content-Type", opdsFileType(p))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, name))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// GET/HEAD /ebooks/stream/{bookId}?u=&exp=&sig=
+func ebookStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bookID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/ebooks/stream/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	userID, _ := strconv.Atoi(q.Get("u"))
+	exp, _ := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if userID == 0 || !hmac.Equal([]byte(q.Get("sig")), []byte(ebookURLSignature(userID, bookID, exp))) {
+		http.Error(w, "Link ebook tidak valid", http.StatusForbidden)
+		return
+	}
+
+	// Link kedaluwarsa masih boleh dipakai pemiliknya selama session-nya aktif,
+	// supaya Range request PDF.js tidak putus di tengah sesi baca yang panjang
+	expiresAt := time.Unix(exp, 0)
+	if time.Now().After(expiresAt) {
+		if getCurrentUser(r).ID != userID {
+			http.Error(w, "Link ebook sudah kedaluwarsa", http.StatusForbidden)
+			return
+		}
+		expiresAt = time.Time{}
+	}
+
+	// Hak akses dicek ulang: pinjaman bisa saja sudah berakhir
+	var role string
+	if err := db.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&role); err != nil {
+		http.Error(w, "Link ebook tidak valid", http.StatusForbidden)
+		return
+	}
+	file, status, msg := ebookEntitlement(userID, role, bookID)
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	serveEbookFile(w, r, userID, role, bookID, file, expiresAt)
+}
+
+// API Handler: URL baca baru untuk reader (dipanggil ulang jika link kedaluwarsa)
+// GET /api/ebook/url?bookId=1
+func ebookURLAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user := getCurrentUser(r)
+	if user.ID == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "User belum login"})
+		return
+	}
+	bookID, err := strconv.Atoi(r.URL.Query().Get("bookId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "bookId tidak valid"})
+		return
+	}
+	if _, status, msg := ebookEntitlement(user.ID, user.Role, bookID); status != 0 {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: msg})
+		return
+	}
+
+	url, exp := signedEbookURL(user.ID, bookID)
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":       url,
+		"expiresAt": exp,
+	})
+}
+
+// File /uploads/ dari blob store, tanpa folder ebooks (hanya lewat /ebooks/stream)
+func uploadsFileServer() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := path.Clean("/" + strings.TrimPrefix(r.URL.Path, "/uploads/"))
+		if lp := strings.ToLower(p); lp == "/ebooks" || strings.HasPrefix(lp, "/ebooks/") {
+			http.NotFound(w, r)
+			return
+		}
+		serveBlob(w, r, "uploads"+p)
+	})
+}
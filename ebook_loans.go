@@ -0,0 +1,577 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// PEMINJAMAN DIGITAL (EBOOK)
+// Terpisah dari stok fisik (stockMax). Tiap judul punya jumlah lisensi
+// (books.ebookLicenses, 0 = tanpa batas) dan lama pinjam
+// (books.ebookLoanDays). Jika semua lisensi terpakai member bisa masuk
+// antrean; saat lisensi kembali, antrean terdepan mendapat "hold" selama
+// ebookHoldHours jam untuk meminjam sebelum giliran pindah ke berikutnya.
+// Semua perhitungan waktu memakai NOW() di database supaya konsisten.
+// ==========================================
+
+const (
+	ebookLoanActive   = "aktif"
+	ebookLoanReturned = "dikembalikan"
+	ebookLoanExpired  = "kedaluwarsa"
+
+	defaultEbookLoanDays = 14
+	maxEbookLoanDays     = 90
+	ebookHoldHours       = 48
+	ebookLoanSweepEvery  = time.Minute
+)
+
+type EbookLoan struct {
+	ID         int        `json:"id"`
+	BookID     int        `json:"bookId"`
+	Title      string     `json:"title"`
+	CoverFile  string     `json:"coverFile"`
+	Status     string     `json:"status"`
+	BorrowedAt time.Time  `json:"borrowedAt"`
+	DueAt      time.Time  `json:"dueAt"`
+	ReturnedAt *time.Time `json:"returnedAt,omitempty"`
+}
+
+type EbookWaitlistEntry struct {
+	BookID    int        `json:"bookId"`
+	Title     string     `json:"title"`
+	Position  int        `json:"position"`
+	JoinedAt  time.Time  `json:"joinedAt"`
+	HoldUntil *time.Time `json:"holdUntil,omitempty"` // terisi jika lisensi sedang disiapkan untuk user
+}
+
+// Ketersediaan lisensi satu judul untuk user tertentu
+type ebookAvailability struct {
+	BookID        int        `json:"bookId"`
+	Licenses      int        `json:"licenses"` // 0 = tanpa batas
+	LoanDays      int        `json:"loanDays"`
+	ActiveLoans   int        `json:"activeLoans"`
+	Available     int        `json:"available"` // -1 = tanpa batas
+	WaitlistCount int        `json:"waitlistCount"`
+	MyLoan        *EbookLoan `json:"myLoan,omitempty"`
+	MyPosition    int        `json:"myPosition,omitempty"`
+	MyHoldUntil   *time.Time `json:"myHoldUntil,omitempty"`
+	CanBorrow     bool       `json:"canBorrow"`
+}
+
+// Dipakai bersama oleh *sql.DB dan *sql.Tx
+type sqlQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func startEbookLoanSweeper() {
+	go func() {
+		for {
+			sweepEbookLoans()
+			time.Sleep(ebookLoanSweepEvery)
+		}
+	}()
+	go func() {
+		for {
+			sweepWatermarkCache()
+			time.Sleep(watermarkSweepEvery)
+		}
+	}()
+}
+
+// Akhiri pinjaman yang lewat jatuh tempo dan hold yang tidak diambil,
+// lalu serahkan lisensi yang bebas ke antrean berikutnya
+func sweepEbookLoans() {
+	books := make(map[int]bool)
+	collect := func(query string) {
+		rows, err := db.Query(query)
+		if err != nil {
+			log.Println("Sweep pinjaman ebook gagal:", err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int
+			if rows.Scan(&id) == nil {
+				books[id] = true
+			}
+		}
+	}
+
+	collect("SELECT DISTINCT bookId FROM ebook_loans WHERE status = 'aktif' AND dueAt <= NOW()")
+	collect("SELECT DISTINCT bookId FROM ebook_waitlist WHERE holdUntil IS NOT NULL AND holdUntil <= NOW()")
+	if len(books) == 0 {
+		return
+	}
+
+	// Salinan ber-watermark pinjaman yang berakhir tidak dipakai lagi
+	type loanKey struct{ bookID, userID int }
+	var expired []loanKey
+	if rows, err := db.Query("SELECT bookId, userId FROM ebook_loans WHERE status = ? AND dueAt <= NOW()", ebookLoanActive); err == nil {
+		for rows.Next() {
+			var k loanKey
+			if rows.Scan(&k.bookID, &k.userID) == nil {
+				expired = append(expired, k)
+			}
+		}
+		rows.Close()
+	}
+
+	if _, err := db.Exec("UPDATE ebook_loans SET status = ? WHERE status = ? AND dueAt <= NOW()", ebookLoanExpired, ebookLoanActive); err != nil {
+		log.Println("Sweep pinjaman ebook gagal:", err)
+	}
+	if _, err := db.Exec("DELETE FROM ebook_waitlist WHERE holdUntil IS NOT NULL AND holdUntil <= NOW()"); err != nil {
+		log.Println("Sweep antrean ebook gagal:", err)
+	}
+	for _, k := range expired {
+		purgeWatermarkCopies(k.bookID, k.userID)
+	}
+	for bookID := range books {
+		promoteEbookWaitlist(bookID)
+	}
+}
+
+// Beri hold ke antrean terdepan sebanyak lisensi yang bebas
+func promoteEbookWaitlist(bookID int) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Promosi antrean ebook gagal:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var licenses int
+	if err := tx.QueryRow("SELECT ebookLicenses FROM books WHERE id = ? FOR UPDATE", bookID).Scan(&licenses); err != nil {
+		return
+	}
+
+	if licenses == 0 {
+		// Tanpa batas: semua yang antre langsung boleh meminjam
+		_, err = tx.Exec("UPDATE ebook_waitlist SET holdUntil = DATE_ADD(NOW(), INTERVAL ? HOUR) WHERE bookId = ? AND holdUntil IS NULL",
+			ebookHoldHours, bookID)
+	} else {
+		active, holds := countEbookUsage(tx, bookID, 0)
+		free := licenses - active - holds
+		if free <= 0 {
+			return
+		}
+		_, err = tx.Exec(`
+			UPDATE ebook_waitlist SET holdUntil = DATE_ADD(NOW(), INTERVAL ? HOUR)
+			WHERE bookId = ? AND holdUntil IS NULL
+			ORDER BY createdAt, id LIMIT ?`,
+			ebookHoldHours, bookID, free)
+	}
+	if err != nil {
+		log.Println("Promosi antrean ebook gagal:", err)
+		return
+	}
+	tx.Commit()
+}
+
+// Jumlah pinjaman aktif dan hold yang masih berlaku (kecuali milik exceptUser)
+func countEbookUsage(q sqlQueryer, bookID, exceptUser int) (active, holds int) {
+	q.QueryRow("SELECT COUNT(*) FROM ebook_loans WHERE bookId = ? AND status = 'aktif' AND dueAt > NOW()", bookID).Scan(&active)
+	q.QueryRow("SELECT COUNT(*) FROM ebook_waitlist WHERE bookId = ? AND holdUntil > NOW() AND userId <> ?", bookID, exceptUser).Scan(&holds)
+	return
+}
+
+func loadEbookAvailability(userID, bookID int) (ebookAvailability, error) {
+	av := ebookAvailability{BookID: bookID}
+	err := db.QueryRow("SELECT ebookLicenses, ebookLoanDays FROM books WHERE id = ?", bookID).Scan(&av.Licenses, &av.LoanDays)
+	if err != nil {
+		return av, err
+	}
+	var holds int
+	av.ActiveLoans, holds = countEbookUsage(db, bookID, userID)
+	db.QueryRow("SELECT COUNT(*) FROM ebook_waitlist WHERE bookId = ?", bookID).Scan(&av.WaitlistCount)
+
+	if loans, err := queryEbookLoans("l.userId = ? AND l.bookId = ? AND l.status = 'aktif' AND l.dueAt > NOW()", userID, bookID); err == nil && len(loans) > 0 {
+		av.MyLoan = &loans[0]
+	}
+
+	var joinedAt time.Time
+	var holdUntil sql.NullTime
+	var hasHold bool
+	err = db.QueryRow("SELECT createdAt, holdUntil, COALESCE(holdUntil > NOW(), 0) FROM ebook_waitlist WHERE userId = ? AND bookId = ?",
+		userID, bookID).Scan(&joinedAt, &holdUntil, &hasHold)
+	if err == nil {
+		db.QueryRow("SELECT COUNT(*) + 1 FROM ebook_waitlist WHERE bookId = ? AND createdAt < ?", bookID, joinedAt).Scan(&av.MyPosition)
+		if hasHold {
+			av.MyHoldUntil = &holdUntil.Time
+		}
+	}
+
+	// Tanpa hold, antrean yang belum mendapat giliran tetap didahulukan
+	var waiting int
+	if !hasHold {
+		db.QueryRow("SELECT COUNT(*) FROM ebook_waitlist WHERE bookId = ? AND holdUntil IS NULL AND userId <> ?", bookID, userID).Scan(&waiting)
+	}
+	if av.Licenses == 0 {
+		av.Available = -1
+	} else if av.Available = av.Licenses - av.ActiveLoans - holds - waiting; av.Available < 0 {
+		av.Available = 0
+	}
+	av.CanBorrow = av.MyLoan == nil && (av.Licenses == 0 || hasHold || av.Available > 0)
+	return av, nil
+}
+
+func queryEbookLoans(where string, args ...interface{}) ([]EbookLoan, error) {
+	rows, err := db.Query(`
+		SELECT l.id, l.bookId, b.title, b.coverFile, l.status, l.borrowedAt, l.dueAt, l.returnedAt
+		FROM ebook_loans l JOIN books b ON b.id = l.bookId
+		WHERE `+where+` ORDER BY l.borrowedAt DESC LIMIT 100`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loans := []EbookLoan{}
+	for rows.Next() {
+		var l EbookLoan
+		var cover sql.NullString
+		var returned sql.NullTime
+		if err := rows.Scan(&l.ID, &l.BookID, &l.Title, &cover, &l.Status, &l.BorrowedAt, &l.DueAt, &returned); err != nil {
+			return nil, err
+		}
+		l.CoverFile = cover.String
+		if returned.Valid {
+			l.ReturnedAt = &returned.Time
+		}
+		loans = append(loans, l)
+	}
+	return loans, rows.Err()
+}
+
+// Member punya pinjaman digital aktif atas buku ini
+func hasActiveEbookLoan(userID, bookID int) bool {
+	var ok bool
+	db.QueryRow("SELECT EXISTS(SELECT 1 FROM ebook_loans WHERE userId = ? AND bookId = ? AND status = 'aktif' AND dueAt > NOW())",
+		userID, bookID).Scan(&ok)
+	return ok
+}
+
+func readBookIDBody(r *http.Request) (int, bool) {
+	var input struct {
+		BookID int `json:"bookId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.BookID == 0 {
+		return 0, false
+	}
+	return input.BookID, true
+}
+
+// /api/ebook/loans
+//
+//	GET  /api/ebook/loans                 pinjaman aktif + riwayat + antrean milik user
+//	POST /api/ebook/loans                 {"bookId"} pinjam ebook
+//	GET  /api/ebook/loans/status?bookId=  ketersediaan lisensi & posisi antrean
+//	POST /api/ebook/loans/return          {"bookId"} kembalikan lebih awal
+func ebookLoansAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user := getCurrentUser(r)
+	if user.ID == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "User belum login"})
+		return
+	}
+
+	switch sub := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/ebook/loans"), "/"); {
+	case sub == "" && r.Method == http.MethodGet:
+		listMyEbookLoans(w, user)
+	case sub == "" && r.Method == http.MethodPost:
+		checkoutEbook(w, r, user)
+	case sub == "status" && r.Method == http.MethodGet:
+		bookID, err := strconv.Atoi(r.URL.Query().Get("bookId"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "bookId tidak valid"})
+			return
+		}
+		av, err := loadEbookAvailability(user.ID, bookID)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Buku tidak ditemukan"})
+			return
+		}
+		json.NewEncoder(w).Encode(av)
+	case sub == "return" && r.Method == http.MethodPost:
+		returnEbook(w, r, user)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Endpoint tidak ditemukan"})
+	}
+}
+
+func listMyEbookLoans(w http.ResponseWriter, user User) {
+	active, err := queryEbookLoans("l.userId = ? AND l.status = 'aktif' AND l.dueAt > NOW()", user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	history, err := queryEbookLoans("l.userId = ? AND (l.status <> 'aktif' OR l.dueAt <= NOW())", user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+
+	waitlist := []EbookWaitlistEntry{}
+	rows, err := db.Query(`
+		SELECT w.bookId, b.title, w.createdAt, w.holdUntil, COALESCE(w.holdUntil > NOW(), 0),
+		       (SELECT COUNT(*) + 1 FROM ebook_waitlist x WHERE x.bookId = w.bookId AND x.createdAt < w.createdAt)
+		FROM ebook_waitlist w JOIN books b ON b.id = w.bookId
+		WHERE w.userId = ? ORDER BY w.createdAt`, user.ID)
+	if err == nil {
+		for rows.Next() {
+			var e EbookWaitlistEntry
+			var hold sql.NullTime
+			var onHold bool
+			if rows.Scan(&e.BookID, &e.Title, &e.JoinedAt, &hold, &onHold, &e.Position) != nil {
+				continue
+			}
+			if onHold {
+				e.HoldUntil = &hold.Time
+			}
+			waitlist = append(waitlist, e)
+		}
+		rows.Close()
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"active":   active,
+		"history":  history,
+		"waitlist": waitlist,
+	})
+}
+
+func checkoutEbook(w http.ResponseWriter, r *http.Request, user User) {
+	bookID, ok := readBookIDBody(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "bookId tidak valid"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Kunci baris buku supaya dua checkout bersamaan tidak melebihi lisensi
+	var bookType, ebookFile sql.NullString
+	var licenses, loanDays int
+	err = tx.QueryRow("SELECT `type`, ebookFile, ebookLicenses, ebookLoanDays FROM books WHERE id = ? FOR UPDATE", bookID).
+		Scan(&bookType, &ebookFile, &licenses, &loanDays)
+	if err != nil || ebookFile.String == "" || (bookType.String != "Ebook" && bookType.String != "Fisik & Ebook") {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Ebook tidak ditemukan"})
+		return
+	}
+
+	var already bool
+	tx.QueryRow("SELECT EXISTS(SELECT 1 FROM ebook_loans WHERE userId = ? AND bookId = ? AND status = 'aktif' AND dueAt > NOW())",
+		user.ID, bookID).Scan(&already)
+	if already {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Ebook ini sedang Anda pinjam"})
+		return
+	}
+
+	if licenses > 0 {
+		var hasHold bool
+		tx.QueryRow("SELECT EXISTS(SELECT 1 FROM ebook_waitlist WHERE userId = ? AND bookId = ? AND holdUntil > NOW())",
+			user.ID, bookID).Scan(&hasHold)
+		active, holds := countEbookUsage(tx, bookID, user.ID)
+
+		// Tanpa hold, lisensi bebas tetap harus mendahulukan yang sudah antre
+		var waiting int
+		if !hasHold {
+			tx.QueryRow("SELECT COUNT(*) FROM ebook_waitlist WHERE bookId = ? AND holdUntil IS NULL AND userId <> ?", bookID, user.ID).Scan(&waiting)
+		}
+		if active+holds+waiting >= licenses {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success":  false,
+				"message":  "Semua lisensi ebook sedang dipinjam, silakan masuk antrean",
+				"waitlist": true,
+			})
+			if waiting > 0 && active+holds < licenses {
+				go promoteEbookWaitlist(bookID)
+			}
+			return
+		}
+	}
+
+	if loanDays <= 0 {
+		loanDays = defaultEbookLoanDays
+	}
+	res, err := tx.Exec("INSERT INTO ebook_loans (userId, bookId, status, borrowedAt, dueAt) VALUES (?, ?, ?, NOW(), DATE_ADD(NOW(), INTERVAL ? DAY))",
+		user.ID, bookID, ebookLoanActive, loanDays)
+	var id int64
+	var due time.Time
+	if err == nil {
+		id, _ = res.LastInsertId()
+		err = tx.QueryRow("SELECT dueAt FROM ebook_loans WHERE id = ?", id).Scan(&due)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM ebook_waitlist WHERE userId = ? AND bookId = ?", user.ID, bookID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Ebook berhasil dipinjam",
+		"data":    map[string]interface{}{"id": id, "bookId": bookID, "dueAt": due},
+	})
+}
+
+func returnEbook(w http.ResponseWriter, r *http.Request, user User) {
+	bookID, ok := readBookIDBody(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "bookId tidak valid"})
+		return
+	}
+
+	res, err := db.Exec(`
+		UPDATE ebook_loans SET status = ?, returnedAt = NOW()
+		WHERE userId = ? AND bookId = ? AND status = ?`,
+		ebookLoanReturned, user.ID, bookID, ebookLoanActive)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Tidak ada pinjaman aktif untuk ebook ini"})
+		return
+	}
+
+	go purgeWatermarkCopies(bookID, user.ID)
+	go promoteEbookWaitlist(bookID)
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Ebook berhasil dikembalikan"})
+}
+
+// /api/ebook/waitlist
+//
+//	POST   {"bookId"}  masuk antrean
+//	DELETE ?bookId=1   keluar dari antrean
+func ebookWaitlistAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user := getCurrentUser(r)
+	if user.ID == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "User belum login"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		bookID, ok := readBookIDBody(r)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "bookId tidak valid"})
+			return
+		}
+		av, err := loadEbookAvailability(user.ID, bookID)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Buku tidak ditemukan"})
+			return
+		}
+		if av.MyLoan != nil {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Ebook ini sedang Anda pinjam"})
+			return
+		}
+		if av.Licenses == 0 {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Ebook ini bisa langsung dipinjam tanpa antre"})
+			return
+		}
+
+		res, err := db.Exec("INSERT IGNORE INTO ebook_waitlist (userId, bookId) VALUES (?, ?)", user.ID, bookID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Anda sudah ada di antrean"})
+			return
+		}
+		// Jika ternyata ada lisensi bebas, langsung dapat hold
+		promoteEbookWaitlist(bookID)
+
+		av, _ = loadEbookAvailability(user.ID, bookID)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Berhasil masuk antrean",
+			"data":    av,
+		})
+
+	case http.MethodDelete:
+		bookID, err := strconv.Atoi(r.URL.Query().Get("bookId"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "bookId tidak valid"})
+			return
+		}
+		res, err := db.Exec("DELETE FROM ebook_waitlist WHERE userId = ? AND bookId = ?", user.ID, bookID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Anda tidak ada di antrean"})
+			return
+		}
+		// Hold yang dilepas diteruskan ke antrean berikutnya
+		go promoteEbookWaitlist(bookID)
+		json.NewEncoder(w).Encode(Response{Success: true, Message: "Keluar dari antrean"})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Method not allowed"})
+	}
+}
+
+// Lisensi & lama pinjam dari form admin; nil = field tidak dikirim
+func parseEbookLicenseForm(r *http.Request) (licenses, loanDays *int, msg string) {
+	if v := strings.TrimSpace(r.FormValue("ebookLicenses")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, nil, "Jumlah lisensi ebook tidak valid"
+		}
+		licenses = &n
+	}
+	if v := strings.TrimSpace(r.FormValue("ebookLoanDays")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxEbookLoanDays {
+			return nil, nil, "Lama pinjam ebook harus 1-90 hari"
+		}
+		loanDays = &n
+	}
+	return licenses, loanDays, ""
+}
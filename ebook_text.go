@@ -0,0 +1,542 @@
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ==========================================
+// PENCARIAN ISI EBOOK
+// Worker background mengekstrak teks tiap ebook di uploads/ebooks per
+// halaman (PDF) atau per bab spine (EPUB) ke tabel ebook_text_pages.
+// Kolom terms berisi token hasil analyzeText (stopword & stemming yang sama
+// dengan search katalog) dan diindex FULLTEXT MySQL; kolom content menyimpan
+// teks asli untuk snippet.
+//
+// Ebook masuk antrean saat diupload; sweeper berkala menangkap ebook lama
+// dan file yang berganti. Versi file (ukuran + mtime) dicatat di
+// ebook_text_index supaya file yang sama tidak diekstrak ulang.
+// ==========================================
+
+const (
+	ebookTextDone   = "selesai"
+	ebookTextFailed = "gagal"
+
+	ebookTextSweepEvery  = 15 * time.Minute
+	ebookTextMaxPages    = 5000
+	ebookTextMaxPageSize = 64 << 10 // teks per halaman yang disimpan
+
+	ebookSearchMaxRows     = 300 // baris halaman yang diambil dari FULLTEXT
+	ebookSearchHitsPerBook = 5
+	ebookSearchMaxBooks    = 20
+)
+
+var (
+	ebookTextQueue = make(chan int, 1024)
+
+	// Buku yang sudah ada di antrean (hindari ekstraksi ganda)
+	ebookTextPendingMu sync.Mutex
+	ebookTextPending   = make(map[int]bool)
+)
+
+// Satu halaman / bab hasil ekstraksi
+type ebookTextPage struct {
+	Page    int
+	Href    string // EPUB: href spine untuk membuka reader di bab ini
+	Content string
+}
+
+type EbookSearchHit struct {
+	Page    int    `json:"page"`
+	Href    string `json:"href,omitempty"`
+	Snippet string `json:"snippet"` // HTML, kata yang cocok dibungkus <mark>
+	URL     string `json:"url"`     // buka reader langsung di hit ini
+}
+
+type EbookSearchResult struct {
+	BookID    int              `json:"bookId"`
+	Title     string           `json:"title"`
+	Author    string           `json:"author"`
+	CoverFile string           `json:"coverFile"`
+	Format    string           `json:"format"`
+	TotalHits int              `json:"totalHits"`
+	Hits      []EbookSearchHit `json:"hits"`
+
+	score float64
+}
+
+func startEbookTextIndexer() {
+	go func() {
+		for id := range ebookTextQueue {
+			ebookTextPendingMu.Lock()
+			delete(ebookTextPending, id)
+			ebookTextPendingMu.Unlock()
+			indexEbookText(id)
+		}
+	}()
+	go func() {
+		for {
+			sweepEbookText()
+			time.Sleep(ebookTextSweepEvery)
+		}
+	}()
+}
+
+// Masukkan buku ke antrean ekstraksi (tidak memblokir; jika antrean penuh
+// buku diambil sweeper berikutnya)
+func queueEbookText(bookID int) {
+	ebookTextPendingMu.Lock()
+	defer ebookTextPendingMu.Unlock()
+	if ebookTextPending[bookID] {
+		return
+	}
+	select {
+	case ebookTextQueue <- bookID:
+		ebookTextPending[bookID] = true
+	default:
+	}
+}
+
+// Antrekan ebook yang belum diindex / filenya berganti, bersihkan yang ebooknya dihapus
+func sweepEbookText() {
+	if _, err := db.Exec(`
+		DELETE p FROM ebook_text_pages p JOIN books b ON b.id = p.bookId
+		WHERE b.ebookFile IS NULL OR b.ebookFile = ''`); err != nil {
+		log.Println("Sweep index teks ebook gagal:", err)
+	}
+	db.Exec(`
+		DELETE x FROM ebook_text_index x JOIN books b ON b.id = x.bookId
+		WHERE b.ebookFile IS NULL OR b.ebookFile = ''`)
+
+	rows, err := db.Query(`
+		SELECT b.id FROM books b
+		LEFT JOIN ebook_text_index x ON x.bookId = b.id
+		WHERE b.ebookFile IS NOT NULL AND b.ebookFile <> ''
+		  AND (x.bookId IS NULL OR x.ebookFile <> b.ebookFile)`)
+	if err != nil {
+		log.Println("Sweep index teks ebook gagal:", err)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	for _, id := range ids {
+		queueEbookText(id)
+	}
+}
+
+// Ekstrak & simpan teks satu ebook (dilewati jika versi file sudah diindex)
+func indexEbookText(bookID int) {
+	var file sql.NullString
+	if err := db.QueryRow("SELECT ebookFile FROM books WHERE id = ?", bookID).Scan(&file); err != nil || file.String == "" {
+		return
+	}
+	p, ok := ebookDiskPath(file.String)
+	if !ok {
+		return
+	}
+	info, err := blobs.Stat(filepath.ToSlash(p))
+	if err != nil {
+		log.Printf("Index teks ebook %d: %v", bookID, err)
+		return
+	}
+	version := fmt.Sprintf("%x-%x", info.Size, info.ModTime.UnixNano())
+
+	var indexed sql.NullString
+	db.QueryRow("SELECT fileVersion FROM ebook_text_index WHERE bookId = ? AND ebookFile = ?", bookID, file.String).Scan(&indexed)
+	if indexed.String == version {
+		return
+	}
+
+	var pages []ebookTextPage
+	var total int
+	if p, err = blobLocalPath(filepath.ToSlash(p)); err != nil {
+		log.Printf("Index teks ebook %d: %v", bookID, err)
+		return
+	}
+	if ebookFormatOf(p) == ebookFormatEPUB {
+		pages, total, err = extractEPUBText(p)
+	} else {
+		pages, total, err = extractPDFText(p)
+	}
+	if err != nil {
+		log.Printf("Ekstraksi teks ebook %d gagal: %v", bookID, err)
+		db.Exec(`
+			INSERT INTO ebook_text_index (bookId, ebookFile, fileVersion, status, pages, error, indexedAt)
+			VALUES (?, ?, ?, ?, 0, ?, NOW())
+			ON DUPLICATE KEY UPDATE ebookFile = VALUES(ebookFile), fileVersion = VALUES(fileVersion),
+				status = VALUES(status), pages = 0, error = VALUES(error), indexedAt = NOW()`,
+			bookID, file.String, version, ebookTextFailed, truncateRunes(err.Error(), 255))
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Index teks ebook gagal:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM ebook_text_pages WHERE bookId = ?", bookID); err != nil {
+		log.Println("Index teks ebook gagal:", err)
+		return
+	}
+	stmt, err := tx.Prepare("INSERT INTO ebook_text_pages (bookId, page, href, content, terms) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		log.Println("Index teks ebook gagal:", err)
+		return
+	}
+	defer stmt.Close()
+
+	count := 0
+	for _, pg := range pages {
+		terms := analyzeText(pg.Content)
+		if len(terms) == 0 {
+			continue
+		}
+		if _, err := stmt.Exec(bookID, pg.Page, nullIfEmpty(pg.Href), pg.Content, strings.Join(terms, " ")); err != nil {
+			log.Println("Index teks ebook gagal:", err)
+			return
+		}
+		count++
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO ebook_text_index (bookId, ebookFile, fileVersion, status, pages, error, indexedAt)
+		VALUES (?, ?, ?, ?, ?, NULL, NOW())
+		ON DUPLICATE KEY UPDATE ebookFile = VALUES(ebookFile), fileVersion = VALUES(fileVersion),
+			status = VALUES(status), pages = VALUES(pages), error = NULL, indexedAt = NOW()`,
+		bookID, file.String, version, ebookTextDone, count); err != nil {
+		log.Println("Index teks ebook gagal:", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Index teks ebook gagal:", err)
+		return
+	}
+	// Jumlah halaman dipakai analitik baca untuk persentase tamat
+	db.Exec("UPDATE books SET ebookPages = ? WHERE id = ?", total, bookID)
+	log.Printf("Index teks ebook %d: %d halaman", bookID, count)
+}
+
+// Teks per halaman PDF (halaman hasil scan tanpa teks tetap kosong)
+func extractPDFText(p string) (pages []ebookTextPage, total int, err error) {
+	// Parser PDF bisa panic pada file yang rusak
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("PDF tidak bisa dibaca: %v", rec)
+		}
+	}()
+
+	f, r, err := pdf.Open(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	total = r.NumPage()
+	for i := 1; i <= total && i <= ebookTextMaxPages; i++ {
+		pg := r.Page(i)
+		if pg.V.IsNull() {
+			continue
+		}
+		text, err := pg.GetPlainText(nil)
+		if err != nil {
+			continue
+		}
+		pages = append(pages, ebookTextPage{Page: i, Content: cleanEbookText(text)})
+	}
+	return pages, total, nil
+}
+
+// Teks per dokumen spine EPUB; nomor "halaman" = urutan bab
+func extractEPUBText(p string) ([]ebookTextPage, int, error) {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer zr.Close()
+	book, err := readEPUB(&zr.Reader)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var pages []ebookTextPage
+	for i, it := range book.Spine {
+		if i >= ebookTextMaxPages {
+			break
+		}
+		data, err := readZipFile(&zr.Reader, it.Path)
+		if err != nil {
+			continue
+		}
+		pages = append(pages, ebookTextPage{Page: i + 1, Href: it.Href, Content: cleanEbookText(xhtmlPlainText(data))})
+	}
+	return pages, len(book.Spine), nil
+}
+
+// Ambil teks dari XHTML, abaikan head/script/style
+func xhtmlPlainText(data []byte) string {
+	d := lenientXMLDecoder(data)
+	var sb strings.Builder
+	skip := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "head", "script", "style":
+				skip++
+			}
+			sb.WriteByte(' ') // batas elemen blok / inline sama-sama jadi spasi
+		case xml.EndElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "head", "script", "style":
+				if skip > 0 {
+					skip--
+				}
+			}
+			sb.WriteByte(' ')
+		case xml.CharData:
+			if skip == 0 {
+				sb.Write(t)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Rapikan spasi & potong teks halaman yang terlalu panjang
+func cleanEbookText(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > ebookTextMaxPageSize {
+		s = s[:ebookTextMaxPageSize]
+		for !utf8.ValidString(s) {
+			s = s[:len(s)-1]
+		}
+	}
+	return s
+}
+
+func truncateRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// Potongan teks di sekitar kata pertama yang cocok, kata cocok dibungkus <mark>
+func ebookSnippet(content string, terms map[string]bool) string {
+	type word struct{ start, end int }
+	var words []word
+	start := -1
+	for i, r := range content {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			words = append(words, word{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, word{start, len(content)})
+	}
+	if len(words) == 0 {
+		return ""
+	}
+
+	matched := make([]bool, len(words))
+	first := -1
+	for i, w := range words {
+		lw := strings.ToLower(content[w.start:w.end])
+		if !searchStopwords[lw] && terms[stemIndonesian(lw)] {
+			matched[i] = true
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	from, to := first-12, first+18
+	if from < 0 {
+		from = 0
+	}
+	if to >= len(words) {
+		to = len(words) - 1
+	}
+
+	var sb strings.Builder
+	if from > 0 {
+		sb.WriteString("… ")
+	}
+	pos := words[from].start
+	for i := from; i <= to; i++ {
+		w := words[i]
+		sb.WriteString(html.EscapeString(content[pos:w.start]))
+		text := html.EscapeString(content[w.start:w.end])
+		if matched[i] {
+			sb.WriteString("<mark>" + text + "</mark>")
+		} else {
+			sb.WriteString(text)
+		}
+		pos = w.end
+	}
+	if to < len(words)-1 {
+		sb.WriteString(" …")
+	}
+	return sb.String()
+}
+
+// URL reader yang langsung membuka halaman / bab hit
+func ebookHitURL(bookID int, format string, page int, href, query string) string {
+	if format == ebookFormatEPUB && href != "" {
+		return fmt.Sprintf("/baca_buku?id=%d&href=%s&q=%s", bookID, url.QueryEscape(href), url.QueryEscape(query))
+	}
+	return fmt.Sprintf("/baca_buku?id=%d&page=%d&q=%s", bookID, page, url.QueryEscape(query))
+}
+
+// API Handler: cari di dalam isi ebook
+// GET /api/ebook/search?q=kata&bookId=1 (bookId opsional: cari di satu buku)
+func ebookSearchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user := getCurrentUser(r)
+	if user.ID == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "User belum login"})
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	terms := make(map[string]bool)
+	var boolean []string
+	for _, t := range analyzeText(query) {
+		if !terms[t] {
+			terms[t] = true
+			boolean = append(boolean, "+"+t)
+		}
+	}
+	if len(boolean) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Kata kunci pencarian kosong"})
+		return
+	}
+	against := strings.Join(boolean, " ")
+
+	where := "MATCH(p.terms) AGAINST(? IN BOOLEAN MODE)"
+	args := []interface{}{against, against}
+	if v := r.URL.Query().Get("bookId"); v != "" {
+		bookID, err := strconv.Atoi(v)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "bookId tidak valid"})
+			return
+		}
+		where += " AND p.bookId = ?"
+		args = append(args, bookID)
+	}
+	// Sama dengan ebookEntitlement: ebook pinjaman / berlisensi hanya untuk peminjam aktif.
+	// Disaring di query supaya LIMIT tidak habis oleh buku yang tidak boleh dibaca.
+	if user.Role != "admin" {
+		where += ` AND p.bookId IN (SELECT b.id FROM books b WHERE (b.ebookAccess <> ? AND b.ebookLicenses <= 0)
+			OR EXISTS(SELECT 1 FROM ebook_loans l WHERE l.bookId = b.id AND l.userId = ? AND l.status = ? AND l.dueAt > NOW()))`
+		args = append(args, ebookAccessLoan, user.ID, ebookLoanActive)
+	}
+	args = append(args, ebookSearchMaxRows)
+
+	rows, err := db.Query(`
+		SELECT p.bookId, p.page, p.href, p.content, MATCH(p.terms) AGAINST(? IN BOOLEAN MODE) AS score
+		FROM ebook_text_pages p
+		WHERE `+where+`
+		ORDER BY score DESC, p.bookId, p.page
+		LIMIT ?`, args...)
+	if err != nil {
+		log.Println("Pencarian isi ebook gagal:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Pencarian gagal"})
+		return
+	}
+	defer rows.Close()
+
+	byBook := make(map[int]*EbookSearchResult)
+	var order []*EbookSearchResult
+	for rows.Next() {
+		var bookID, page int
+		var href sql.NullString
+		var content string
+		var score float64
+		if err := rows.Scan(&bookID, &page, &href, &content, &score); err != nil {
+			continue
+		}
+		res, ok := byBook[bookID]
+		if !ok {
+			res = &EbookSearchResult{BookID: bookID, Hits: []EbookSearchHit{}}
+			byBook[bookID] = res
+			order = append(order, res)
+		}
+		res.TotalHits++
+		res.score += score
+		if len(res.Hits) < ebookSearchHitsPerBook {
+			res.Hits = append(res.Hits, EbookSearchHit{Page: page, Href: href.String, Snippet: ebookSnippet(content, terms)})
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return order[i].score > order[j].score })
+	if len(order) > ebookSearchMaxBooks {
+		order = order[:ebookSearchMaxBooks]
+	}
+
+	results := make([]*EbookSearchResult, 0, len(order))
+	for _, res := range order {
+		// Cuplikan isi hanya untuk yang berhak membaca ebook-nya
+		if _, status, _ := ebookEntitlement(user.ID, user.Role, res.BookID); status != 0 {
+			continue
+		}
+		var author, cover, format sql.NullString
+		err := db.QueryRow("SELECT title, author, coverFile, ebookFormat FROM books WHERE id = ?", res.BookID).
+			Scan(&res.Title, &author, &cover, &format)
+		if err != nil {
+			continue
+		}
+		res.Author, res.CoverFile, res.Format = author.String, cover.String, format.String
+		sort.Slice(res.Hits, func(a, b int) bool { return res.Hits[a].Page < res.Hits[b].Page })
+		for i := range res.Hits {
+			h := &res.Hits[i]
+			h.URL = ebookHitURL(res.BookID, res.Format, h.Page, h.Href, query)
+		}
+		results = append(results, res)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"query":   query,
+		"results": results,
+	})
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ==========================================
+// DUKUNGAN EPUB
+// Upload ebook divalidasi (PDF atau EPUB), EPUB dibaca metadata-nya
+// (judul, penulis, sampul, daftar isi) dari OPF + nav/NCX. Format & daftar
+// isi disimpan di books.ebookFormat / books.ebookToc; reader EPUB memakai
+// alur /baca_buku yang sama dan menyimpan posisi baca sebagai EPUB CFI.
+// ==========================================
+
+const (
+	ebookFormatPDF  = "pdf"
+	ebookFormatEPUB = "epub"
+
+	epubMaxXMLSize = 4 << 20 // batas baca OPF / nav / NCX
+)
+
+type epubTOCEntry struct {
+	Title    string         `json:"title"`
+	Href     string         `json:"href"` // relatif terhadap folder OPF (sama seperti href spine di epub.js)
+	Children []epubTOCEntry `json:"children,omitempty"`
+}
+
+type epubBook struct {
+	Title       string
+	Authors     []string
+	Language    string
+	Publisher   string
+	Description string
+	Identifier  string
+	CoverPath   string // path di dalam zip
+	TOC         []epubTOCEntry
+	Spine       []epubSpineItem
+}
+
+// Dokumen konten sesuai urutan baca
+type epubSpineItem struct {
+	Path string // path di dalam zip
+	Href string // relatif terhadap folder OPF
+}
+
+// --- Struktur XML ---
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubManifestItem struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+type epubOPF struct {
+	Metadata struct {
+		Titles      []string `xml:"title"`
+		Creators    []string `xml:"creator"`
+		Language    string   `xml:"language"`
+		Publisher   string   `xml:"publisher"`
+		Description string   `xml:"description"`
+		Identifier  string   `xml:"identifier"`
+		Meta        []struct {
+			Name    string `xml:"name,attr"`
+			Content string `xml:"content,attr"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest []epubManifestItem `xml:"manifest>item"`
+	Spine    struct {
+		Toc      string `xml:"toc,attr"`
+		ItemRefs []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+type epubNCXPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	Children []epubNCXPoint `xml:"navPoint"`
+}
+
+type epubNavList struct {
+	Items []epubNavItem `xml:"li"`
+}
+
+type epubNavItem struct {
+	Link epubNavLink  `xml:"a"`
+	Span xmlText      `xml:"span"`
+	List *epubNavList `xml:"ol"`
+}
+
+type epubNavLink struct {
+	Href string
+	Text xmlText
+}
+
+func (l *epubNavLink) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, a := range start.Attr {
+		if a.Name.Local == "href" {
+			l.Href = a.Value
+		}
+	}
+	return l.Text.UnmarshalXML(d, start)
+}
+
+// Teks gabungan semua node di dalam elemen (mis. <a><span>Bab</span> 1</a>)
+type xmlText string
+
+func (t *xmlText) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var sb strings.Builder
+	depth := 1
+	for depth > 0 {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch v := tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			sb.Write(v)
+		}
+	}
+	*t = xmlText(strings.Join(strings.Fields(sb.String()), " "))
+	return nil
+}
+
+// --- Parsing ---
+
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			data, err := io.ReadAll(io.LimitReader(rc, epubMaxXMLSize+1))
+			if err != nil {
+				return nil, err
+			}
+			if len(data) > epubMaxXMLSize {
+				return nil, fmt.Errorf("%s terlalu besar", name)
+			}
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("%s tidak ada", name)
+}
+
+// Decoder toleran untuk XHTML (entity HTML, tag tidak tertutup)
+func lenientXMLDecoder(data []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	return d
+}
+
+// Href relatif terhadap dokumen base -> path di zip (tanpa fragment)
+func resolveEPUBPath(base, href string) string {
+	href = strings.SplitN(href, "#", 2)[0]
+	if u, err := url.PathUnescape(href); err == nil {
+		href = u
+	}
+	return path.Clean(path.Join(path.Dir(base), href))
+}
+
+// Href untuk reader: relatif ke folder OPF, fragment dipertahankan
+func epubReaderHref(opfPath, docPath, href string) string {
+	frag := ""
+	if i := strings.Index(href, "#"); i >= 0 {
+		href, frag = href[:i], href[i:]
+	}
+	full := docPath
+	if href != "" {
+		full = resolveEPUBPath(docPath, href)
+	}
+	if dir := path.Dir(opfPath); dir != "." {
+		full = strings.TrimPrefix(full, dir+"/")
+	}
+	return full + frag
+}
+
+// Validasi struktur EPUB & ambil metadata
+func readEPUB(zr *zip.Reader) (*epubBook, error) {
+	// OCF: entry pertama harus "mimetype" berisi application/epub+zip
+	if len(zr.File) == 0 || zr.File[0].Name != "mimetype" {
+		return nil, errors.New("file mimetype tidak ditemukan di awal arsip")
+	}
+	mt, err := readZipFile(zr, "mimetype")
+	if err != nil || strings.TrimSpace(string(mt)) != "application/epub+zip" {
+		return nil, errors.New("mimetype bukan application/epub+zip")
+	}
+
+	data, err := readZipFile(zr, "META-INF/container.xml")
+	if err != nil {
+		return nil, errors.New("META-INF/container.xml tidak ditemukan")
+	}
+	var container epubContainer
+	if err := xml.Unmarshal(data, &container); err != nil || len(container.Rootfiles) == 0 {
+		return nil, errors.New("container.xml tidak valid")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+
+	data, err = readZipFile(zr, opfPath)
+	if err != nil {
+		return nil, errors.New("package OPF tidak ditemukan")
+	}
+	var opf epubOPF
+	if err := lenientXMLDecoder(data).Decode(&opf); err != nil {
+		return nil, fmt.Errorf("package OPF tidak valid: %v", err)
+	}
+	if len(opf.Spine.ItemRefs) == 0 {
+		return nil, errors.New("spine EPUB kosong")
+	}
+
+	book := &epubBook{
+		Language:    strings.TrimSpace(opf.Metadata.Language),
+		Publisher:   strings.TrimSpace(opf.Metadata.Publisher),
+		Description: strings.TrimSpace(opf.Metadata.Description),
+		Identifier:  strings.TrimSpace(opf.Metadata.Identifier),
+	}
+	if len(opf.Metadata.Titles) > 0 {
+		book.Title = strings.TrimSpace(opf.Metadata.Titles[0])
+	}
+	for _, c := range opf.Metadata.Creators {
+		if c = strings.TrimSpace(c); c != "" {
+			book.Authors = append(book.Authors, c)
+		}
+	}
+
+	byID := make(map[string]epubManifestItem)
+	var navItem, coverItem *epubManifestItem
+	for i := range opf.Manifest {
+		it := &opf.Manifest[i]
+		byID[it.ID] = *it
+		props := " " + it.Properties + " "
+		if strings.Contains(props, " nav ") {
+			navItem = it
+		}
+		if strings.Contains(props, " cover-image ") {
+			coverItem = it
+		}
+	}
+
+	for _, ref := range opf.Spine.ItemRefs {
+		if it, ok := byID[ref.IDRef]; ok {
+			book.Spine = append(book.Spine, epubSpineItem{Path: resolveEPUBPath(opfPath, it.Href), Href: it.Href})
+		}
+	}
+
+	// Sampul: EPUB3 properties="cover-image", EPUB2 <meta name="cover" content="id">
+	if coverItem == nil {
+		for _, m := range opf.Metadata.Meta {
+			if m.Name == "cover" {
+				if it, ok := byID[m.Content]; ok && strings.HasPrefix(it.MediaType, "image/") {
+					coverItem = &it
+				}
+			}
+		}
+	}
+	if coverItem != nil {
+		book.CoverPath = resolveEPUBPath(opfPath, coverItem.Href)
+	}
+
+	// Daftar isi: nav EPUB3, fallback NCX EPUB2
+	if navItem != nil {
+		navPath := resolveEPUBPath(opfPath, navItem.Href)
+		if data, err := readZipFile(zr, navPath); err == nil {
+			book.TOC = parseEPUBNav(data, opfPath, navPath)
+		}
+	}
+	if len(book.TOC) == 0 {
+		if it, ok := byID[opf.Spine.Toc]; ok {
+			ncxPath := resolveEPUBPath(opfPath, it.Href)
+			if data, err := readZipFile(zr, ncxPath); err == nil {
+				book.TOC = parseEPUBNCX(data, opfPath, ncxPath)
+			}
+		}
+	}
+	return book, nil
+}
+
+// Cari <nav epub:type="toc"> lalu baca <ol> di dalamnya
+func parseEPUBNav(data []byte, opfPath, navPath string) []epubTOCEntry {
+	d := lenientXMLDecoder(data)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "nav" {
+			continue
+		}
+		isTOC := false
+		for _, a := range start.Attr {
+			if a.Name.Local == "type" && strings.Contains(" "+a.Value+" ", " toc ") {
+				isTOC = true
+			}
+		}
+		if !isTOC {
+			continue
+		}
+		var nav struct {
+			List epubNavList `xml:"ol"`
+		}
+		if err := d.DecodeElement(&nav, &start); err != nil {
+			return nil
+		}
+		return convertEPUBNav(nav.List, opfPath, navPath)
+	}
+}
+
+func convertEPUBNav(list epubNavList, opfPath, navPath string) []epubTOCEntry {
+	var out []epubTOCEntry
+	for _, li := range list.Items {
+		e := epubTOCEntry{Title: string(li.Link.Text)}
+		if li.Link.Href != "" {
+			e.Href = epubReaderHref(opfPath, navPath, li.Link.Href)
+		}
+		if e.Title == "" {
+			e.Title = string(li.Span)
+		}
+		if li.List != nil {
+			e.Children = convertEPUBNav(*li.List, opfPath, navPath)
+		}
+		if e.Title != "" || len(e.Children) > 0 {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func parseEPUBNCX(data []byte, opfPath, ncxPath string) []epubTOCEntry {
+	var ncx struct {
+		Points []epubNCXPoint `xml:"navMap>navPoint"`
+	}
+	if err := lenientXMLDecoder(data).Decode(&ncx); err != nil {
+		return nil
+	}
+	return convertEPUBNCX(ncx.Points, opfPath, ncxPath)
+}
+
+func convertEPUBNCX(points []epubNCXPoint, opfPath, ncxPath string) []epubTOCEntry {
+	var out []epubTOCEntry
+	for _, p := range points {
+		e := epubTOCEntry{Title: strings.Join(strings.Fields(p.Label), " ")}
+		if p.Content.Src != "" {
+			e.Href = epubReaderHref(opfPath, ncxPath, p.Content.Src)
+		}
+		e.Children = convertEPUBNCX(p.Children, opfPath, ncxPath)
+		out = append(out, e)
+	}
+	return out
+}
+
+// Format ebook dari ekstensi file
+func ebookFormatOf(file string) string {
+	if strings.EqualFold(path.Ext(file), ".epub") {
+		return ebookFormatEPUB
+	}
+	return ebookFormatPDF
+}
+
+// Validasi file ebook yang diupload admin. Jenis dari isi file, bukan
+// ekstensinya; EPUB dikembalikan beserta metadatanya.
+func inspectEbookUpload(f multipart.File, h *multipart.FileHeader) (string, *epubBook, error) {
+	defer f.Seek(0, io.SeekStart)
+
+	head := make([]byte, 1024)
+	n, _ := io.ReadFull(f, head)
+	switch sniffUploadType(head[:n]) {
+	case mimePDF:
+		return ebookFormatPDF, nil, nil
+	case mimeEPUB:
+		zr, err := zip.NewReader(f, h.Size)
+		if err != nil {
+			return "", nil, errors.New("file EPUB rusak (bukan arsip zip)")
+		}
+		book, err := readEPUB(zr)
+		if err != nil {
+			return "", nil, fmt.Errorf("EPUB tidak valid: %v", err)
+		}
+		return ebookFormatEPUB, book, nil
+	}
+	return "", nil, errors.New("ebook harus berformat PDF atau EPUB")
+}
+
+// Simpan format & daftar isi; untuk EPUB pakai sampulnya jika buku belum punya sampul
+func applyEbookMetadata(bookID int, ebookPath string) {
+	format := ebookFormatOf(ebookPath)
+	if format != ebookFormatEPUB {
+		if _, err := db.Exec("UPDATE books SET ebookFormat = ?, ebookToc = NULL WHERE id = ?", format, bookID); err != nil {
+			log.Println("Gagal menyimpan format ebook:", err)
+		}
+		return
+	}
+
+	local, err := blobLocalPath(ebookPath)
+	if err != nil {
+		log.Printf("EPUB buku %d tidak bisa dibuka: %v", bookID, err)
+		return
+	}
+	zr, err := zip.OpenReader(local)
+	if err != nil {
+		log.Printf("EPUB buku %d tidak bisa dibuka: %v", bookID, err)
+		return
+	}
+	defer zr.Close()
+	book, err := readEPUB(&zr.Reader)
+	if err != nil {
+		log.Printf("EPUB buku %d tidak valid: %v", bookID, err)
+		return
+	}
+
+	toc, _ := json.Marshal(book.TOC)
+	if _, err := db.Exec("UPDATE books SET ebookFormat = ?, ebookToc = ? WHERE id = ?", format, string(toc), bookID); err != nil {
+		log.Println("Gagal menyimpan metadata EPUB:", err)
+	}
+
+	var cover sql.NullString
+	db.QueryRow("SELECT coverFile FROM books WHERE id = ?", bookID).Scan(&cover)
+	if book.CoverPath != "" && (cover.String == "" || strings.HasSuffix(cover.String, "default_cover.jpg")) {
+		if p, err := extractEPUBCover(&zr.Reader, book.CoverPath); err == nil {
+			db.Exec("UPDATE books SET coverFile = ? WHERE id = ?", p, bookID)
+			queueCoverProcessing(p)
+		} else {
+			log.Printf("Sampul EPUB buku %d gagal diambil: %v", bookID, err)
+		}
+	}
+}
+
+func extractEPUBCover(zr *zip.Reader, coverPath string) (string, error) {
+	for _, f := range zr.File {
+		if f.Name != coverPath {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		// Lewat layanan upload: jenis & ukuran dicek sama seperti sampul upload admin
+		up, err := storeUpload(uploadKindCover, rc)
+		if err != nil {
+			return "", err
+		}
+		return up.Path, nil
+	}
+	return "", errors.New("file sampul tidak ada di arsip")
+}
+
+// Migrasi: isi ebookFormat (dan daftar isi EPUB) untuk ebook lama
+func migrateEbookFormats() {
+	rows, err := db.Query("SELECT id, ebookFile FROM books WHERE ebookFile IS NOT NULL AND ebookFile <> '' AND ebookFormat IS NULL")
+	if err != nil {
+		log.Println("Migrasi format ebook gagal:", err)
+		return
+	}
+	type pending struct {
+		id   int
+		file string
+	}
+	var list []pending
+	for rows.Next() {
+		var p pending
+		if rows.Scan(&p.id, &p.file) == nil {
+			list = append(list, p)
+		}
+	}
+	rows.Close()
+
+	for _, p := range list {
+		applyEbookMetadata(p.id, p.file)
+	}
+	if len(list) > 0 {
+		log.Printf("Migrasi format ebook: %d buku diproses", len(list))
+	}
+}
+
+// API Handler: format & daftar isi ebook
+// GET /api/ebook/toc?bookId=1
+func ebookTOCHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	bookID, err := strconv.Atoi(r.URL.Query().Get("bookId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "bookId tidak valid"})
+		return
+	}
+
+	var format, toc sql.NullString
+	err = db.QueryRow("SELECT ebookFormat, ebookToc FROM books WHERE id = ? AND ebookFile IS NOT NULL AND ebookFile <> ''", bookID).Scan(&format, &toc)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Ebook tidak ditemukan"})
+		return
+	}
+
+	entries := []epubTOCEntry{}
+	if toc.String != "" {
+		json.Unmarshal([]byte(toc.String), &entries)
+	}
+	if format.String == "" {
+		format.String = ebookFormatPDF
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bookId": bookID,
+		"format": format.String,
+		"toc":    entries,
+	})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// EXPORT KATALOG (CSV, JSON Lines, MARC21, MARCXML)
+// ==========================================
+
+// Data lengkap satu buku untuk kebutuhan export / interoperabilitas
+type catalogBook struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	Author      string    `json:"author"`
+	ISBN        string    `json:"isbn"`
+	Publisher   string    `json:"publisher"`
+	Year        int       `json:"year"`
+	Genre       string    `json:"genre"`
+	Category    string    `json:"category"`
+	Type        string    `json:"type"`
+	Location    string    `json:"location"`
+	StockMax    int       `json:"stock"`
+	FineAmount  int       `json:"fineAmount"`
+	Description string    `json:"description"`
+	CoverFile   string    `json:"coverFile"`
+	EbookFile   string    `json:"ebookFile"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Kolom SELECT yang harus dipakai bersama scanCatalogBook
+const catalogBookColumns = `id, title, author, isbn, publisher, year, genre, category, type, location,
+	stockMax, fineAmount, description, coverFile, ebookFile, created_at, updated_at`
+
+func scanCatalogBook(rows *sql.Rows) (catalogBook, error) {
+	var b catalogBook
+	var year, stockMax, fineAmount sql.NullInt64
+	var title, author, isbn, publisher, genre, category, tipe, location, description, coverFile, ebookFile sql.NullString
+	var createdAt, updatedAt sql.NullTime
+
+	err := rows.Scan(&b.ID, &title, &author, &isbn, &publisher, &year, &genre, &category, &tipe, &location,
+		&stockMax, &fineAmount, &description, &coverFile, &ebookFile, &createdAt, &updatedAt)
+	if err != nil {
+		return b, err
+	}
+
+	b.Title = title.String
+	b.Author = author.String
+	b.ISBN = isbn.String
+	b.Publisher = publisher.String
+	b.Year = int(year.Int64)
+	b.Genre = genre.String
+	b.Category = category.String
+	b.Type = tipe.String
+	b.Location = location.String
+	b.StockMax = int(stockMax.Int64)
+	b.FineAmount = int(fineAmount.Int64)
+	b.Description = description.String
+	b.CoverFile = coverFile.String
+	b.EbookFile = ebookFile.String
+	b.CreatedAt = createdAt.Time
+	b.UpdatedAt = updatedAt.Time
+	if b.UpdatedAt.IsZero() {
+		b.UpdatedAt = b.CreatedAt
+	}
+	return b, nil
+}
+
+// Handler export katalog, filter sama dengan /books
+// GET /books/export?format=csv|jsonl|marc|marcxml&search=&type=&category=&genre=
+func exportBooksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "csv"
+	}
+
+	var contentType, ext string
+	switch format {
+	case "csv":
+		contentType, ext = "text/csv; charset=utf-8", "csv"
+	case "jsonl", "ndjson":
+		contentType, ext = "application/x-ndjson", "jsonl"
+	case "marc", "mrc", "marc21":
+		contentType, ext = "application/marc", "mrc"
+	case "marcxml", "xml":
+		contentType, ext = "application/marcxml+xml", "xml"
+	default:
+		http.Error(w, "Format tidak didukung (csv, jsonl, marc, marcxml)", http.StatusBadRequest)
+		return
+	}
+
+	query := "SELECT " + catalogBookColumns + " FROM books b"
+	conditions, args := buildBookFilters(r.URL.Query())
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println("Export query error:", err)
+		http.Error(w, "Gagal mengambil data buku", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="katalog_libra_`+time.Now().Format("20060102")+`.`+ext+`"`)
+
+	flusher, _ := w.(http.Flusher)
+	var csvWriter *csv.Writer
+	jsonEnc := json.NewEncoder(w)
+
+	// Header / pembuka dokumen
+	switch ext {
+	case "csv":
+		csvWriter = csv.NewWriter(w)
+		csvWriter.Write([]string{"id", "title", "author", "isbn", "publisher", "year", "genre", "category",
+			"type", "location", "stockMax", "fineAmount", "description", "created_at"})
+	case "xml":
+		io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<collection xmlns="`+marcXMLNamespace+`">`+"\n")
+	}
+
+	base := requestBaseURL(r)
+	count := 0
+	for rows.Next() {
+		b, err := scanCatalogBook(rows)
+		if err != nil {
+			log.Println("Export scan error:", err)
+			continue
+		}
+
+		switch ext {
+		case "csv":
+			err = csvWriter.Write([]string{
+				strconv.Itoa(b.ID), b.Title, b.Author, b.ISBN, b.Publisher, strconv.Itoa(b.Year), b.Genre, b.Category,
+				b.Type, b.Location, strconv.Itoa(b.StockMax), strconv.Itoa(b.FineAmount), b.Description,
+				b.CreatedAt.Format("2006-01-02 15:04:05"),
+			})
+		case "jsonl":
+			err = jsonEnc.Encode(b)
+		case "mrc":
+			err = writeMARC21(w, bookToMARC(b, base))
+		case "xml":
+			err = writeMARCXMLRecord(w, bookToMARC(b, base))
+		}
+		if err != nil {
+			// Client putus di tengah jalan, hentikan streaming
+			log.Println("Export write error:", err)
+			return
+		}
+
+		// Kirim ke client bertahap supaya katalog besar tidak ditahan di memori
+		count++
+		if count%100 == 0 {
+			if csvWriter != nil {
+				csvWriter.Flush()
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	// Penutup dokumen
+	switch ext {
+	case "csv":
+		csvWriter.Flush()
+	case "xml":
+		io.WriteString(w, "</collection>\n")
+	}
+}
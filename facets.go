@@ -0,0 +1,210 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ==========================================
+// FACET COUNT UNTUK /books (type, category, genre, year)
+// Tiap facet dihitung dengan semua filter aktif KECUALI filter facet itu
+// sendiri, supaya pilihan lain di facet yang sama tetap terlihat jumlahnya.
+// ==========================================
+
+var bookFacetNames = []string{"type", "category", "genre", "year"}
+
+// Parameter query yang "dimiliki" tiap facet
+var bookFacetParams = map[string][]string{
+	"type":     {"type"},
+	"category": {"category"},
+	"genre":    {"genre"},
+	"year":     {"yearFrom", "yearTo"},
+}
+
+type facetValue struct {
+	Value    string `json:"value"`
+	Count    int    `json:"count"`
+	Selected bool   `json:"selected,omitempty"`
+}
+
+type yearBucket struct {
+	Label string `json:"label"`
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Count int    `json:"count"`
+}
+
+// ?facets=true|all atau daftar dipisah koma: facets=type,genre
+func parseBookFacets(v string) ([]string, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	switch v {
+	case "", "0", "false":
+		return nil, nil
+	case "1", "true", "all":
+		return bookFacetNames, nil
+	}
+
+	var out []string
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if _, ok := bookFacetParams[f]; !ok {
+			return nil, fmt.Errorf("facet tidak dikenal: %s", f)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// Hitung facet. q adalah filter tanpa search; kondisi search (hasil index
+// full-text) dikirim lewat extraConds/extraArgs karena berlaku untuk semua facet.
+func computeBookFacets(q url.Values, extraConds []string, extraArgs []interface{}, names []string) (map[string]interface{}, error) {
+	facets := make(map[string]interface{})
+
+	for _, name := range names {
+		fq := url.Values{}
+		for k, v := range q {
+			fq[k] = v
+		}
+		for _, p := range bookFacetParams[name] {
+			fq.Del(p)
+		}
+
+		conditions, args := buildBookFilters(fq)
+		conditions = append(conditions, extraConds...)
+		args = append(args, extraArgs...)
+		where := ""
+		if len(conditions) > 0 {
+			where = " WHERE " + strings.Join(conditions, " AND ")
+		}
+
+		var result interface{}
+		var err error
+		switch name {
+		case "type":
+			result, err = typeFacet(where, args, q.Get("type"))
+		case "category":
+			result, err = categoryFacet(where, args, q.Get("category"))
+		case "genre":
+			result, err = genreFacet(where, args, q["genre"])
+		case "year":
+			result, err = yearFacet(where, args)
+		}
+		if err != nil {
+			return nil, err
+		}
+		facets[name] = result
+	}
+	return facets, nil
+}
+
+// Jumlah mengikuti aturan filter type: "Buku Fisik" dan "Ebook"
+// sama-sama ikut menghitung buku "Fisik & Ebook".
+func typeFacet(where string, args []interface{}, selected string) ([]facetValue, error) {
+	var fisik, ebook, keduanya sql.NullInt64
+	err := db.QueryRow(`
+		SELECT SUM(b.type IN ('Buku Fisik', 'Fisik & Ebook')),
+		       SUM(b.type IN ('Ebook', 'Fisik & Ebook')),
+		       SUM(b.type = 'Fisik & Ebook')
+		FROM books b`+where, args...).Scan(&fisik, &ebook, &keduanya)
+	if err != nil {
+		return nil, err
+	}
+	return []facetValue{
+		{Value: "Buku Fisik", Count: int(fisik.Int64), Selected: selected == "Buku Fisik"},
+		{Value: "Ebook", Count: int(ebook.Int64), Selected: selected == "Ebook"},
+		{Value: "Fisik & Ebook", Count: int(keduanya.Int64), Selected: selected == "Fisik & Ebook"},
+	}, nil
+}
+
+func categoryFacet(where string, args []interface{}, selected string) ([]facetValue, error) {
+	cond := " WHERE b.category IS NOT NULL AND b.category <> ''"
+	if where != "" {
+		cond = where + " AND b.category IS NOT NULL AND b.category <> ''"
+	}
+	rows, err := db.Query("SELECT b.category, COUNT(*) FROM books b"+cond+" GROUP BY b.category ORDER BY COUNT(*) DESC, b.category", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []facetValue{}
+	for rows.Next() {
+		var v facetValue
+		if err := rows.Scan(&v.Value, &v.Count); err != nil {
+			return nil, err
+		}
+		v.Selected = v.Value == selected
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// Dihitung dari book_genres supaya tiap tag berdiri sendiri
+func genreFacet(where string, args []interface{}, selected []string) ([]facetValue, error) {
+	rows, err := db.Query(`
+		SELECT x.name, x.slug, COUNT(*)
+		FROM book_genres l JOIN genres x ON x.id = l.genre_id
+		WHERE l.book_id IN (SELECT b.id FROM books b`+where+`)
+		GROUP BY x.id, x.name, x.slug
+		ORDER BY COUNT(*) DESC, x.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	isSelected := make(map[string]bool)
+	for _, g := range selected {
+		isSelected[slugify(g)] = true
+	}
+
+	out := []facetValue{}
+	for rows.Next() {
+		var v facetValue
+		var slug string
+		if err := rows.Scan(&v.Value, &slug, &v.Count); err != nil {
+			return nil, err
+		}
+		v.Selected = isSelected[slug]
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// Per tahun dan per dekade; buku tanpa tahun tidak dihitung
+func yearFacet(where string, args []interface{}) (map[string]interface{}, error) {
+	cond := " WHERE b.year > 0"
+	if where != "" {
+		cond = where + " AND b.year > 0"
+	}
+	rows, err := db.Query("SELECT b.year, COUNT(*) FROM books b"+cond+" GROUP BY b.year ORDER BY b.year DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	years := []facetValue{}
+	decades := []yearBucket{}
+	for rows.Next() {
+		var year, count int
+		if err := rows.Scan(&year, &count); err != nil {
+			return nil, err
+		}
+		years = append(years, facetValue{Value: fmt.Sprint(year), Count: count})
+
+		from := year / 10 * 10
+		if n := len(decades); n > 0 && decades[n-1].From == from {
+			decades[n-1].Count += count
+			continue
+		}
+		decades = append(decades, yearBucket{Label: fmt.Sprintf("%d-an", from), From: from, To: from + 9, Count: count})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"years": years, "decades": decades}, nil
+}
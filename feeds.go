@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// FEED POPULER / TRENDING / KOLEKSI BARU
+// GET /api/feeds/{kind}[.json|.atom|.rss]?limit=20
+//
+//	popular          paling banyak dipinjam (sepanjang waktu)
+//	trending         paling banyak dipinjam 30 hari terakhir
+//	most-read        ebook paling banyak dibaca (jumlah pembaca unik, ebook_history)
+//	most-bookmarked  paling banyak disimpan di rak baca member
+//	new              koleksi terbaru (books.created_at)
+//
+// Format juga bisa lewat ?format=json|atom|rss. Feed ini publik agar bisa
+// ditanam di website perpustakaan / layar pengumuman.
+// ==========================================
+
+const (
+	feedDefaultLimit = 20
+	feedMaxLimit     = 100
+	feedTrendingDays = 30
+)
+
+type bookFeedKind struct {
+	Title string
+	// Query mengembalikan (book_id, score) urut dari yang teratas; kosong = urut created_at
+	RankQuery string
+	Unit      string
+}
+
+var bookFeedKinds = map[string]bookFeedKind{
+	"popular": {
+		Title: "Buku Paling Banyak Dipinjam",
+		RankQuery: `SELECT book_id, COUNT(*) AS score FROM transactions
+			WHERE status IN ('DIPINJAM', 'DIKEMBALIKAN', 'HILANG')
+			GROUP BY book_id ORDER BY score DESC, book_id LIMIT ?`,
+		Unit: "kali dipinjam",
+	},
+	"trending": {
+		Title: "Sedang Tren (30 Hari Terakhir)",
+		RankQuery: `SELECT book_id, COUNT(*) AS score FROM transactions
+			WHERE status IN ('DIPINJAM', 'DIKEMBALIKAN', 'HILANG')
+			  AND COALESCE(dateBorrowed, dateRequested) >= NOW() - INTERVAL ` + strconv.Itoa(feedTrendingDays) + ` DAY
+			GROUP BY book_id ORDER BY score DESC, book_id LIMIT ?`,
+		Unit: "kali dipinjam bulan ini",
+	},
+	"most-read": {
+		Title: "Ebook Paling Banyak Dibaca",
+		RankQuery: `SELECT bookId, COUNT(DISTINCT userId) AS score FROM ebook_history
+			GROUP BY bookId ORDER BY score DESC, bookId LIMIT ?`,
+		Unit: "pembaca",
+	},
+	"most-bookmarked": {
+		Title: "Paling Banyak Di-bookmark",
+		RankQuery: `SELECT i.bookId, COUNT(DISTINCT s.userId) AS score
+			FROM shelf_items i JOIN shelves s ON s.id = i.shelfId
+			GROUP BY i.bookId ORDER BY score DESC, i.bookId LIMIT ?`,
+		Unit: "bookmark",
+	},
+	"new": {
+		Title: "Koleksi Terbaru",
+	},
+}
+
+type feedItem struct {
+	catalogBook
+	Rank  int `json:"rank"`
+	Score int `json:"score,omitempty"`
+}
+
+// scheme://host dari request (menghormati reverse proxy HTTPS)
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func bookFeedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/feeds"), "/")
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if i := strings.LastIndex(name, "."); i > 0 {
+		name, format = name[:i], name[i+1:]
+	}
+	if format == "" {
+		format = "json"
+	}
+
+	if name == "" {
+		// Daftar feed yang tersedia
+		w.Header().Set("Content-Type", "application/json")
+		list := make(map[string]string, len(bookFeedKinds))
+		for k, v := range bookFeedKinds {
+			list[k] = v.Title
+		}
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	kind, ok := bookFeedKinds[name]
+	if !ok {
+		http.Error(w, "Feed tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if format != "json" && format != "atom" && format != "rss" {
+		http.Error(w, "Format tidak didukung (json, atom, rss)", http.StatusBadRequest)
+		return
+	}
+
+	limit := feedDefaultLimit
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	if limit > feedMaxLimit {
+		limit = feedMaxLimit
+	}
+
+	items, err := loadBookFeed(kind, limit)
+	if err != nil {
+		log.Println("Feed error:", err)
+		http.Error(w, "Gagal mengambil feed", http.StatusInternalServerError)
+		return
+	}
+
+	// Feed boleh di-cache sebentar oleh browser / proxy
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	base := requestBaseURL(r)
+	self := base + "/api/feeds/" + name + "." + format
+	switch format {
+	case "atom":
+		writeBookFeedAtom(w, base, self, name, kind, items)
+	case "rss":
+		writeBookFeedRSS(w, base, self, kind, items)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"feed":      name,
+			"title":     kind.Title,
+			"unit":      kind.Unit,
+			"generated": time.Now(),
+			"books":     items,
+		})
+	}
+}
+
+func loadBookFeed(kind bookFeedKind, limit int) ([]feedItem, error) {
+	if kind.RankQuery == "" {
+		rows, err := db.Query("SELECT "+catalogBookColumns+" FROM books ORDER BY created_at DESC, id DESC LIMIT ?", limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		items := []feedItem{}
+		for rows.Next() {
+			b, err := scanCatalogBook(rows)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, feedItem{catalogBook: b, Rank: len(items) + 1})
+		}
+		return items, rows.Err()
+	}
+
+	// 1. Peringkat
+	rows, err := db.Query(kind.RankQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	scores := make(map[int]int)
+	for rows.Next() {
+		var id, score int
+		if err := rows.Scan(&id, &score); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+		scores[id] = score
+	}
+	rows.Close()
+
+	items := []feedItem{}
+	if len(ids) == 0 {
+		return items, nil
+	}
+
+	// 2. Detail buku, disusun ulang sesuai peringkat
+	in, args := intInClause(ids)
+	rows, err = db.Query("SELECT "+catalogBookColumns+" FROM books WHERE id IN "+in, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int]catalogBook)
+	for rows.Next() {
+		b, err := scanCatalogBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		byID[b.ID] = b
+	}
+	for _, id := range ids {
+		if b, ok := byID[id]; ok {
+			items = append(items, feedItem{catalogBook: b, Rank: len(items) + 1, Score: scores[id]})
+		}
+	}
+	return items, rows.Err()
+}
+
+func feedItemLink(base string, id int) string {
+	return fmt.Sprintf("%s/member?book=%d", base, id)
+}
+
+func feedItemSummary(kind bookFeedKind, it feedItem) string {
+	if kind.Unit != "" && it.Score > 0 {
+		return fmt.Sprintf("#%d - %d %s. %s", it.Rank, it.Score, kind.Unit, it.Description)
+	}
+	return it.Description
+}
+
+// Atom 1.0 (bukan OPDS, jadi tanpa namespace dc/opds)
+type bookAtomFeed struct {
+	XMLName xml.Name        `xml:"feed"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	ID      string          `xml:"id"`
+	Title   string          `xml:"title"`
+	Updated string          `xml:"updated"`
+	Author  atomAuthor      `xml:"author"`
+	Links   []atomLink      `xml:"link"`
+	Entries []bookAtomEntry `xml:"entry"`
+}
+
+type bookAtomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomAuthor   `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+	Links      []atomLink     `xml:"link"`
+}
+
+func writeBookFeedAtom(w http.ResponseWriter, base, self, name string, kind bookFeedKind, items []feedItem) {
+	out := bookAtomFeed{
+		Xmlns:   "http://www.w3.org/2005/Atom",
+		ID:      "urn:libra:feed:" + name,
+		Title:   kind.Title,
+		Updated: time.Now().Format(time.RFC3339),
+		Author:  atomAuthor{Name: "Perpustakaan Libra"},
+		Links: []atomLink{
+			{Rel: "self", Href: self, Type: "application/atom+xml"},
+			{Rel: "alternate", Href: base + "/member", Type: "text/html"},
+		},
+	}
+
+	for _, it := range items {
+		entry := bookAtomEntry{
+			ID:      fmt.Sprintf("urn:libra:book:%d", it.ID),
+			Title:   it.Title,
+			Updated: it.UpdatedAt.Format(time.RFC3339),
+			Summary: feedItemSummary(kind, it),
+			Links:   []atomLink{{Rel: "alternate", Href: feedItemLink(base, it.ID), Type: "text/html"}},
+		}
+		if it.Author != "" {
+			entry.Authors = append(entry.Authors, atomAuthor{Name: it.Author})
+		}
+		if it.Category != "" {
+			entry.Categories = append(entry.Categories, atomCategory{Term: it.Category})
+		}
+		if it.CoverFile != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: "enclosure", Href: base + "/" + strings.TrimPrefix(it.CoverFile, "/"), Type: imageMimeType(it.CoverFile)})
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		log.Println("Atom encode error:", err)
+	}
+}
+
+// RSS 2.0
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	XmlnsAtom string     `xml:"xmlns:atom,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	AtomLink      rssSelf   `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssSelf struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	Description string        `xml:"description,omitempty"`
+	Category    string        `xml:"category,omitempty"`
+	PubDate     string        `xml:"pubDate"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int    `xml:"length,attr"`
+}
+
+func writeBookFeedRSS(w http.ResponseWriter, base, self string, kind bookFeedKind, items []feedItem) {
+	out := rssFeed{
+		Version:   "2.0",
+		XmlnsAtom: "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         kind.Title + " - Perpustakaan Libra",
+			Link:          base + "/member",
+			Description:   kind.Title,
+			Language:      "id",
+			LastBuildDate: time.Now().Format(time.RFC1123Z),
+			AtomLink:      rssSelf{Href: self, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+
+	for _, it := range items {
+		item := rssItem{
+			Title:       it.Title,
+			Link:        feedItemLink(base, it.ID),
+			GUID:        rssGUID{IsPermaLink: "false", Value: fmt.Sprintf("urn:libra:book:%d", it.ID)},
+			Description: feedItemSummary(kind, it),
+			Category:    it.Category,
+			PubDate:     it.CreatedAt.Format(time.RFC1123Z),
+		}
+		if it.Author != "" {
+			// RSS <author> wajib email, jadi nama penulis ditaruh di deskripsi
+			item.Description = "Penulis: " + it.Author + ". " + item.Description
+		}
+		if it.CoverFile != "" {
+			item.Enclosure = &rssEnclosure{URL: base + "/" + strings.TrimPrefix(it.CoverFile, "/"), Type: imageMimeType(it.CoverFile)}
+		}
+		out.Channel.Items = append(out.Channel.Items, item)
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		log.Println("RSS encode error:", err)
+	}
+}
+
+func imageMimeType(file string) string {
+	switch strings.ToLower(file[strings.LastIndex(file, ".")+1:]) {
+	case "png":
+		return "image/png"
+	case "gif":
+		return "image/gif"
+	case "webp":
+		return "image/webp"
+	default:
+		return "image/jpeg"
+	}
+}
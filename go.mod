@@ -3,13 +3,25 @@ module project
 go 1.24.0
 
 require (
+	github.com/HugoSmits86/nativewebp v0.9.3
 	github.com/go-sql-driver/mysql v1.9.3
+	github.com/ledongthuc/pdf v0.0.0-20240201131950-da5b75280b06
+	github.com/pdfcpu/pdfcpu v0.11.1
 	github.com/sendgrid/sendgrid-go v3.16.1+incompatible
 	golang.org/x/crypto v0.43.0
+	golang.org/x/image v0.32.0
 )
 
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/clipperhouse/uax29/v2 v2.2.0 // indirect
+	github.com/hhrutter/lzw v1.0.0 // indirect
+	github.com/hhrutter/pkcs7 v0.2.0 // indirect
+	github.com/hhrutter/tiff v1.0.2 // indirect
+	github.com/mattn/go-runewidth v0.0.19 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
 	github.com/sendgrid/rest v2.6.9+incompatible // indirect
 	github.com/stretchr/testify v1.11.1 // indirect
+	golang.org/x/text v0.30.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
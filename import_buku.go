@@ -0,0 +1,730 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// IMPORT KATALOG MASSAL (CSV / XLSX)
+// ==========================================
+
+// Field tujuan di tabel books yang bisa diisi lewat import
+var importFields = []string{
+	"title", "author", "isbn", "publisher", "year", "genre", "category",
+	"type", "location", "stockMax", "fineAmount", "description",
+}
+
+// Alias nama kolom (huruf kecil) -> field books.
+// Dipakai jika admin tidak mengirim mapping kolom sendiri.
+var importColumnAliases = map[string]string{
+	"title": "title", "judul": "title",
+	"author": "author", "penulis": "author", "pengarang": "author",
+	"isbn":      "isbn",
+	"publisher": "publisher", "penerbit": "publisher",
+	"year": "year", "tahun": "year", "tahun terbit": "year",
+	"genre":    "genre",
+	"category": "category", "kategori": "category",
+	"type": "type", "tipe": "type", "jenis": "type",
+	"location": "location", "lokasi": "location", "rak": "location",
+	"stockmax": "stockMax", "stock": "stockMax", "stok": "stockMax",
+	"fineamount": "fineAmount", "denda": "fineAmount", "harga": "fineAmount",
+	"description": "description", "deskripsi": "description", "sinopsis": "description",
+}
+
+// Satu baris hasil parsing file import
+type importRow struct {
+	Line   int // nomor baris di file (header = baris 1)
+	Values map[string]string
+}
+
+// Error validasi per baris
+type importRowError struct {
+	Row     int    `json:"row"`
+	Title   string `json:"title,omitempty"`
+	Kind    string `json:"kind,omitempty"` // kosong = error validasi, skipped / ambiguous untuk import MARC
+	Message string `json:"message"`
+}
+
+// Hasil dry-run per baris
+type importRowResult struct {
+	Row    int    `json:"row"`
+	Title  string `json:"title"`
+	Action string `json:"action"` // insert / update / error
+	BookID int    `json:"bookId,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Job import yang berjalan di background
+type importJob struct {
+	ID         string           `json:"id"`
+	Filename   string           `json:"filename"`
+	Status     string           `json:"status"` // berjalan / selesai / gagal
+	Total      int              `json:"total"`
+	Processed  int              `json:"processed"`
+	Inserted   int              `json:"inserted"`
+	Updated    int              `json:"updated"`
+	Failed     int              `json:"failed"`
+	Skipped    int              `json:"skipped"`
+	Errors     []importRowError `json:"errors"`
+	StartedAt  string           `json:"startedAt"`
+	FinishedAt string           `json:"finishedAt,omitempty"`
+
+	finished time.Time // untuk membuang job lama dari memori
+}
+
+var importJobs = map[string]*importJob{}
+var importJobsMu sync.Mutex
+
+// Job yang sudah selesai disimpan selama ini agar status & laporan error masih bisa diunduh
+const importJobTTL = 24 * time.Hour
+
+// Batas ukuran file import (CSV / XLSX / MARC)
+var importMaxBytes = envMegabytes("IMPORT_MAX_MB", 20)
+
+// Daftarkan job baru sekaligus buang job selesai yang melewati importJobTTL
+func registerImportJob(job *importJob) {
+	importJobsMu.Lock()
+	defer importJobsMu.Unlock()
+	for id, j := range importJobs {
+		if !j.finished.IsZero() && time.Since(j.finished) > importJobTTL {
+			delete(importJobs, id)
+		}
+	}
+	importJobs[job.ID] = job
+}
+
+// Tandai job selesai; pemanggil memegang importJobsMu
+func finishImportJob(job *importJob) {
+	job.Status = "selesai"
+	job.finished = time.Now()
+	job.FinishedAt = job.finished.Format("2006-01-02 15:04:05")
+}
+
+// 1. API Handler: Upload file import (Admin Only)
+// POST /api/admin/books/import  (multipart: file, mapping?, dryRun?)
+func bookImportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := getCurrentUser(r)
+	if user.Role != "admin" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Unauthorized"})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Method not allowed"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, importMaxBytes+1<<20)
+	if err := r.ParseMultipartForm(20 << 20); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Gagal membaca form atau file terlalu besar: " + err.Error()})
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "File import wajib diupload"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Gagal membaca file: " + err.Error()})
+		return
+	}
+
+	// Mapping kolom opsional, contoh: {"Judul Buku":"title","Nama Penulis":"author"}
+	var mapping map[string]string
+	if m := r.FormValue("mapping"); m != "" {
+		if err := json.Unmarshal([]byte(m), &mapping); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Format mapping tidak valid"})
+			return
+		}
+	}
+
+	records, err := readImportRecords(header.Filename, data)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+
+	rows, err := mapImportRows(records, mapping)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+
+	// --- DRY RUN: validasi saja, tidak menyimpan apa pun ---
+	dryRun := r.FormValue("dryRun")
+	if dryRun == "1" || dryRun == "true" {
+		var results []importRowResult
+		valid := 0
+		for _, row := range rows {
+			res := importRowResult{Row: row.Line, Title: row.Values["title"]}
+			if b, msg := buildImportBook(row); msg != "" {
+				res.Action = "error"
+				res.Error = msg
+			} else {
+				id, err := findImportMatch(row.Values["isbn"], row.Values["title"], row.Values["author"])
+				if err != nil {
+					res.Action = "error"
+					res.Error = "Database error: " + err.Error()
+				} else if id > 0 {
+					res.Action = "update"
+					res.BookID = id
+					valid++
+				} else if !b.Given["year"] {
+					res.Action = "error"
+					res.Error = "Tahun tidak valid"
+				} else {
+					res.Action = "insert"
+					valid++
+				}
+			}
+			results = append(results, res)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"dryRun":  true,
+			"total":   len(rows),
+			"valid":   valid,
+			"invalid": len(rows) - valid,
+			"rows":    results,
+		})
+		return
+	}
+
+	// --- IMPORT SEBENARNYA: jalan di background ---
+	job := &importJob{
+		ID:        strconv.FormatInt(time.Now().UnixNano(), 36),
+		Filename:  header.Filename,
+		Status:    "berjalan",
+		Total:     len(rows),
+		StartedAt: time.Now().Format("2006-01-02 15:04:05"),
+	}
+
+	registerImportJob(job)
+
+	go runImportJob(job, rows)
+
+	log.Println("Import katalog dimulai:", job.ID, header.Filename, len(rows), "baris")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Import sedang diproses",
+		"jobId":   job.ID,
+		"total":   job.Total,
+	})
+}
+
+// 2. API Handler: Cek progress import (Admin Only)
+// GET /api/admin/books/import/status?id=...            -> JSON progress
+// GET /api/admin/books/import/status?id=...&format=csv -> laporan error CSV
+func bookImportStatusHandler(w http.ResponseWriter, r *http.Request) {
+	user := getCurrentUser(r)
+	if user.Role != "admin" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Unauthorized"})
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+
+	importJobsMu.Lock()
+	job, ok := importJobs[id]
+	var snapshot importJob
+	if ok {
+		snapshot = *job
+		snapshot.Errors = append([]importRowError(nil), job.Errors...)
+	}
+	importJobsMu.Unlock()
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Job import tidak ditemukan"})
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="import_error_`+snapshot.ID+`.csv"`)
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"baris", "judul", "jenis", "pesan"})
+		for _, e := range snapshot.Errors {
+			kind := e.Kind
+			if kind == "" {
+				kind = "error"
+			}
+			cw.Write([]string{strconv.Itoa(e.Row), e.Title, kind, e.Message})
+		}
+		cw.Flush()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// Proses semua baris import, update progress job setiap baris
+func runImportJob(job *importJob, rows []importRow) {
+	for _, row := range rows {
+		inserted, msg := saveImportRow(row)
+
+		importJobsMu.Lock()
+		job.Processed++
+		if msg != "" {
+			job.Failed++
+			job.Errors = append(job.Errors, importRowError{Row: row.Line, Title: row.Values["title"], Message: msg})
+		} else if inserted {
+			job.Inserted++
+		} else {
+			job.Updated++
+		}
+		importJobsMu.Unlock()
+	}
+
+	importJobsMu.Lock()
+	finishImportJob(job)
+	importJobsMu.Unlock()
+
+	log.Printf("Import katalog %s selesai: %d baru, %d diperbarui, %d gagal", job.ID, job.Inserted, job.Updated, job.Failed)
+}
+
+// Simpan satu baris: update jika cocok (ISBN / judul+penulis), insert jika tidak
+func saveImportRow(row importRow) (inserted bool, msg string) {
+	b, msg := buildImportBook(row)
+	if msg != "" {
+		return false, msg
+	}
+
+	id, err := findImportMatch(b.ISBN, b.Title, b.Author)
+	if err != nil {
+		return false, "Database error: " + err.Error()
+	}
+	return saveImportBook(b, id)
+}
+
+// Simpan buku hasil validasi: update jika id > 0, insert jika 0.
+// Update hanya mengubah kolom yang diisi di file (lihat importUpdateColumns),
+// jadi import ulang file sebagian tidak mengosongkan data yang sudah ada.
+func saveImportBook(b importBook, id int) (inserted bool, msg string) {
+	if id == 0 && !b.Given["year"] {
+		return false, "Tahun tidak valid"
+	}
+	if id > 0 {
+		sets, args := importUpdateColumns(b)
+		args = append(args, id)
+		_, err := db.Exec("UPDATE books SET "+strings.Join(sets, ", ")+", updated_at=NOW() WHERE id=?", args...)
+		if err != nil {
+			return false, "Gagal memperbarui buku: " + err.Error()
+		}
+		if b.Given["genre"] || b.Given["author"] {
+			// Kolom yang tidak dikirim tetap memakai nilai di database
+			var genre, author sql.NullString
+			db.QueryRow("SELECT genre, author FROM books WHERE id = ?", id).Scan(&genre, &author)
+			syncBookTaxonomy(id, genre.String, author.String)
+		}
+		reindexBook(id)
+		return false, ""
+	}
+
+	res, err := db.Exec(`INSERT INTO books
+		(title, author, isbn, publisher, year, genre, category, `+"`type`"+`, location, stockMax, fineAmount, description, coverFile, ebookFile)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.Title, b.Author, b.ISBN, b.Publisher, b.Year, b.Genre, b.Category, b.Type,
+		b.Location, b.StockMax, b.FineAmount, b.Description, "uploads/covers/default_cover.jpg", "")
+	if err != nil {
+		return false, "Gagal menambahkan buku: " + err.Error()
+	}
+	if newID, err := res.LastInsertId(); err == nil {
+		syncBookTaxonomy(int(newID), b.Genre, b.Author)
+		reindexBook(int(newID))
+	}
+	return true, ""
+}
+
+// Data buku hasil validasi satu baris import
+type importBook struct {
+	Title, Author, ISBN, Publisher, Genre, Category, Type, Location, Description string
+	Year, StockMax, FineAmount                                                   int
+
+	Given map[string]bool // field yang diisi (tidak kosong) di file
+}
+
+// Pasangan "kolom=?" & nilai untuk UPDATE, hanya dari field yang diisi di file.
+// Judul selalu ada karena wajib diisi.
+func importUpdateColumns(b importBook) ([]string, []interface{}) {
+	values := map[string]interface{}{
+		"title": b.Title, "author": b.Author, "isbn": b.ISBN, "publisher": b.Publisher,
+		"year": b.Year, "genre": b.Genre, "category": b.Category, "type": b.Type,
+		"location": b.Location, "stockMax": b.StockMax, "fineAmount": b.FineAmount,
+		"description": b.Description,
+	}
+	var sets []string
+	var args []interface{}
+	for _, f := range importFields {
+		if f != "title" && !b.Given[f] {
+			continue
+		}
+		sets = append(sets, "`"+f+"`=?")
+		args = append(args, values[f])
+	}
+	return sets, args
+}
+
+// Validasi baris dengan aturan yang sama seperti addBookHandler
+func buildImportBook(row importRow) (importBook, string) {
+	v := row.Values
+	b := importBook{
+		Title:       strings.TrimSpace(v["title"]),
+		Author:      strings.TrimSpace(v["author"]),
+		ISBN:        strings.TrimSpace(v["isbn"]),
+		Publisher:   strings.TrimSpace(v["publisher"]),
+		Genre:       strings.TrimSpace(v["genre"]),
+		Category:    strings.TrimSpace(v["category"]),
+		Type:        strings.TrimSpace(v["type"]),
+		Location:    strings.TrimSpace(v["location"]),
+		Description: strings.TrimSpace(v["description"]),
+	}
+
+	b.Given = map[string]bool{}
+	for _, f := range importFields {
+		if strings.TrimSpace(v[f]) != "" {
+			b.Given[f] = true
+		}
+	}
+
+	if b.Title == "" {
+		return b, "Judul wajib diisi"
+	}
+	if b.Type == "" {
+		b.Type = "Buku Fisik"
+	}
+
+	// Kolom angka yang kosong diisi default seperti form tambah buku
+	stockMaxStr := v["stockMax"]
+	if strings.TrimSpace(stockMaxStr) == "" {
+		stockMaxStr = "1"
+	}
+	fineAmountStr := v["fineAmount"]
+	if strings.TrimSpace(fineAmountStr) == "" {
+		fineAmountStr = "0"
+	}
+
+	// Tahun boleh kosong untuk update sebagian; insert tetap mewajibkannya (lihat saveImportBook)
+	yearStr := v["year"]
+	if !b.Given["year"] {
+		yearStr = "0"
+	}
+
+	year, stockMax, fineAmount, msg := validateBookFields(yearStr, stockMaxStr, fineAmountStr, b.Type)
+	if msg != "" {
+		return b, msg
+	}
+	b.Year, b.StockMax, b.FineAmount = year, stockMax, fineAmount
+	return b, ""
+}
+
+// Cari buku yang sudah ada: prioritas ISBN, lalu judul+penulis.
+// Mengembalikan 0 jika tidak ada yang cocok.
+func findImportMatch(isbn, title, author string) (int, error) {
+	ids, err := findImportMatches(isbn, title, author)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// Sama seperti findImportMatch, tapi mengembalikan semua id yang cocok
+// (lebih dari satu berarti data ambigu)
+func findImportMatches(isbn, title, author string) ([]int, error) {
+	isbn = strings.TrimSpace(isbn)
+	if isbn != "" {
+		ids, err := queryImportIDs("SELECT id FROM books WHERE isbn = ? ORDER BY id", isbn)
+		if err != nil || len(ids) > 0 {
+			return ids, err
+		}
+		// ISBN belum tercatat (buku lama sering tanpa ISBN): coba judul+penulis
+	}
+	return queryImportIDs(`
+		SELECT id FROM books
+		WHERE LOWER(title) = LOWER(?) AND LOWER(COALESCE(author, '')) = LOWER(?)
+		ORDER BY id`, strings.TrimSpace(title), strings.TrimSpace(author))
+}
+
+func queryImportIDs(query string, args ...interface{}) ([]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Ubah record mentah (baris pertama = header) menjadi importRow sesuai mapping
+func mapImportRows(records [][]string, mapping map[string]string) ([]importRow, error) {
+	if len(records) < 2 {
+		return nil, fmt.Errorf("File kosong atau hanya berisi header")
+	}
+
+	allowed := map[string]bool{}
+	for _, f := range importFields {
+		allowed[f] = true
+	}
+
+	// Tentukan field untuk tiap index kolom
+	colField := make([]string, len(records[0]))
+	hasTitle := false
+	for i, h := range records[0] {
+		h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+		field := ""
+		if mapping != nil {
+			field = mapping[h]
+		} else {
+			field = importColumnAliases[strings.ToLower(h)]
+		}
+		if field != "" && !allowed[field] {
+			return nil, fmt.Errorf("Field tujuan %q tidak dikenal", field)
+		}
+		colField[i] = field
+		if field == "title" {
+			hasTitle = true
+		}
+	}
+	if !hasTitle {
+		return nil, fmt.Errorf("Kolom judul (title) tidak ditemukan di header")
+	}
+
+	var rows []importRow
+	for i, rec := range records[1:] {
+		values := map[string]string{}
+		empty := true
+		for j, cell := range rec {
+			if j >= len(colField) || colField[j] == "" {
+				continue
+			}
+			values[colField[j]] = cell
+			if strings.TrimSpace(cell) != "" {
+				empty = false
+			}
+		}
+		if empty {
+			continue // lewati baris kosong
+		}
+		rows = append(rows, importRow{Line: i + 2, Values: values})
+	}
+	return rows, nil
+}
+
+// Baca file CSV atau XLSX menjadi slice record
+func readImportRecords(filename string, data []byte) ([][]string, error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		cr := csv.NewReader(bytes.NewReader(data))
+		cr.FieldsPerRecord = -1
+		cr.LazyQuotes = true
+		// Excel versi Indonesia sering menyimpan CSV dengan pemisah titik koma
+		if firstLine, _, _ := bytes.Cut(data, []byte("\n")); bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+			cr.Comma = ';'
+		}
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("CSV tidak valid: %v", err)
+		}
+		return records, nil
+	case ".xlsx":
+		return readXLSXRecords(data)
+	default:
+		return nil, fmt.Errorf("Format file harus .csv atau .xlsx")
+	}
+}
+
+// --- Parser XLSX minimal (sheet pertama saja) ---
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRels struct {
+	Rels []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxRichText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxRichText) text() string {
+	if len(t.R) == 0 {
+		return t.T
+	}
+	var sb strings.Builder
+	for _, r := range t.R {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string       `xml:"r,attr"`
+			Type   string       `xml:"t,attr"`
+			Value  string       `xml:"v"`
+			Inline xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readXLSXRecords(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("XLSX tidak valid: %v", err)
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	decode := func(name string, v interface{}) error {
+		f, ok := files[name]
+		if !ok {
+			return fmt.Errorf("bagian %s tidak ditemukan", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return xml.NewDecoder(rc).Decode(v)
+	}
+
+	// Cari file sheet pertama lewat workbook.xml + relasinya
+	sheetPath := "xl/worksheets/sheet1.xml"
+	var wb xlsxWorkbook
+	var rels xlsxRels
+	if decode("xl/workbook.xml", &wb) == nil && decode("xl/_rels/workbook.xml.rels", &rels) == nil && len(wb.Sheets) > 0 {
+		for _, rel := range rels.Rels {
+			if rel.ID == wb.Sheets[0].RID {
+				target := strings.TrimPrefix(rel.Target, "/")
+				if !strings.HasPrefix(target, "xl/") {
+					target = "xl/" + target
+				}
+				sheetPath = target
+				break
+			}
+		}
+	}
+
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decode("xl/sharedStrings.xml", &shared); err != nil {
+			return nil, fmt.Errorf("XLSX tidak valid: %v", err)
+		}
+	}
+
+	var sheet xlsxSheet
+	if err := decode(sheetPath, &sheet); err != nil {
+		return nil, fmt.Errorf("XLSX tidak valid: %v", err)
+	}
+
+	var records [][]string
+	for _, row := range sheet.Rows {
+		var rec []string
+		for i, c := range row.Cells {
+			col := xlsxColumnIndex(c.Ref)
+			if col < 0 {
+				col = i
+			}
+			for len(rec) <= col {
+				rec = append(rec, "")
+			}
+
+			val := c.Value
+			switch c.Type {
+			case "s":
+				idx, err := strconv.Atoi(c.Value)
+				if err == nil && idx >= 0 && idx < len(shared.Items) {
+					val = shared.Items[idx].text()
+				}
+			case "inlineStr":
+				val = c.Inline.text()
+			case "n", "":
+				// Angka bulat disimpan Excel sebagai "2020" atau "2020.0"
+				if f, err := strconv.ParseFloat(val, 64); err == nil && f == float64(int64(f)) {
+					val = strconv.FormatInt(int64(f), 10)
+				}
+			}
+			rec[col] = val
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// Ubah referensi sel ("C12") menjadi index kolom (2)
+func xlsxColumnIndex(ref string) int {
+	col := 0
+	n := 0
+	for _, ch := range ref {
+		if ch >= 'A' && ch <= 'Z' {
+			col = col*26 + int(ch-'A'+1)
+			n++
+		} else {
+			break
+		}
+	}
+	if n == 0 {
+		return -1
+	}
+	return col - 1
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMapImportRows(t *testing.T) {
+	records := [][]string{
+		{"\ufeffJudul", "Penulis", "Tahun", "Kolom Lain"},
+		{"Laskar Pelangi", "Andrea Hirata", "2005", "x"},
+		{"", "", "", ""},
+		{"Bumi", "Tere Liye", "2014", ""},
+	}
+	rows, err := mapImportRows(records, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("jumlah baris = %d, ingin 2 (baris kosong dilewati)", len(rows))
+	}
+	if rows[1].Line != 4 || rows[1].Values["title"] != "Bumi" || rows[1].Values["year"] != "2014" {
+		t.Errorf("baris kedua = %+v", rows[1])
+	}
+	if _, ok := rows[0].Values[""]; ok {
+		t.Error("kolom tanpa mapping ikut tersimpan")
+	}
+
+	if _, err := mapImportRows([][]string{{"Penulis"}, {"A"}}, nil); err == nil {
+		t.Error("header tanpa judul harus ditolak")
+	}
+	if _, err := mapImportRows([][]string{{"Judul"}, {"A"}}, map[string]string{"Judul": "sandi"}); err == nil {
+		t.Error("field tujuan tak dikenal harus ditolak")
+	}
+}
+
+func TestImportUpdateColumns(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]string
+		wantSets []string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "hanya judul dan tahun",
+			values:   map[string]string{"title": "Bumi", "year": "2014"},
+			wantSets: []string{"`title`=?", "`year`=?"},
+			wantArgs: []interface{}{"Bumi", 2014},
+		},
+		{
+			name:     "stok & denda kosong tidak di-reset ke default",
+			values:   map[string]string{"title": "Bumi", "year": "2014", "stockMax": " ", "fineAmount": "", "location": "Rak 2"},
+			wantSets: []string{"`title`=?", "`year`=?", "`location`=?"},
+			wantArgs: []interface{}{"Bumi", 2014, "Rak 2"},
+		},
+		{
+			name:     "tanpa kolom tahun",
+			values:   map[string]string{"title": "Bumi", "location": "Rak 2"},
+			wantSets: []string{"`title`=?", "`location`=?"},
+			wantArgs: []interface{}{"Bumi", "Rak 2"},
+		},
+		{
+			name:     "tipe default hanya untuk insert",
+			values:   map[string]string{"title": "Bumi", "year": "2014", "stockMax": "3", "description": "Novel"},
+			wantSets: []string{"`title`=?", "`year`=?", "`stockMax`=?", "`description`=?"},
+			wantArgs: []interface{}{"Bumi", 2014, 3, "Novel"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, msg := buildImportBook(importRow{Line: 2, Values: tt.values})
+			if msg != "" {
+				t.Fatal(msg)
+			}
+			sets, args := importUpdateColumns(b)
+			if !reflect.DeepEqual(sets, tt.wantSets) || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("sets = %v %v, ingin %v %v", sets, args, tt.wantSets, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuildImportBookDefaults(t *testing.T) {
+	b, msg := buildImportBook(importRow{Values: map[string]string{"title": " Bumi ", "year": "2014"}})
+	if msg != "" {
+		t.Fatal(msg)
+	}
+	if b.Title != "Bumi" || b.Type != "Buku Fisik" || b.StockMax != 1 || b.FineAmount != 0 {
+		t.Errorf("default insert salah: %+v", b)
+	}
+	if _, msg := buildImportBook(importRow{Values: map[string]string{"year": "2014"}}); msg == "" {
+		t.Error("judul kosong harus ditolak")
+	}
+	if _, msg := buildImportBook(importRow{Values: map[string]string{"title": "A", "year": "dua ribu"}}); msg == "" {
+		t.Error("tahun tidak valid harus ditolak")
+	}
+}
+
+func TestSaveImportBookInsertNeedsYear(t *testing.T) {
+	b, msg := buildImportBook(importRow{Values: map[string]string{"title": "Bumi"}})
+	if msg != "" {
+		t.Fatal(msg)
+	}
+	// Ditolak sebelum menyentuh database
+	if inserted, msg := saveImportBook(b, 0); inserted || msg == "" {
+		t.Error("insert tanpa tahun harus ditolak")
+	}
+}
+
+func TestRegisterImportJobEvictsOld(t *testing.T) {
+	importJobsMu.Lock()
+	saved := importJobs
+	importJobs = map[string]*importJob{
+		"lama":     {ID: "lama", finished: time.Now().Add(-importJobTTL - time.Minute)},
+		"baru":     {ID: "baru", finished: time.Now().Add(-time.Minute)},
+		"berjalan": {ID: "berjalan"},
+	}
+	importJobsMu.Unlock()
+	t.Cleanup(func() {
+		importJobsMu.Lock()
+		importJobs = saved
+		importJobsMu.Unlock()
+	})
+
+	registerImportJob(&importJob{ID: "x"})
+
+	importJobsMu.Lock()
+	defer importJobsMu.Unlock()
+	for id, want := range map[string]bool{"lama": false, "baru": true, "berjalan": true, "x": true} {
+		if _, ok := importJobs[id]; ok != want {
+			t.Errorf("job %q tersimpan = %v, ingin %v", id, ok, want)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ==========================================
+// IMPORT MARC21 / MARCXML (MIGRASI DARI ILS LAMA)
+// ==========================================
+
+// Aturan pemetaan default: field books -> daftar sumber MARC.
+// Format sumber:
+//
+//	"245a"       subfield a dari field 245
+//	"008/07-10"  posisi karakter 07 s/d 10 dari control field 008
+//	"=Fiksi"     nilai tetap
+//
+// Sumber pertama yang berisi nilai dipakai, kecuali genre yang mengumpulkan semua nilai.
+var defaultMARCRules = map[string][]string{
+	"title":       {"245a"},
+	"author":      {"100a", "110a", "700a"},
+	"isbn":        {"020a"},
+	"publisher":   {"260b", "264b"},
+	"year":        {"260c", "264c", "008/07-10"},
+	"genre":       {"650a", "651a", "655a"},
+	"location":    {"852h", "090a", "050a", "082a"},
+	"description": {"520a"},
+}
+
+var marcYearPattern = regexp.MustCompile(`\d{4}`)
+var marcPositionPattern = regexp.MustCompile(`^(\d{3})/(\d{2})-(\d{2})$`)
+
+// API Handler: Upload file MARC21 / MARCXML (Admin Only)
+// POST /api/admin/books/import/marc  (multipart: file, rules?, onDuplicate=skip|update, dryRun?)
+func marcImportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := getCurrentUser(r)
+	if user.Role != "admin" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Unauthorized"})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Method not allowed"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, importMaxBytes+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Gagal membaca form atau file terlalu besar: " + err.Error()})
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "File MARC wajib diupload"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Gagal membaca file: " + err.Error()})
+		return
+	}
+
+	// Aturan mapping opsional, menimpa default per field.
+	// Contoh: {"location":["099a"],"category":["=Fiksi"]}
+	rules := map[string][]string{}
+	for k, v := range defaultMARCRules {
+		rules[k] = v
+	}
+	if m := r.FormValue("rules"); m != "" {
+		var custom map[string][]string
+		if err := json.Unmarshal([]byte(m), &custom); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Format rules tidak valid"})
+			return
+		}
+		for field, sources := range custom {
+			if !isImportField(field) {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(Response{Success: false, Message: "Field tujuan tidak dikenal: " + field})
+				return
+			}
+			rules[field] = sources
+		}
+	}
+
+	onDuplicate := r.FormValue("onDuplicate")
+	if onDuplicate == "" {
+		onDuplicate = "skip"
+	}
+	if onDuplicate != "skip" && onDuplicate != "update" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "onDuplicate harus skip atau update"})
+		return
+	}
+
+	items, err := readMARCFile(header.Filename, data, rules)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	if len(items) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Tidak ada record MARC di file"})
+		return
+	}
+
+	// --- DRY RUN ---
+	dryRun := r.FormValue("dryRun")
+	if dryRun == "1" || dryRun == "true" {
+		var results []importRowResult
+		summary := map[string]int{}
+		for _, item := range items {
+			_, action, id, msg := planMARCRecord(item, onDuplicate)
+			summary[action]++
+			results = append(results, importRowResult{
+				Row:    item.Line,
+				Title:  item.Values["title"],
+				Action: action,
+				BookID: id,
+				Error:  msg,
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"dryRun":  true,
+			"total":   len(items),
+			"summary": summary,
+			"rows":    results,
+		})
+		return
+	}
+
+	// --- IMPORT di background, progress lewat /api/admin/books/import/status ---
+	job := &importJob{
+		ID:        strconv.FormatInt(time.Now().UnixNano(), 36),
+		Filename:  header.Filename,
+		Status:    "berjalan",
+		Total:     len(items),
+		StartedAt: time.Now().Format("2006-01-02 15:04:05"),
+	}
+
+	registerImportJob(job)
+
+	go runMARCImportJob(job, items, onDuplicate)
+
+	log.Println("Import MARC dimulai:", job.ID, header.Filename, len(items), "record")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Import MARC sedang diproses",
+		"jobId":   job.ID,
+		"total":   job.Total,
+	})
+}
+
+// Satu record MARC yang sudah dipetakan ke field books
+type marcImportItem struct {
+	importRow
+	ParseError string
+	MARC8      bool // leader/09 bukan "a"; MARCXML selalu UTF-8
+}
+
+func runMARCImportJob(job *importJob, items []marcImportItem, onDuplicate string) {
+	for _, item := range items {
+		b, action, id, msg := planMARCRecord(item, onDuplicate)
+
+		if action == "insert" || action == "update" {
+			_, msg = saveImportBook(b, id)
+			if msg != "" {
+				action = "error"
+			}
+		}
+
+		importJobsMu.Lock()
+		job.Processed++
+		switch action {
+		case "insert":
+			job.Inserted++
+		case "update":
+			job.Updated++
+		case "skipped", "ambiguous":
+			job.Skipped++
+			job.Errors = append(job.Errors, importRowError{Row: item.Line, Title: item.Values["title"], Kind: action, Message: msg})
+		default:
+			job.Failed++
+			job.Errors = append(job.Errors, importRowError{Row: item.Line, Title: item.Values["title"], Message: msg})
+		}
+		importJobsMu.Unlock()
+	}
+
+	importJobsMu.Lock()
+	finishImportJob(job)
+	importJobsMu.Unlock()
+
+	log.Printf("Import MARC %s selesai: %d baru, %d diperbarui, %d dilewati, %d gagal",
+		job.ID, job.Inserted, job.Updated, job.Skipped, job.Failed)
+}
+
+// Tentukan aksi satu record: insert / update / skipped / ambiguous / error
+func planMARCRecord(item marcImportItem, onDuplicate string) (b importBook, action string, id int, msg string) {
+	if item.ParseError != "" {
+		return b, "error", 0, item.ParseError
+	}
+
+	if item.MARC8 {
+		return b, "skipped", 0, "Encoding MARC-8 tidak didukung, konversi file ke UTF-8 terlebih dahulu"
+	}
+	for _, v := range item.Values {
+		if !utf8.ValidString(v) {
+			return b, "error", 0, "Record berisi teks UTF-8 yang rusak"
+		}
+	}
+
+	b, msg = buildImportBook(item.importRow)
+	if msg != "" {
+		return b, "error", 0, msg
+	}
+
+	ids, err := findImportMatches(b.ISBN, b.Title, b.Author)
+	if err != nil {
+		return b, "error", 0, "Database error: " + err.Error()
+	}
+
+	switch {
+	case len(ids) == 0 && !b.Given["year"]:
+		return b, "error", 0, "Tahun tidak valid"
+	case len(ids) == 0:
+		return b, "insert", 0, ""
+	case len(ids) > 1:
+		return b, "ambiguous", 0, fmt.Sprintf("Cocok dengan %d buku (id %s)", len(ids), joinInts(ids))
+	case onDuplicate == "update":
+		return b, "update", ids[0], ""
+	default:
+		return b, "skipped", ids[0], fmt.Sprintf("Duplikat dengan buku id %d", ids[0])
+	}
+}
+
+// Baca file ISO 2709 atau MARCXML lalu petakan tiap record ke field books
+func readMARCFile(filename string, data []byte, rules map[string][]string) ([]marcImportItem, error) {
+	ext := strings.ToLower(path.Ext(filename))
+	isXML := ext == ".xml" || bytes.HasPrefix(bytes.TrimLeft(data, "\ufeff \r\n\t"), []byte("<"))
+
+	var items []marcImportItem
+	if isXML {
+		records, err := parseMARCXML(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		for i, rec := range records {
+			items = append(items, marcImportItem{importRow: importRow{Line: i + 1, Values: mapMARCRecord(rec, rules)}})
+		}
+		return items, nil
+	}
+
+	for i, raw := range splitMARC21(data) {
+		item := marcImportItem{importRow: importRow{Line: i + 1}}
+		rec, err := parseMARC21(raw)
+		if err != nil {
+			item.ParseError = err.Error()
+		} else {
+			item.Values = mapMARCRecord(rec, rules)
+			item.MARC8 = !rec.isUnicode()
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Terapkan aturan mapping ke satu record
+func mapMARCRecord(rec marcRecord, rules map[string][]string) map[string]string {
+	values := map[string]string{}
+	for field, sources := range rules {
+		var collected []string
+		for _, src := range sources {
+			vals := marcSourceValues(rec, src)
+			if field != "genre" && len(vals) > 0 {
+				collected = vals[:1]
+				break
+			}
+			collected = append(collected, vals...)
+		}
+
+		switch field {
+		case "year":
+			if len(collected) > 0 {
+				values[field] = marcYearPattern.FindString(collected[0])
+			}
+		case "isbn":
+			// "9789793062792 (pbk.)" -> "9789793062792"
+			if len(collected) > 0 {
+				values[field] = strings.Fields(collected[0] + " ")[0]
+			}
+		case "genre":
+			seen := map[string]bool{}
+			var genres []string
+			for _, g := range collected {
+				key := strings.ToLower(g)
+				if !seen[key] {
+					seen[key] = true
+					genres = append(genres, g)
+				}
+			}
+			values[field] = strings.Join(genres, ", ")
+		default:
+			if len(collected) > 0 {
+				values[field] = collected[0]
+			}
+		}
+	}
+	return values
+}
+
+// Ambil nilai dari satu sumber aturan (lihat defaultMARCRules)
+func marcSourceValues(rec marcRecord, src string) []string {
+	src = strings.TrimSpace(src)
+	if strings.HasPrefix(src, "=") {
+		return []string{strings.TrimPrefix(src, "=")}
+	}
+
+	if m := marcPositionPattern.FindStringSubmatch(src); m != nil {
+		val := rec.control(m[1])
+		from, _ := strconv.Atoi(m[2])
+		to, _ := strconv.Atoi(m[3])
+		if to >= len(val) || from > to {
+			return nil
+		}
+		if v := strings.TrimSpace(val[from : to+1]); v != "" {
+			return []string{v}
+		}
+		return nil
+	}
+
+	if len(src) == 3 {
+		if v := rec.control(src); v != "" {
+			return []string{v}
+		}
+		return nil
+	}
+	if len(src) != 4 {
+		return nil
+	}
+
+	var out []string
+	for _, v := range rec.subfields(src[:3], src[3:]) {
+		if v = trimMARCPunctuation(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Buang tanda baca ISBD di akhir nilai ("Judul /" -> "Judul")
+func trimMARCPunctuation(s string) string {
+	s = strings.TrimSpace(s)
+	for {
+		trimmed := strings.TrimSpace(strings.TrimRight(s, "/:;,=."))
+		if trimmed == s {
+			break
+		}
+		s = trimmed
+	}
+	// Tahun seperti "[2005]" atau "c2005" dibiarkan, diambil angkanya oleh marcYearPattern
+	return s
+}
+
+func isImportField(field string) bool {
+	for _, f := range importFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func joinInts(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -364,7 +364,7 @@ document.addEventListener("DOMContentLoaded", () => {
             // Handle Cover
             let coverHTML;
             if (book.coverFile) {
-                coverHTML = `<img src="/${book.coverFile}" alt="${book.title}" class="w-full aspect-[2/3] object-cover rounded mb-3 shadow-sm group-hover:scale-[1.02] transition-transform duration-300">`;
+                coverHTML = coverImageHTML(book, 'w-full aspect-[2/3] object-cover rounded mb-3 shadow-sm group-hover:scale-[1.02] transition-transform duration-300');
             } else {
                 coverHTML = `
                     <div class="w-full aspect-[2/3] bg-gray-200 rounded mb-3 flex items-center justify-center">
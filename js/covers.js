@@ -0,0 +1,23 @@
+// ================= Sampul Buku =================
+// Kartu katalog memakai thumbnail hasil proses server (WebP + JPEG, srcset)
+// dan warna dominan sebagai latar selagi gambar dimuat. Buku yang sampulnya
+// belum diproses tetap memakai file asli.
+function coverImageHTML(book, className) {
+    const style = book.coverColor ? ` style="background-color:${book.coverColor}"` : '';
+    const variants = book.coverVariants ? Object.values(book.coverVariants) : [];
+    if (variants.length === 0) {
+        return `<img src="/${encodeURI(book.coverFile)}" alt="${book.title}" class="${className}"${style} loading="lazy">`;
+    }
+
+    // Lebar yang sama (sampul kecil) cukup disebut sekali
+    const seen = {};
+    const unique = variants.filter(v => !seen[v.width] && (seen[v.width] = true)).sort((a, b) => a.width - b.width);
+    const srcset = key => unique.map(v => `/${encodeURI(v[key])} ${v.width}w`).join(', ');
+    const sizes = '(min-width: 1024px) 200px, (min-width: 640px) 30vw, 45vw';
+    const fallback = (book.coverVariants.md || unique[unique.length - 1]).jpeg;
+
+    return `<picture>
+        <source type="image/webp" srcset="${srcset('webp')}" sizes="${sizes}">
+        <img src="/${encodeURI(fallback)}" srcset="${srcset('jpeg')}" sizes="${sizes}" alt="${book.title}" class="${className}"${style} loading="lazy">
+    </picture>`;
+}
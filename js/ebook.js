@@ -1,8 +1,11 @@
 document.addEventListener("DOMContentLoaded", () => {
     const ebookBtn = document.getElementById("tab-ebook");
     const historyBtn = document.getElementById("tab-history");
+    const statsBtn = document.getElementById("tab-stats");
+    const statsContainer = document.getElementById("stats-container");
     const searchInput = document.getElementById("search-input");
     const searchBtn = document.getElementById("search-button");
+    const fulltextCheck = document.getElementById("search-fulltext");
     const bookContainer = document.getElementById('book-list-container');
     const historyContainer = document.getElementById("history-container");
 
@@ -81,6 +84,65 @@ document.addEventListener("DOMContentLoaded", () => {
         }
     }
 
+    // ================= Cari di Isi Ebook =================
+    async function searchInsideBooks(searchQuery) {
+        bookContainer.innerHTML = '<p class="col-span-full text-center text-gray-500">Mencari di isi buku...</p>';
+
+        try {
+            const res = await fetch(`/api/ebook/search?q=${encodeURIComponent(searchQuery)}`);
+            const data = await res.json();
+            if (!res.ok) throw new Error(data.message || "HTTP error " + res.status);
+
+            bookContainer.innerHTML = '';
+            if (!data.results || data.results.length === 0) {
+                bookContainer.innerHTML = '<p class="col-span-full text-center text-gray-500">Tidak ada isi buku yang cocok.</p>';
+                return;
+            }
+
+            data.results.forEach(book => {
+                const card = document.createElement('div');
+                card.className = 'col-span-full bg-white p-4 rounded-lg shadow flex gap-4';
+
+                const img = document.createElement('img');
+                img.src = book.coverFile ? '/' + book.coverFile : '/uploads/default_book.png';
+                img.alt = book.title;
+                img.className = 'w-20 aspect-[2/3] object-cover rounded flex-shrink-0';
+                card.appendChild(img);
+
+                const body = document.createElement('div');
+                body.className = 'flex-1 min-w-0';
+
+                const title = document.createElement('a');
+                title.href = `/buka_buku_member.html?id=${book.bookId}`;
+                title.textContent = book.title;
+                title.className = 'font-bold text-lg hover:text-indigo-600';
+                body.appendChild(title);
+
+                const meta = document.createElement('p');
+                meta.textContent = `${book.author} · ${book.totalHits} hasil`;
+                meta.className = 'text-sm text-gray-600 mb-2';
+                body.appendChild(meta);
+
+                book.hits.forEach(hit => {
+                    const a = document.createElement('a');
+                    a.href = hit.url;
+                    a.className = 'block text-sm text-gray-700 border-l-4 border-indigo-200 pl-3 py-1 mb-1 hover:bg-indigo-50 [&_mark]:bg-yellow-200';
+                    const label = book.format === 'epub' ? `Bab ${hit.page}` : `Hal. ${hit.page}`;
+                    // snippet sudah di-escape server, hanya <mark> yang berupa HTML
+                    a.innerHTML = `<span class="font-semibold text-indigo-600 mr-2">${label}</span>${hit.snippet}`;
+                    body.appendChild(a);
+                });
+
+                card.appendChild(body);
+                bookContainer.appendChild(card);
+            });
+
+        } catch (err) {
+            console.error("Search inside books error:", err);
+            bookContainer.innerHTML = '<p class="col-span-full text-center text-red-500">Gagal mencari di isi buku.</p>';
+        }
+    }
+
     // ================= Load History Baca Ebook =================
 async function loadHistory(searchQuery = '') {
     const historyContainer = document.getElementById("history-container");
@@ -181,12 +243,110 @@ async function loadHistory(searchQuery = '') {
     }
 }
 
+    // ================= Statistik Baca =================
+    async function loadStats() {
+        statsContainer.innerHTML = '<p class="text-center text-gray-500">Memuat statistik baca...</p>';
+
+        try {
+            const res = await fetch('/api/ebook/stats');
+            if (!res.ok) throw new Error("HTTP error " + res.status);
+            const stats = await res.json();
+
+            const formatMinutes = m => m >= 60 ? `${Math.floor(m / 60)} jam ${m % 60} mnt` : `${m} mnt`;
+            statsContainer.innerHTML = '';
+
+            // Ringkasan
+            const summary = document.createElement('div');
+            summary.className = 'grid grid-cols-2 md:grid-cols-4 gap-4';
+            [
+                ['fa-clock', 'Total waktu baca', formatMinutes(stats.totalMinutes)],
+                ['fa-fire', 'Streak harian', `${stats.currentStreak} hari (terpanjang ${stats.longestStreak})`],
+                ['fa-book-open', 'Buku dibaca', stats.booksStarted],
+                ['fa-check-circle', 'Buku tamat', stats.booksCompleted],
+            ].forEach(([icon, label, value]) => {
+                const card = document.createElement('div');
+                card.className = 'bg-white p-4 rounded-lg shadow';
+                card.innerHTML = `<p class="text-sm text-gray-500"><i class="fas ${icon} mr-1 text-indigo-500"></i>${label}</p>`;
+                const v = document.createElement('p');
+                v.className = 'text-xl font-bold mt-1';
+                v.textContent = value;
+                card.appendChild(v);
+                summary.appendChild(card);
+            });
+            statsContainer.appendChild(summary);
+
+            // Grafik menit per hari (30 hari terakhir)
+            const chart = document.createElement('div');
+            chart.className = 'bg-white p-4 rounded-lg shadow';
+            chart.innerHTML = '<p class="font-semibold mb-3">Menit membaca, 30 hari terakhir</p>';
+            const bars = document.createElement('div');
+            bars.className = 'flex items-end gap-1 h-32';
+            const maxMinutes = Math.max(1, ...stats.last30Days.map(d => d.minutes));
+            stats.last30Days.forEach(d => {
+                const bar = document.createElement('div');
+                bar.className = 'flex-1 bg-indigo-500 rounded-t';
+                bar.style.height = `${Math.max(2, d.minutes / maxMinutes * 100)}%`;
+                if (d.minutes === 0) bar.classList.replace('bg-indigo-500', 'bg-gray-200');
+                bar.title = `${d.date}: ${d.minutes} menit`;
+                bars.appendChild(bar);
+            });
+            chart.appendChild(bars);
+            statsContainer.appendChild(chart);
+
+            // Per buku
+            if (stats.books.length === 0) {
+                const empty = document.createElement('p');
+                empty.className = 'text-center text-gray-500';
+                empty.textContent = 'Belum ada aktivitas baca.';
+                statsContainer.appendChild(empty);
+                return;
+            }
+            stats.books.forEach(book => {
+                const item = document.createElement('a');
+                item.href = `/baca_buku?id=${book.bookId}`;
+                item.className = 'bg-white p-4 rounded-lg shadow flex items-center gap-4 hover:shadow-lg transition';
+
+                const img = document.createElement('img');
+                img.src = book.coverFile ? '/' + book.coverFile : '/uploads/default_book.png';
+                img.alt = book.title;
+                img.className = 'w-12 aspect-[2/3] object-cover rounded';
+                item.appendChild(img);
+
+                const body = document.createElement('div');
+                body.className = 'flex-1 min-w-0';
+                const title = document.createElement('p');
+                title.className = 'font-semibold truncate';
+                title.textContent = book.title;
+                body.appendChild(title);
+
+                const meta = document.createElement('p');
+                meta.className = 'text-sm text-gray-600';
+                meta.textContent = `${formatMinutes(book.minutes)} · ${book.sessions} sesi · ${book.completed ? 'Tamat' : book.percent + '%'}`;
+                body.appendChild(meta);
+
+                const progress = document.createElement('div');
+                progress.className = 'w-full bg-gray-200 rounded h-2 mt-2';
+                progress.innerHTML = `<div class="h-2 rounded ${book.completed ? 'bg-green-500' : 'bg-indigo-500'}" style="width: ${Math.min(100, book.percent)}%"></div>`;
+                body.appendChild(progress);
+
+                item.appendChild(body);
+                statsContainer.appendChild(item);
+            });
+
+        } catch (err) {
+            console.error("Load stats error:", err);
+            statsContainer.innerHTML = '<p class="text-center text-red-500">Gagal memuat statistik baca.</p>';
+        }
+    }
+
     // ================= Tab Handling =================
     function resetTabs() {
         ebookBtn.classList.remove("border-indigo-600", "text-indigo-600");
         historyBtn.classList.remove("border-indigo-600", "text-indigo-600");
+        statsBtn.classList.remove("border-indigo-600", "text-indigo-600");
         bookContainer.classList.add("hidden");
         historyContainer.classList.add("hidden");
+        statsContainer.classList.add("hidden");
     }
 
     const filterOptions = document.getElementById("ebook-filter-options");
@@ -217,17 +377,27 @@ async function loadHistory(searchQuery = '') {
                 if(typeof applyStatusFilter === "function") applyStatusFilter();
                 historyContainer.classList.remove("opacity-0");
             }, 150);
+
+        } else if(tab === 'stats') {
+            activeTab = 'stats';
+            statsBtn.classList.add("border-indigo-600","text-indigo-600");
+            statsContainer.classList.remove("hidden");
+            if(filterOptions) filterOptions.classList.add("hidden");
+            loadStats();
         }
     }
 
     // ================= Search =================
     function performSearch() {
-        if(activeTab === 'ebook') loadBooks(searchInput.value.trim(), 'Ebook');
+        const query = searchInput.value.trim();
+        if(activeTab === 'ebook' && fulltextCheck.checked && query) searchInsideBooks(query);
+        else if(activeTab === 'ebook') loadBooks(query, 'Ebook');
         else if(activeTab === 'history') loadHistory(searchInput.value.trim());
     }
 
     ebookBtn.addEventListener('click', () => activateTab('ebook'));
     historyBtn.addEventListener('click', () => activateTab('history'));
+    statsBtn.addEventListener('click', () => activateTab('stats'));
     searchBtn.addEventListener('click', performSearch);
     searchInput.addEventListener('keyup', e => { if(e.key === 'Enter') performSearch(); });
 
@@ -295,7 +295,7 @@ document.addEventListener("DOMContentLoaded", () => {
             // Handle Cover
             let coverHTML;
             if (book.coverFile) {
-                coverHTML = `<img src="/${book.coverFile}" alt="${book.title}" class="w-full aspect-[2/3] object-cover rounded mb-3 shadow-sm">`;
+                coverHTML = coverImageHTML(book, 'w-full aspect-[2/3] object-cover rounded mb-3 shadow-sm');
             } else {
                 coverHTML = `
                     <div class="w-full aspect-[2/3] bg-gray-200 rounded mb-3 flex items-center justify-center">
@@ -360,11 +360,15 @@ document.addEventListener("DOMContentLoaded", () => {
         if (!carouselInner) return;
 
         try {
-            // Fetch ke Backend Go
-            const res = await fetch('/api/books/random'); 
-            if (!res.ok) throw new Error("Gagal load carousel");
-            
-            carouselData = await res.json();
+            // Rekomendasi personal; model belum siap (503) -> buku acak
+            let res = await fetch('/api/recommendations/home?limit=5');
+            if (res.ok) {
+                carouselData = (await res.json()).books || [];
+            } else {
+                res = await fetch('/api/books/random');
+                if (!res.ok) throw new Error("Gagal load carousel");
+                carouselData = await res.json();
+            }
             renderCarousel(carouselData);
 
         } catch (err) {
@@ -405,6 +409,7 @@ document.addEventListener("DOMContentLoaded", () => {
                     <h3 class="text-xl sm:text-2xl font-bold text-indigo-900 mb-1 leading-tight line-clamp-2">${book.title}</h3>
                     <p class="text-sm font-semibold text-indigo-600 mb-2">${book.author}</p>
                     <p class="text-gray-600 text-xs sm:text-sm leading-relaxed">${synopsis}</p>
+                    ${book.reason ? `<p class="text-xs text-indigo-500 mt-2">${book.reason}</p>` : ''}
                 </div>
             `;
             carouselInner.appendChild(item);
@@ -0,0 +1,106 @@
+// ================= Sesi Baca (analitik) =================
+// Dipakai reader PDF & EPUB: kirim event start, page (heartbeat) dan end
+// ke /api/ebook/events. Durasi baca dihitung server dari jarak antar event.
+function createReadingSession(bookId) {
+    const HEARTBEAT_MS = 60 * 1000;
+    const sessionId = (window.crypto && crypto.randomUUID)
+        ? crypto.randomUUID()
+        : Array.from(crypto.getRandomValues(new Uint8Array(16)), b => b.toString(16).padStart(2, '0')).join('');
+
+    let current = {};
+    let ended = false;
+
+    function payload(kind, extra) {
+        return JSON.stringify(Object.assign({ bookId: parseInt(bookId), sessionId: sessionId, kind: kind }, current, extra || {}));
+    }
+
+    function send(kind, extra) {
+        return fetch('/api/ebook/events', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: payload(kind, extra)
+        }).catch(e => console.warn("Gagal kirim event baca", e));
+    }
+
+    // Heartbeat hanya saat halaman terlihat; tab di belakang tidak dihitung membaca
+    setInterval(() => {
+        if (document.visibilityState === 'visible' && !ended) send('page');
+    }, HEARTBEAT_MS);
+
+    function end() {
+        if (ended) return;
+        ended = true;
+        navigator.sendBeacon('/api/ebook/events', payload('end'));
+    }
+    window.addEventListener('pagehide', end);
+    document.addEventListener('visibilitychange', () => {
+        if (document.visibilityState === 'hidden') {
+            end();
+        } else if (ended) {
+            // Kembali ke tab: lanjutkan sesi yang sama (jeda tidak dihitung server
+            // karena event end sudah menutup hitungan sebelumnya)
+            ended = false;
+            send('page');
+        }
+    });
+
+    return {
+        id: sessionId,
+        start(extra) { current = Object.assign(current, extra || {}); return send('start'); },
+        // Simpan posisi terkini untuk heartbeat / end berikutnya
+        update(extra) { current = Object.assign(current, extra || {}); },
+        end: end
+    };
+}
+
+// ================= Perangkat (sinkron progres) =================
+// ID perangkat disimpan di localStorage supaya tetap sama antar sesi baca
+function readerDevice() {
+    let id = localStorage.getItem('libraDeviceId');
+    if (!id) {
+        id = Array.from(crypto.getRandomValues(new Uint8Array(12)), b => b.toString(16).padStart(2, '0')).join('');
+        localStorage.setItem('libraDeviceId', id);
+    }
+
+    const ua = navigator.userAgent;
+    const browser = /Edg\//.test(ua) ? 'Edge'
+        : /Firefox\//.test(ua) ? 'Firefox'
+        : /Chrome\//.test(ua) ? 'Chrome'
+        : /Safari\//.test(ua) ? 'Safari' : 'Browser';
+    const os = /Android/.test(ua) ? 'Android'
+        : /iPhone/.test(ua) ? 'iPhone'
+        : /iPad/.test(ua) ? 'iPad'
+        : /Windows/.test(ua) ? 'Windows'
+        : /Mac OS/.test(ua) ? 'Mac'
+        : /Linux/.test(ua) ? 'Linux' : 'perangkat lain';
+
+    return { id: id, name: `${browser} di ${os}` };
+}
+
+// Tawarkan pindah ke posisi yang dibaca di perangkat lain (kebijakan "latest")
+function showSyncPrompt(position, label, onAccept) {
+    const when = position.clientAt ? new Date(position.clientAt).toLocaleString('id-ID') : '';
+    const box = document.createElement('div');
+    box.className = 'fixed bottom-5 left-5 z-50 max-w-sm bg-white text-gray-800 rounded-lg shadow-xl p-4 border border-indigo-200';
+
+    const text = document.createElement('p');
+    text.className = 'text-sm mb-3';
+    text.textContent = `Terakhir dibaca di ${position.deviceName || 'perangkat lain'} sampai ${label}${when ? ' (' + when + ')' : ''}.`;
+    box.appendChild(text);
+
+    const actions = document.createElement('div');
+    actions.className = 'flex gap-2 justify-end';
+    const stay = document.createElement('button');
+    stay.className = 'px-3 py-1 text-sm rounded border border-gray-300 hover:bg-gray-100';
+    stay.textContent = 'Tetap di sini';
+    stay.onclick = () => box.remove();
+    const go = document.createElement('button');
+    go.className = 'px-3 py-1 text-sm rounded bg-indigo-600 text-white hover:bg-indigo-700';
+    go.textContent = 'Lanjutkan di sana';
+    go.onclick = () => { box.remove(); onAccept(); };
+    actions.appendChild(stay);
+    actions.appendChild(go);
+    box.appendChild(actions);
+
+    document.body.appendChild(box);
+}
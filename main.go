@@ -4,10 +4,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -51,17 +51,27 @@ type Book struct {
 	Type  string
 }
 type EbookHistoryItem struct {
-	ID           int    `json:"id"`
-	BookID       int    `json:"bookId"`
-	Title        string `json:"title"`
-	CoverFile    string `json:"coverFile"`
-	LastPage     int    `json:"lastPage"`
-	DateLastRead string `json:"dateLastRead"`
+	ID           int     `json:"id"`
+	BookID       int     `json:"bookId"`
+	Title        string  `json:"title"`
+	CoverFile    string  `json:"coverFile"`
+	LastPage     int     `json:"lastPage"`
+	Location     string  `json:"location,omitempty"` // EPUB CFI
+	Progress     float64 `json:"progress"`           // persen
+	DateLastRead string  `json:"dateLastRead"`
 }
 
 type EbookProgressRequest struct {
-	BookID int `json:"bookId"`
-	Page   int `json:"page"`
+	BookID   int     `json:"bookId"`
+	Page     int     `json:"page"`
+	Location string  `json:"location"` // EPUB CFI, mis. epubcfi(/6/4!/4/2/1:0)
+	Progress float64 `json:"progress"`
+	// Opsional: jika diisi, penyimpanan progres juga dicatat sebagai event "page" (lihat reading_stats.go)
+	SessionID string `json:"sessionId"`
+	// Sinkronisasi antar perangkat (lihat progress_sync.go); ClientTime dalam ms epoch
+	DeviceID   string `json:"deviceId"`
+	DeviceName string `json:"deviceName"`
+	ClientTime int64  `json:"clientTime"`
 }
 
 type Bookmark struct {
@@ -334,7 +344,8 @@ func initDB() {
 		description TEXT,
 		coverFile VARCHAR(255),
 		ebookFile VARCHAR(255),
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NULL DEFAULT NULL
 	);
 `
 
@@ -389,6 +400,174 @@ func initDB() {
         UNIQUE KEY unique_user_book (userId, bookId)
     );`
 
+	// anotasi ebook: bookmark halaman, highlight & catatan
+	createEbookAnnotations := `
+        CREATE TABLE IF NOT EXISTS ebook_annotations (
+        id INT AUTO_INCREMENT PRIMARY KEY,
+        userId INT NOT NULL,
+        bookId INT NOT NULL,
+        kind ENUM('bookmark', 'highlight', 'note') NOT NULL,
+        page INT NOT NULL,
+        anchorStart INT NULL,
+        anchorEnd INT NULL,
+        quote TEXT,
+        color VARCHAR(20) NULL,
+        note TEXT,
+        createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+        updatedAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+        FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (bookId) REFERENCES books(id) ON DELETE CASCADE,
+        INDEX idx_user_book_page (userId, bookId, page)
+    );`
+
+	// peminjaman digital ebook & antreannya
+	createEbookLoans := []string{`
+        CREATE TABLE IF NOT EXISTS ebook_loans (
+        id INT AUTO_INCREMENT PRIMARY KEY,
+        userId INT NOT NULL,
+        bookId INT NOT NULL,
+        status ENUM('aktif', 'dikembalikan', 'kedaluwarsa') NOT NULL DEFAULT 'aktif',
+        borrowedAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+        dueAt DATETIME NOT NULL,
+        returnedAt DATETIME NULL,
+
+        FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (bookId) REFERENCES books(id) ON DELETE CASCADE,
+        INDEX idx_book_status (bookId, status),
+        INDEX idx_user_status (userId, status)
+    );`, `
+        CREATE TABLE IF NOT EXISTS ebook_waitlist (
+        id INT AUTO_INCREMENT PRIMARY KEY,
+        userId INT NOT NULL,
+        bookId INT NOT NULL,
+        createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+        holdUntil DATETIME NULL,
+
+        FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (bookId) REFERENCES books(id) ON DELETE CASCADE,
+        UNIQUE KEY unique_user_book (userId, bookId)
+    );`}
+
+	// jejak watermark ebook (kode lacak -> peminjam)
+	createEbookWatermarks := `
+        CREATE TABLE IF NOT EXISTS ebook_watermarks (
+        id INT AUTO_INCREMENT PRIMARY KEY,
+        userId INT NOT NULL,
+        bookId INT NOT NULL,
+        traceCode VARCHAR(32) NOT NULL,
+        mode VARCHAR(20) NOT NULL,
+        createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+        FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (bookId) REFERENCES books(id) ON DELETE CASCADE,
+        UNIQUE KEY unique_trace (traceCode)
+    );`
+
+	// teks ebook per halaman / bab untuk pencarian isi (lihat ebook_text.go)
+	createEbookText := []string{`
+        CREATE TABLE IF NOT EXISTS ebook_text_index (
+        bookId INT PRIMARY KEY,
+        ebookFile VARCHAR(255) NOT NULL,
+        fileVersion VARCHAR(64) NOT NULL,
+        status ENUM('selesai', 'gagal') NOT NULL,
+        pages INT NOT NULL DEFAULT 0,
+        error VARCHAR(255) NULL,
+        indexedAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+        FOREIGN KEY (bookId) REFERENCES books(id) ON DELETE CASCADE
+    );`, `
+        CREATE TABLE IF NOT EXISTS ebook_text_pages (
+        id INT AUTO_INCREMENT PRIMARY KEY,
+        bookId INT NOT NULL,
+        page INT NOT NULL,
+        href VARCHAR(512) NULL,
+        content MEDIUMTEXT NOT NULL,
+        terms MEDIUMTEXT NOT NULL,
+
+        FOREIGN KEY (bookId) REFERENCES books(id) ON DELETE CASCADE,
+        INDEX idx_book_page (bookId, page),
+        FULLTEXT KEY ft_terms (terms)
+    );`}
+
+	// thumbnail, WebP & warna dominan per file sampul (lihat covers.go)
+	createCoverVariants := `
+        CREATE TABLE IF NOT EXISTS cover_variants (
+        coverFile VARCHAR(255) PRIMARY KEY,
+        status ENUM('selesai', 'gagal') NOT NULL,
+        width INT NOT NULL DEFAULT 0,
+        height INT NOT NULL DEFAULT 0,
+        color CHAR(7) NULL,
+        variants TEXT NULL,
+        error VARCHAR(255) NULL,
+        processedAt DATETIME DEFAULT CURRENT_TIMESTAMP
+    );`
+
+	// event sesi baca (append-only) & ringkasan per sesi (lihat reading_stats.go)
+	createReadingAnalytics := []string{`
+        CREATE TABLE IF NOT EXISTS reading_events (
+        id BIGINT AUTO_INCREMENT PRIMARY KEY,
+        userId INT NOT NULL,
+        bookId INT NOT NULL,
+        sessionId VARCHAR(36) NOT NULL,
+        kind ENUM('start', 'page', 'end') NOT NULL,
+        page INT NOT NULL DEFAULT 0,
+        location VARCHAR(1024) NULL,
+        progress DECIMAL(5,2) NOT NULL DEFAULT 0,
+        createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+        FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (bookId) REFERENCES books(id) ON DELETE CASCADE,
+        INDEX idx_user_time (userId, createdAt),
+        INDEX idx_book_time (bookId, createdAt),
+        INDEX idx_session (sessionId)
+    );`, `
+        CREATE TABLE IF NOT EXISTS reading_sessions (
+        sessionId VARCHAR(36) PRIMARY KEY,
+        userId INT NOT NULL,
+        bookId INT NOT NULL,
+        startedAt DATETIME NOT NULL,
+        lastEventAt DATETIME NOT NULL,
+        endedAt DATETIME NULL,
+        seconds INT NOT NULL DEFAULT 0,
+        pagesTurned INT NOT NULL DEFAULT 0,
+        lastPage INT NOT NULL DEFAULT 0,
+        maxPage INT NOT NULL DEFAULT 0,
+        maxProgress DECIMAL(5,2) NOT NULL DEFAULT 0,
+
+        FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (bookId) REFERENCES books(id) ON DELETE CASCADE,
+        INDEX idx_user_started (userId, startedAt),
+        INDEX idx_book_started (bookId, startedAt)
+    );`}
+
+	// perangkat member & posisi baca terakhir tiap perangkat (lihat progress_sync.go)
+	createEbookDevices := []string{`
+        CREATE TABLE IF NOT EXISTS ebook_devices (
+        userId INT NOT NULL,
+        deviceId VARCHAR(64) NOT NULL,
+        name VARCHAR(100) NOT NULL,
+        lastSeenAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+        PRIMARY KEY (userId, deviceId),
+        FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+    );`, `
+        CREATE TABLE IF NOT EXISTS ebook_progress_devices (
+        userId INT NOT NULL,
+        bookId INT NOT NULL,
+        deviceId VARCHAR(64) NOT NULL,
+        page INT NOT NULL DEFAULT 0,
+        location VARCHAR(1024) NULL,
+        progress DECIMAL(5,2) NOT NULL DEFAULT 0,
+        clientAt DATETIME(3) NOT NULL,
+        updatedAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+        PRIMARY KEY (userId, bookId, deviceId),
+        FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (bookId) REFERENCES books(id) ON DELETE CASCADE,
+        INDEX idx_user_device (userId, deviceId)
+    );`}
+
 	createBookmarks := `
         CREATE TABLE IF NOT EXISTS bookmarks (
         id INT AUTO_INCREMENT PRIMARY KEY,
@@ -426,6 +605,102 @@ func initDB() {
         FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
     );`
 
+	// genre & penulis ternormalisasi (books.genre / books.author jadi cache teks)
+	createTaxonomyTables := []string{`
+        CREATE TABLE IF NOT EXISTS genres (
+        id INT AUTO_INCREMENT PRIMARY KEY,
+        name VARCHAR(100) NOT NULL,
+        slug VARCHAR(120) NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE KEY unique_slug (slug)
+    );`, `
+        CREATE TABLE IF NOT EXISTS book_genres (
+        book_id INT NOT NULL,
+        genre_id INT NOT NULL,
+        position INT DEFAULT 0,
+        PRIMARY KEY (book_id, genre_id),
+        FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+        FOREIGN KEY (genre_id) REFERENCES genres(id) ON DELETE CASCADE
+    );`, `
+        CREATE TABLE IF NOT EXISTS authors (
+        id INT AUTO_INCREMENT PRIMARY KEY,
+        name VARCHAR(255) NOT NULL,
+        slug VARCHAR(255) NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE KEY unique_slug (slug)
+    );`, `
+        CREATE TABLE IF NOT EXISTS book_authors (
+        book_id INT NOT NULL,
+        author_id INT NOT NULL,
+        position INT DEFAULT 0,
+        PRIMARY KEY (book_id, author_id),
+        FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+        FOREIGN KEY (author_id) REFERENCES authors(id) ON DELETE CASCADE
+    );`}
+
+	// ulasan & rating buku (1 ulasan per member per buku)
+	createBookReviews := `
+        CREATE TABLE IF NOT EXISTS book_reviews (
+        id INT AUTO_INCREMENT PRIMARY KEY,
+        bookId INT NOT NULL,
+        userId INT NOT NULL,
+        rating TINYINT NOT NULL,
+        review TEXT,
+        status ENUM('tampil', 'disembunyikan') DEFAULT 'tampil',
+        moderationNote VARCHAR(255),
+        moderatedBy INT NULL,
+        createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+        updatedAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+        FOREIGN KEY (bookId) REFERENCES books(id) ON DELETE CASCADE,
+        FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+        UNIQUE KEY unique_user_book (userId, bookId)
+    );`
+
+	// rak baca member; rak default menggantikan tabel bookmarks
+	createShelves := []string{`
+        CREATE TABLE IF NOT EXISTS shelves (
+        id INT AUTO_INCREMENT PRIMARY KEY,
+        userId INT NOT NULL,
+        name VARCHAR(100) NOT NULL,
+        description TEXT,
+        isDefault TINYINT(1) NOT NULL DEFAULT 0,
+        isPublic TINYINT(1) NOT NULL DEFAULT 0,
+        shareToken VARCHAR(64) NULL,
+        createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+        updatedAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+        FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+        UNIQUE KEY unique_user_name (userId, name),
+        UNIQUE KEY unique_share_token (shareToken)
+    );`, `
+        CREATE TABLE IF NOT EXISTS shelf_items (
+        id INT AUTO_INCREMENT PRIMARY KEY,
+        shelfId INT NOT NULL,
+        bookId INT NOT NULL,
+        position INT NOT NULL DEFAULT 0,
+        note TEXT,
+        addedAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+        FOREIGN KEY (shelfId) REFERENCES shelves(id) ON DELETE CASCADE,
+        FOREIGN KEY (bookId) REFERENCES books(id) ON DELETE CASCADE,
+        UNIQUE KEY unique_shelf_book (shelfId, bookId)
+    );`}
+
+	// token feed OPDS per user (untuk aplikasi e-reader)
+	createOpdsTokens := `
+        CREATE TABLE IF NOT EXISTS opds_tokens (
+        id INT AUTO_INCREMENT PRIMARY KEY,
+        userId INT NOT NULL,
+        token VARCHAR(64) NOT NULL,
+        createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+        lastUsed DATETIME NULL,
+
+        FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+        UNIQUE KEY unique_user (userId),
+        UNIQUE KEY unique_token (token)
+    );`
+
 	if _, err = db.Exec(createUsers); err != nil {
 		log.Fatal("Error create users:", err)
 	}
@@ -444,14 +719,127 @@ func initDB() {
 	if _, err = db.Exec(createSuggestions); err != nil {
 		log.Fatal("Error create loans:", err)
 	}
+	if _, err = db.Exec(createOpdsTokens); err != nil {
+		log.Fatal("Error create opds_tokens:", err)
+	}
+	if _, err = db.Exec(createEbookAnnotations); err != nil {
+		log.Fatal("Error create ebook_annotations:", err)
+	}
+	if _, err = db.Exec(createEbookWatermarks); err != nil {
+		log.Fatal("Error create ebook_watermarks:", err)
+	}
+	for _, q := range createEbookLoans {
+		if _, err = db.Exec(q); err != nil {
+			log.Fatal("Error create ebook loans:", err)
+		}
+	}
+	for _, q := range createEbookText {
+		if _, err = db.Exec(q); err != nil {
+			log.Fatal("Error create ebook text index:", err)
+		}
+	}
+	if _, err = db.Exec(createCoverVariants); err != nil {
+		log.Fatal("Error create cover_variants:", err)
+	}
+	for _, q := range createReadingAnalytics {
+		if _, err = db.Exec(q); err != nil {
+			log.Fatal("Error create reading analytics:", err)
+		}
+	}
+	for _, q := range createEbookDevices {
+		if _, err = db.Exec(q); err != nil {
+			log.Fatal("Error create ebook devices:", err)
+		}
+	}
+	for _, q := range createShelves {
+		if _, err = db.Exec(q); err != nil {
+			log.Fatal("Error create shelves:", err)
+		}
+	}
+	if _, err = db.Exec(createBookReviews); err != nil {
+		log.Fatal("Error create book_reviews:", err)
+	}
+	for _, q := range createTaxonomyTables {
+		if _, err = db.Exec(q); err != nil {
+			log.Fatal("Error create genre/author tables:", err)
+		}
+	}
+
+	// --- Migrasi kolom untuk database yang sudah ada ---
+	// updated_at diisi saat metadata buku diubah (bukan saat stok berubah), dipakai sebagai datestamp OAI-PMH
+	ensureColumn("books", "updated_at", "TIMESTAMP NULL DEFAULT NULL")
+	// agregat rating dari book_reviews (diperbarui refreshBookRating)
+	ensureColumn("books", "rating_avg", "DECIMAL(3,2) NOT NULL DEFAULT 0")
+	ensureColumn("books", "rating_count", "INT NOT NULL DEFAULT 0")
+	// kebijakan akses ebook: member (semua member) / loan (harus sedang meminjam)
+	ensureColumn("books", "ebookAccess", "VARCHAR(20) NOT NULL DEFAULT 'member'")
+	// peminjaman digital: jumlah lisensi bersamaan (0 = tanpa batas) & lama pinjam
+	ensureColumn("books", "ebookLicenses", "INT NOT NULL DEFAULT 0")
+	ensureColumn("books", "ebookLoanDays", "INT NOT NULL DEFAULT 14")
+	// format ebook (pdf / epub) & daftar isi EPUB (JSON)
+	ensureColumn("books", "ebookFormat", "VARCHAR(10) NULL")
+	ensureColumn("books", "ebookToc", "MEDIUMTEXT NULL")
+	// posisi baca EPUB (CFI) & persentase progres
+	ensureColumn("ebook_history", "lastLocation", "VARCHAR(1024) NULL")
+	ensureColumn("ebook_history", "progress", "DECIMAL(5,2) NOT NULL DEFAULT 0")
+	// perangkat yang terakhir menentukan posisi utama & waktu kliennya
+	ensureColumn("ebook_history", "lastDeviceId", "VARCHAR(64) NULL")
+	ensureColumn("ebook_history", "lastClientAt", "DATETIME(3) NULL")
+	// jumlah halaman ebook (PDF: halaman, EPUB: bab spine) untuk persentase tamat
+	ensureColumn("books", "ebookPages", "INT NOT NULL DEFAULT 0")
+	// percobaan proses sampul yang gagal, dasar jeda coba ulang (lihat covers.go)
+	ensureColumn("cover_variants", "attempts", "INT NOT NULL DEFAULT 0")
+
+	// --- Migrasi data: pecah books.genre / books.author ke tabel relasi ---
+	migrateBookTaxonomy()
+	// --- Migrasi data: bookmarks lama -> rak default ---
+	migrateBookmarksToShelves()
+	// --- Migrasi data: format & daftar isi ebook lama ---
+	migrateEbookFormats()
 
 	fmt.Println("✅ Tables ensured (created if not exists).")
 }
 
+// Tambah kolom ke tabel lama jika belum ada (MySQL belum mendukung ADD COLUMN IF NOT EXISTS).
+// Mengembalikan true jika kolom baru saja ditambahkan.
+func ensureColumn(table, column, definition string) bool {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`, table, column).Scan(&count)
+	if err != nil {
+		log.Fatal("Error cek kolom "+table+"."+column+":", err)
+	}
+	if count > 0 {
+		return false
+	}
+
+	if _, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition); err != nil {
+		log.Fatal("Error tambah kolom "+table+"."+column+":", err)
+	}
+	fmt.Println("✅ Kolom ditambahkan:", table+"."+column)
+	return true
+}
+
 func main() {
+	initBlobStore()
 	initDB()
 	defer db.Close()
 
+	// Perintah satu kali: pindahkan file lama ke backend penyimpanan aktif
+	if len(os.Args) > 1 && os.Args[1] == "migrate-storage" {
+		migrateStorage()
+		return
+	}
+
+	// Index full-text dibangun di background agar startup tidak tertahan
+	go rebuildBookIndex()
+	// Model rekomendasi dibangun ulang berkala di background
+	startRecommender()
+	startEbookLoanSweeper()
+	startEbookTextIndexer()
+	startCoverProcessor()
+
 	ensureUploadFolders()
 
 	var err error
@@ -465,12 +853,20 @@ func main() {
 
 	http.HandleFunc("/api/member/borrow", handleBorrowBook)
 	http.HandleFunc("/api/books/random", randomBooksHandler)
+	http.HandleFunc("/api/books/suggest", suggestBooksHandler)
+	http.HandleFunc("/api/recommendations/home", homeRecommendationsHandler)
+	http.HandleFunc("/api/recommendations/similar", similarBooksHandler)
+	http.HandleFunc("/api/admin/recommendations/rebuild", rebuildRecommendationsHandler)
+	http.HandleFunc("/api/feeds", bookFeedHandler)  // daftar feed
+	http.HandleFunc("/api/feeds/", bookFeedHandler) // /api/feeds/{popular|trending|most-read|most-bookmarked|new}[.json|.atom|.rss]
 	// static file
 	http.Handle("/js/", http.StripPrefix("/js/", http.FileServer(http.Dir("./js"))))
 
 	http.Handle("/css/", http.StripPrefix("/css/", http.FileServer(http.Dir("./css"))))
 
-	http.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads"))))
+	http.Handle("/uploads/", uploadsFileServer()) // kecuali uploads/ebooks
+	// ebook hanya lewat URL bertanda tangan
+	http.HandleFunc("/ebooks/stream/", ebookStreamHandler)
 
 	http.Handle("/img/", http.StripPrefix("/img/", http.FileServer(http.Dir("./img"))))
 
@@ -509,12 +905,28 @@ func main() {
 
 	http.HandleFunc("/books", listBooksHandler)
 
+	// export katalog (CSV / JSON Lines / MARC21 / MARCXML)
+	http.HandleFunc("/books/export", exportBooksHandler)
+
 	// hapus buku
 	http.HandleFunc("/books/", deleteBookByIDHandler)
 
 	// uPDATE BUKU
 	http.HandleFunc("/books/update", updateBookHandler)
 
+	// import katalog massal (CSV/XLSX)
+	http.HandleFunc("/api/admin/books/import", bookImportHandler)              // POST (upload, dryRun opsional)
+	http.HandleFunc("/api/admin/books/import/status", bookImportStatusHandler) // GET (progress & laporan error)
+	http.HandleFunc("/api/admin/books/import/marc", marcImportHandler)         // POST (MARC21 / MARCXML)
+
+	// Kurasi genre & penulis
+	http.HandleFunc("/api/genres", taxonomyListHandler(genreTaxonomy))
+	http.HandleFunc("/api/authors", taxonomyListHandler(authorTaxonomy))
+	http.HandleFunc("/api/admin/genres", taxonomyAdminHandler(genreTaxonomy, "/api/admin/genres"))
+	http.HandleFunc("/api/admin/genres/", taxonomyAdminHandler(genreTaxonomy, "/api/admin/genres"))
+	http.HandleFunc("/api/admin/authors", taxonomyAdminHandler(authorTaxonomy, "/api/admin/authors"))
+	http.HandleFunc("/api/admin/authors/", taxonomyAdminHandler(authorTaxonomy, "/api/admin/authors"))
+
 	http.HandleFunc("/buka_buku_admin.html", bukaBukuAdminHandler)
 
 	http.HandleFunc("/buka_buku_member.html", bukaBukuMemberHandler)
@@ -575,13 +987,40 @@ func main() {
 	http.HandleFunc("/baca_buku", bacaBukuPageHandler)
 
 	// API Ebook Progress & History
-	http.HandleFunc("/api/ebook/history", ebookHistoryAPIHandler)   // GET (List), DELETE (Hapus satu)
-	http.HandleFunc("/api/ebook/progress", ebookProgressAPIHandler) // POST (Simpan), GET (Ambil last page)
+	http.HandleFunc("/api/ebook/history", ebookHistoryAPIHandler)          // GET (List), DELETE (Hapus satu)
+	http.HandleFunc("/api/ebook/progress", ebookProgressAPIHandler)        // POST (Simpan), GET (Ambil last page)
+	http.HandleFunc("/api/ebook/loans", ebookLoansAPIHandler)              // GET (pinjaman saya), POST (pinjam)
+	http.HandleFunc("/api/ebook/loans/", ebookLoansAPIHandler)             // GET /status?bookId=, POST /return
+	http.HandleFunc("/api/ebook/waitlist", ebookWaitlistAPIHandler)        // POST (antre), DELETE (keluar antrean)
+	http.HandleFunc("/api/admin/ebook/watermarks", watermarkLookupHandler) // GET ?code= (telusuri salinan bocor)
+	http.HandleFunc("/api/admin/ebook/stats", adminReadingStatsHandler)    // GET ?from=&to=&format=csv (agregat per judul)
+	http.HandleFunc("/api/ebook/toc", ebookTOCHandler)                     // GET (format & daftar isi)
+	http.HandleFunc("/api/ebook/search", ebookSearchHandler)               // GET (cari di isi ebook)
+	http.HandleFunc("/api/ebook/events", readingEventsHandler)             // POST (event sesi baca: start, page, end)
+	http.HandleFunc("/api/ebook/stats", readingStatsHandler)               // GET (statistik baca saya)
+	http.HandleFunc("/api/ebook/devices", ebookDevicesHandler)             // GET (perangkat & posisi terakhir), DELETE ?deviceId=
+	http.HandleFunc("/api/ebook/url", ebookURLAPIHandler)                  // GET (URL baca bertanda tangan)
+	http.HandleFunc("/api/ebook/annotations", ebookAnnotationsAPIHandler)  // GET (List per buku), POST (Buat)
+	http.HandleFunc("/api/ebook/annotations/", ebookAnnotationsAPIHandler) // PUT/DELETE /{id}, GET /export?format=md|pdf
 	// bookmark
 	http.HandleFunc("/bookmark", bookmarkHandler)
 	http.HandleFunc("/bookmark/status", checkBookmarkHandler)
 	http.HandleFunc("/bookmarkpage", bookmarkPageHandler)
 	http.HandleFunc("/api/bookmarks", getBookmarksHandler)
+	http.HandleFunc("/api/shelves", shelvesAPIHandler)  // rak baca: GET (list), POST (buat)
+	http.HandleFunc("/api/shelves/", shelvesAPIHandler) // detail, items, order, share, shared/{token}
+
+	// Ulasan & rating buku
+	http.HandleFunc("/api/reviews", reviewsAPIHandler)                    // GET (publik), POST (buat/ubah), DELETE
+	http.HandleFunc("/api/admin/reviews", adminReviewsHandler)            // GET (semua ulasan)
+	http.HandleFunc("/api/admin/reviews/moderate", moderateReviewHandler) // POST (tampil / disembunyikan)
+	// OAI-PMH untuk harvesting metadata oleh jaringan perpustakaan
+	http.HandleFunc("/oai", oaiHandler)
+
+	// OPDS feed ebook untuk aplikasi e-reader
+	http.HandleFunc("/opds", opdsHandler)
+	http.HandleFunc("/opds/", opdsHandler)
+	http.HandleFunc("/api/opds/token", opdsTokenHandler) // GET (ambil token), POST (buat ulang)
 	// --- FEEDBACK / KRITIK SARAN ---
 	// Halaman Page
 	http.HandleFunc("/feedback", feedbackPageHandler)
@@ -753,46 +1192,29 @@ func renderTemplate(w http.ResponseWriter, name string, data interface{}) {
 }
 
 func ensureUploadFolders() {
-	paths := []string{
-		"uploads",
-		"uploads/covers",
-		"uploads/ebooks",
-		"uploads/users",
-	}
-
-	for _, path := range paths {
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			err := os.MkdirAll(path, os.ModePerm)
-			if err != nil {
-				log.Fatalf("Gagal membuat folder %s: %v", path, err)
+	// Folder lokal hanya dibutuhkan backend disk
+	if _, ok := blobs.(*localBlobStore); ok {
+		paths := []string{
+			"uploads",
+			"uploads/covers",
+			"uploads/ebooks",
+			"uploads/users",
+		}
+
+		for _, path := range paths {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				err := os.MkdirAll(path, os.ModePerm)
+				if err != nil {
+					log.Fatalf("Gagal membuat folder %s: %v", path, err)
+				}
+				fmt.Println("✅ Folder dibuat:", path)
 			}
-			fmt.Println("✅ Folder dibuat:", path)
 		}
 	}
 
-	// Salin default_user.png jika belum ada
-	defaultFile := "uploads/users/default_user.png"
-	if _, err := os.Stat(defaultFile); os.IsNotExist(err) {
-		src, err := os.Open("img/default_user.png")
-		if err != nil {
-			log.Println("⚠ Warning: img/default_user.png tidak ditemukan")
-			return
-		}
-		defer src.Close()
-
-		dst, err := os.Create(defaultFile)
-		if err != nil {
-			log.Println("⚠ Gagal membuat default_user.png di uploads/users/")
-			return
-		}
-		defer dst.Close()
-
-		if _, err := io.Copy(dst, src); err != nil {
-			log.Println("⚠ Gagal menyalin default_user.png:", err)
-		} else {
-			fmt.Println("✅ default_user.png berhasil disalin ke uploads/users/")
-		}
-	}
+	// Foto profil & sampul default harus ada di backend mana pun
+	ensureBlobFromFile(defaultUserPath, "img/default_user.png")
+	ensureBlobFromFile(defaultCoverPath, "uploads/covers/default_cover.jpg")
 }
 
 func loginHandler(w http.ResponseWriter, r *http.Request) {
@@ -1033,10 +1455,27 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 	otp := generateOTP()
 	expires := time.Now().Add(5 * time.Minute)
 
+	// Foto profil dari form (data URL) disimpan sebagai file, database cukup menyimpan path-nya
+	profilePicture := ""
+	if profilePictureData != "" {
+		up, err := saveDataURLUpload(profilePictureData, uploadKindUser)
+		if err != nil {
+			if isUploadError(err) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				log.Println("Gagal menyimpan foto profil:", err)
+				http.Error(w, "Gagal menyimpan foto profil", http.StatusInternalServerError)
+			}
+			return
+		}
+		profilePicture = up.Path
+	}
+
 	// Cek apakah user sudah ada
 	var userID int
 	var verified bool
-	err = db.QueryRow("SELECT id, verified FROM users WHERE email = ?", email).Scan(&userID, &verified)
+	var oldPicture sql.NullString
+	err = db.QueryRow("SELECT id, verified, profile_picture FROM users WHERE email = ?", email).Scan(&userID, &verified, &oldPicture)
 
 	if err != nil && err != sql.ErrNoRows {
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
@@ -1049,10 +1488,11 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 			INSERT INTO users(fullname, alamat, phone, email, username, password, role, otp_code, otp_expires, verified, profile_picture)
 			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			nama, alamat, nohp, email, username, string(hashedPassword),
-			"member", otp, expires, false, profilePictureData,
+			"member", otp, expires, false, profilePicture,
 		)
 		if err != nil {
 			log.Println("Gagal insert user:", err)
+			releaseUpload(profilePicture)
 
 			// Tangani duplicate username
 			if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
@@ -1079,13 +1519,17 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 			UPDATE users
 			SET fullname=?, alamat=?, phone=?, username=?, password=?, otp_code=?, otp_expires=?, profile_picture=?
 			WHERE id=?`,
-			nama, alamat, nohp, username, string(hashedPassword), otp, expires, profilePictureData, userID,
+			nama, alamat, nohp, username, string(hashedPassword), otp, expires, profilePicture, userID,
 		)
 		if err != nil {
 			log.Println("Gagal update user:", err)
+			releaseUpload(profilePicture)
 			http.Error(w, "Gagal memperbarui data user", http.StatusInternalServerError)
 			return
 		}
+		if oldPicture.String != profilePicture {
+			releaseUpload(oldPicture.String)
+		}
 		log.Println("User berhasil diperbarui dengan ID:", userID)
 	}
 
@@ -1286,6 +1730,36 @@ func resetPasswordPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Tipe buku yang diizinkan (sama dengan ENUM kolom books.type)
+var validBookTypes = map[string]bool{
+	"Buku Fisik":    true,
+	"Ebook":         true,
+	"Fisik & Ebook": true,
+}
+
+// validateBookFields memvalidasi field angka & tipe buku.
+// Dipakai addBookHandler dan import massal agar aturannya sama.
+// Jika tidak valid, msg berisi pesan error untuk user.
+func validateBookFields(yearStr, stockMaxStr, fineAmountStr, bookType string) (year, stockMax, fineAmount int, msg string) {
+	var err error
+	year, err = strconv.Atoi(strings.TrimSpace(yearStr))
+	if err != nil {
+		return 0, 0, 0, "Tahun tidak valid"
+	}
+	stockMax, err = strconv.Atoi(strings.TrimSpace(stockMaxStr))
+	if err != nil {
+		return 0, 0, 0, "Stock Max tidak valid"
+	}
+	fineAmount, err = strconv.Atoi(strings.TrimSpace(fineAmountStr))
+	if err != nil {
+		return 0, 0, 0, "Fine Amount tidak valid"
+	}
+	if bookType != "" && !validBookTypes[bookType] {
+		return 0, 0, 0, "Tipe buku tidak valid"
+	}
+	return year, stockMax, fineAmount, ""
+}
+
 // Handler tambah buku
 func addBookHandler(w http.ResponseWriter, r *http.Request) {
 	type JSONResponse struct {
@@ -1305,14 +1779,15 @@ func addBookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse form dengan batas maksimal 20MB
+	// Body dibatasi sesuai batas ukuran sampul + ebook; form 20MB di memori, sisanya file sementara
+	r.Body = http.MaxBytesReader(w, r.Body, bookFormMaxBytes())
 	err := r.ParseMultipartForm(20 << 20)
 	if err != nil {
 		log.Println("ParseMultipartForm error:", err)
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(JSONResponse{
 			Success: false,
-			Message: "Gagal membaca form: " + err.Error(),
+			Message: "Gagal membaca form atau file terlalu besar: " + err.Error(),
 		})
 		return
 	}
@@ -1330,92 +1805,109 @@ func addBookHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("Form values:", title, author, yearStr, genre, category, bookType, stockMaxStr, fineAmountStr)
 
-	year, err := strconv.Atoi(yearStr)
-	if err != nil {
-		log.Println("Invalid year:", yearStr)
+	year, stockMax, fineAmount, msg := validateBookFields(yearStr, stockMaxStr, fineAmountStr, bookType)
+	if msg != "" {
+		log.Println("Invalid book form:", msg)
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(JSONResponse{false, "Tahun tidak valid"})
+		json.NewEncoder(w).Encode(JSONResponse{false, msg})
 		return
 	}
-	stockMax, err := strconv.Atoi(stockMaxStr)
-	if err != nil {
-		log.Println("Invalid stockMax:", stockMaxStr)
+
+	// Validasi ebook (PDF / EPUB) sebelum apa pun disimpan
+	if f, h, err := r.FormFile("ebook"); err == nil {
+		_, epub, err := inspectEbookUpload(f, h)
+		f.Close()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(JSONResponse{false, err.Error()})
+			return
+		}
+		// Judul / penulis kosong diisi dari metadata EPUB
+		if epub != nil {
+			if strings.TrimSpace(title) == "" {
+				title = epub.Title
+			}
+			if strings.TrimSpace(author) == "" {
+				author = strings.Join(epub.Authors, ", ")
+			}
+		}
+	}
+
+	ebookAccess := r.FormValue("ebookAccess")
+	if ebookAccess == "" {
+		ebookAccess = ebookAccessMember
+	}
+	if !validEbookAccess(ebookAccess) {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(JSONResponse{false, "Stock Max tidak valid"})
+		json.NewEncoder(w).Encode(JSONResponse{false, "Akses ebook harus member atau loan"})
 		return
 	}
-	fineAmount, err := strconv.Atoi(fineAmountStr)
-	if err != nil {
-		log.Println("Invalid fineAmount:", fineAmountStr)
+	licenses, loanDays, msg := parseEbookLicenseForm(r)
+	if msg != "" {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(JSONResponse{false, "Fine Amount tidak valid"})
+		json.NewEncoder(w).Encode(JSONResponse{false, msg})
 		return
 	}
+	ebookLicenses, ebookLoanDays := 0, defaultEbookLoanDays
+	if licenses != nil {
+		ebookLicenses = *licenses
+	}
+	if loanDays != nil {
+		ebookLoanDays = *loanDays
+	}
 
-	// Upload cover
-	var coverPath string
-	coverFile, coverHeader, err := r.FormFile("cover")
-	if err == nil {
-		defer coverFile.Close()
-		coverPath = "uploads/covers/" + coverHeader.Filename
-		log.Println("Uploading cover to:", coverPath)
-		dst, err := os.Create(coverPath)
-		if err != nil {
-			log.Println("Create cover file error:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(JSONResponse{false, "Gagal menyimpan cover: " + err.Error()})
-			return
-		}
-		defer dst.Close()
-		_, err = io.Copy(dst, coverFile)
-		if err != nil {
-			log.Println("Copy cover file error:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(JSONResponse{false, "Gagal menyalin cover: " + err.Error()})
-			return
-		}
-	} else {
-		log.Println("No cover uploaded, using default cover")
-		coverPath = "uploads/covers/default_cover.jpg"
+	// Upload cover & ebook lewat layanan upload (nama file = hash isi)
+	coverPath := defaultCoverPath
+	cover, err := saveFormUpload(r, "cover", uploadKindCover)
+	if err != nil {
+		log.Println("Upload cover error:", err)
+		writeUploadError(w, err)
+		return
+	}
+	if cover != nil {
+		coverPath = cover.Path
 	}
 
-	// Upload ebook
 	var ebookPath string
-	ebookFile, ebookHeader, err := r.FormFile("ebook")
-	if err == nil {
-		defer ebookFile.Close()
-		ebookPath = "uploads/ebooks/" + ebookHeader.Filename
-		log.Println("Uploading ebook to:", ebookPath)
-		dst, err := os.Create(ebookPath)
-		if err != nil {
-			log.Println("Create ebook file error:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(JSONResponse{false, "Gagal menyimpan ebook: " + err.Error()})
-			return
-		}
-		defer dst.Close()
-		_, err = io.Copy(dst, ebookFile)
-		if err != nil {
-			log.Println("Copy ebook file error:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(JSONResponse{false, "Gagal menyalin ebook: " + err.Error()})
+	ebook, err := saveFormUpload(r, "ebook", uploadKindEbook)
+	if err != nil {
+		log.Println("Upload ebook error:", err)
+		releaseUpload(coverPath)
+		writeUploadError(w, err)
+		return
+	}
+	if ebook != nil {
+		ebookPath = ebook.Path
+		if _, dupTitle, dup := ebookDuplicateOf(ebookPath, 0); dup {
+			releaseUpload(coverPath)
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(JSONResponse{false, "Ebook yang sama sudah dipakai buku \"" + dupTitle + "\""})
 			return
 		}
-	} else {
-		log.Println("No ebook uploaded or error:", err)
 	}
 
 	// Insert ke database
 	query := `INSERT INTO books 
-        (title, author, year, genre, category, ` + "`type`" + `, location, stockMax, fineAmount, description, coverFile, ebookFile)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+        (title, author, year, genre, category, ` + "`type`" + `, location, stockMax, fineAmount, description, coverFile, ebookFile, ebookAccess, ebookLicenses, ebookLoanDays)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err = db.Exec(query, title, author, year, genre, category, bookType, location, stockMax, fineAmount, description, coverPath, ebookPath)
+	res, err := db.Exec(query, title, author, year, genre, category, bookType, location, stockMax, fineAmount, description, coverPath, ebookPath, ebookAccess, ebookLicenses, ebookLoanDays)
 	if err != nil {
+		releaseUpload(coverPath)
+		releaseUpload(ebookPath)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(JSONResponse{false, "Gagal menambahkan buku: " + err.Error()})
 		return
 	}
+	queueCoverProcessing(coverPath)
+	if newID, err := res.LastInsertId(); err == nil {
+		if ebookPath != "" {
+			applyEbookMetadata(int(newID), ebookPath)
+			queueEbookText(int(newID))
+		}
+		syncBookTaxonomy(int(newID), genre, author)
+		reindexBook(int(newID))
+	}
 
 	log.Println("Book successfully added:", title)
 	json.NewEncoder(w).Encode(JSONResponse{true, "Buku berhasil ditambahkan!"})
@@ -1423,6 +1915,27 @@ func addBookHandler(w http.ResponseWriter, r *http.Request) {
 func randomBooksHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	// Pakai feed rekomendasi jika model sudah siap (format response tetap sama)
+	if m := currentRecommendModel(); m != nil {
+		feed := m.homeFeed(getCurrentUser(r).ID, 5)
+		if len(feed) > 0 {
+			booksList := make([]map[string]interface{}, 0, len(feed))
+			for _, b := range feed {
+				booksList = append(booksList, map[string]interface{}{
+					"id":       b.ID,
+					"title":    b.Title,
+					"author":   b.Author,
+					"synopsis": b.Synopsis,
+					"cover":    b.Cover,
+					"reason":   b.Reason,
+				})
+			}
+			json.NewEncoder(w).Encode(booksList)
+			return
+		}
+	}
+
+	// Fallback: model belum siap / katalog kosong
 	// Query mengambil 5 buku acak dari MySQL
 	// Pastikan kolom description ada, jika di DB namanya 'description' kita ambil sebagai synopsis
 	rows, err := db.Query(`
@@ -1469,21 +1982,72 @@ func listBooksHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	search := r.URL.Query().Get("search")
-	bookType := r.URL.Query().Get("type")
-	category := r.URL.Query().Get("category")
+	lq, err := parseBookListQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// search ditangani index full-text, filter lain tetap lewat buildBookFilters
+	q := r.URL.Query()
+	search := strings.TrimSpace(q.Get("search"))
+	q.Del("search")
+	conditions, args := buildBookFilters(q)
+	var searchConds []string
+	var searchArgs []interface{}
+	if search != "" {
+		searchConds, searchArgs = applyBookSearch(search, &lq, nil, nil)
+		conditions = append(conditions, searchConds...)
+		args = append(args, searchArgs...)
+	}
+
+	res, err := queryBookList("books b", conditions, args, lq)
+	if err != nil {
+		log.Println("Query error:", err)
+		http.Error(w, "Gagal mengambil data buku", http.StatusInternalServerError)
+		return
+	}
+
+	resp := bookListResponse(res, lq)
+
+	if len(lq.Facets) > 0 {
+		facets, err := computeBookFacets(q, searchConds, searchArgs, lq.Facets)
+		if err != nil {
+			log.Println("Facet error:", err)
+			http.Error(w, "Gagal menghitung facet", http.StatusInternalServerError)
+			return
+		}
+		resp.(map[string]interface{})["facets"] = facets
+	}
+
+	// Search tanpa hasil: tawarkan koreksi ejaan dari kosakata katalog
+	if search != "" && len(res.Books) == 0 {
+		if fix := didYouMean(search); fix != "" {
+			if envelope, ok := resp.(map[string]interface{}); ok {
+				envelope["didYouMean"] = fix
+			} else {
+				// Response array lama tidak punya tempat untuk field tambahan
+				w.Header().Set("X-Did-You-Mean", fix)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Bangun kondisi WHERE dari query filter /books (search, type, category, yearFrom/yearTo, genre[], author[]).
+// Dipakai bersama oleh listBooksHandler dan endpoint lain yang butuh filter yang sama.
+// Query pemanggil harus memberi alias "b" untuk tabel books.
+func buildBookFilters(q url.Values) ([]string, []interface{}) {
+	search := q.Get("search")
+	bookType := q.Get("type")
+	category := q.Get("category")
 
 	// UBAH: Ambil genre sebagai array/slice string
 	// URL contoh: /books?genre=Horor&genre=Komedi
-	genres := r.URL.Query()["genre"]
-
-	var rows *sql.Rows
-	var err error
+	genres := q["genre"]
 
-	baseQuery := `
-        SELECT id, title, author, year, genre, category, type, stockMax, fineAmount, description, coverFile, location, ebookFile
-        FROM books
-    `
 	var conditions []string
 	var args []interface{}
 
@@ -1525,61 +2089,35 @@ func listBooksHandler(w http.ResponseWriter, r *http.Request) {
 		args = append(args, category)
 	}
 
-	// 4. Filter Genre (MULTI TAG - AND LOGIC)
-	// Jika user memilih [Komedi, Horor], maka buku harus mengandung Komedi DAN Horor
-	if len(genres) > 0 {
-		for _, g := range genres {
-			if g != "" {
-				conditions = append(conditions, "LOWER(genre) LIKE LOWER(?)")
-				args = append(args, "%"+g+"%")
-			}
-		}
+	// 4. Filter Tahun (rentang, dipakai facet tahun/dekade)
+	if y, err := strconv.Atoi(q.Get("yearFrom")); err == nil {
+		conditions = append(conditions, "year >= ?")
+		args = append(args, y)
 	}
-
-	if len(conditions) > 0 {
-		baseQuery += " WHERE " + strings.Join(conditions, " AND ")
+	if y, err := strconv.Atoi(q.Get("yearTo")); err == nil {
+		conditions = append(conditions, "year <= ?")
+		args = append(args, y)
 	}
 
-	rows, err = db.Query(baseQuery, args...)
-	if err != nil {
-		log.Println("Query error:", err)
-		http.Error(w, "Gagal mengambil data buku", http.StatusInternalServerError)
-		return
+	// 5. Filter Genre (MULTI TAG - AND LOGIC)
+	// Jika user memilih [Komedi, Horor], maka buku harus punya tag Komedi DAN Horor.
+	// Dicocokkan persis lewat book_genres, jadi "Horor" tidak ikut cocok ke "Horor Komedi".
+	for _, g := range genres {
+		if slug := slugify(g); slug != "" {
+			conditions = append(conditions, taxonomyFilterCondition(genreTaxonomy))
+			args = append(args, slug)
+		}
 	}
-	defer rows.Close()
 
-	var booksList []map[string]interface{}
-	for rows.Next() {
-		var id int
-		var year, stockMax, fineAmount sql.NullInt64
-		// Tambahkan var ebookFileDB sql.NullString di sini
-		var title, author, genreDB, categoryDB, tipe, description, coverFile, location, ebookFileDB sql.NullString
-
-		// Update Scan: Tambahkan &ebookFileDB di paling akhir
-		if err := rows.Scan(&id, &title, &author, &year, &genreDB, &categoryDB, &tipe, &stockMax, &fineAmount, &description, &coverFile, &location, &ebookFileDB); err != nil {
-			log.Println("Scan error:", err)
-			continue
+	// 6. Filter Penulis (nama atau slug), bisa lebih dari satu: ?author=A&author=B
+	for _, a := range q["author"] {
+		if slug := slugify(a); slug != "" {
+			conditions = append(conditions, taxonomyFilterCondition(authorTaxonomy))
+			args = append(args, slug)
 		}
-
-		booksList = append(booksList, map[string]interface{}{
-			"id":          id,
-			"title":       title.String,
-			"author":      author.String,
-			"year":        int(year.Int64),
-			"genre":       genreDB.String,
-			"category":    categoryDB.String,
-			"type":        tipe.String,
-			"stock":       int(stockMax.Int64),
-			"fineAmount":  int(fineAmount.Int64),
-			"description": description.String,
-			"coverFile":   coverFile.String,
-			"location":    location.String,
-			"ebookFile":   ebookFileDB.String, // <-- Masukkan ke map response JSON
-		})
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(booksList)
+	return conditions, args
 }
 
 func bukaBukuAdminHandler(w http.ResponseWriter, r *http.Request) {
@@ -1625,6 +2163,10 @@ func deleteBookByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// File sampul & ebook dicatat dulu untuk dibersihkan setelah baris buku terhapus
+	var coverFile, ebookFile sql.NullString
+	db.QueryRow("SELECT coverFile, ebookFile FROM books WHERE id = ?", id).Scan(&coverFile, &ebookFile)
+
 	result, err := db.Exec("DELETE FROM books WHERE id = ?", id)
 	if err != nil {
 		http.Error(w, "Gagal menghapus buku dari database", http.StatusInternalServerError)
@@ -1636,6 +2178,12 @@ func deleteBookByIDHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Buku tidak ditemukan", http.StatusNotFound)
 		return
 	}
+	if bookID, err := strconv.Atoi(id); err == nil {
+		bookIndex.remove(bookID)
+		purgeWatermarkCache(bookID)
+	}
+	releaseUpload(coverFile.String)
+	releaseUpload(ebookFile.String)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
@@ -1649,7 +2197,8 @@ func updateBookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 1. Naikkan limit upload (misal 20MB) agar PDF bisa masuk
+	// 1. Batasi body sesuai batas ukuran sampul + ebook
+	r.Body = http.MaxBytesReader(w, r.Body, bookFormMaxBytes())
 	err := r.ParseMultipartForm(20 << 20)
 	if err != nil {
 		http.Error(w, "Gagal membaca form atau file terlalu besar", http.StatusBadRequest)
@@ -1680,37 +2229,54 @@ func updateBookHandler(w http.ResponseWriter, r *http.Request) {
 		fineAmount = 0
 	}
 
-	// --- [LOGIKA COVER - SUDAH ADA] ---
-	coverFile, headerCover, err := r.FormFile("cover")
-	coverPath := ""
-	if err == nil {
-		defer coverFile.Close()
-		coverPath = "uploads/covers/" + headerCover.Filename
-		// Pastikan folder ada
-		os.MkdirAll("uploads/covers", os.ModePerm)
-		f, err := os.Create(coverPath)
-		if err == nil {
-			defer f.Close()
-			io.Copy(f, coverFile)
+	bookID, _ := strconv.Atoi(id)
+
+	// --- EBOOK: validasi PDF / EPUB dari isi file ---
+	if ebookFile, headerEbook, err := r.FormFile("ebook"); err == nil {
+		_, _, err := inspectEbookUpload(ebookFile, headerEbook)
+		ebookFile.Close()
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
 		}
 	}
 
-	// --- [LOGIKA EBOOK - INI YANG ANDA KURANG] ---
-	ebookFile, headerEbook, err := r.FormFile("ebook")
-	ebookPath := ""
-	if err == nil { // Jika ada file ebook yang diupload
-		defer ebookFile.Close()
-		ebookPath = "uploads/ebooks/" + headerEbook.Filename
+	// File lama dicatat agar bisa dibersihkan setelah diganti
+	var oldCover, oldEbook sql.NullString
+	db.QueryRow("SELECT coverFile, ebookFile FROM books WHERE id = ?", id).Scan(&oldCover, &oldEbook)
 
-		// Buat folder jika belum ada
-		os.MkdirAll("uploads/ebooks", os.ModePerm)
-
-		f, err := os.Create(ebookPath)
-		if err == nil {
-			defer f.Close()
-			io.Copy(f, ebookFile)
-		} else {
-			log.Println("Gagal menyimpan file ebook:", err)
+	// --- SIMPAN FILE BARU (nama file = hash isi) ---
+	coverPath, ebookPath := "", ""
+	cover, err := saveFormUpload(r, "cover", uploadKindCover)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	if cover != nil {
+		coverPath = cover.Path
+	}
+	ebook, err := saveFormUpload(r, "ebook", uploadKindEbook)
+	if err != nil {
+		releaseUpload(coverPath)
+		writeUploadError(w, err)
+		return
+	}
+	if ebook != nil {
+		ebookPath = ebook.Path
+		if _, dupTitle, dup := ebookDuplicateOf(ebookPath, bookID); dup {
+			releaseUpload(coverPath)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "Ebook yang sama sudah dipakai buku \"" + dupTitle + "\"",
+			})
+			return
 		}
 	}
 
@@ -1718,7 +2284,7 @@ func updateBookHandler(w http.ResponseWriter, r *http.Request) {
 	// Query dasar
 	query := `
         UPDATE books
-        SET title=?, author=?, year=?, genre=?, category=?, type=?, description=?, location=?, stockMax=?, fineAmount=?`
+        SET title=?, author=?, year=?, genre=?, category=?, type=?, description=?, location=?, stockMax=?, fineAmount=?, updated_at=NOW()`
 
 	args := []interface{}{title, author, year, genre, category, bookType, description, location, stock, fineAmount}
 
@@ -1734,6 +2300,44 @@ func updateBookHandler(w http.ResponseWriter, r *http.Request) {
 		args = append(args, ebookPath)
 	}
 
+	// Kebijakan akses ebook hanya diubah jika dikirim
+	if ebookAccess := r.FormValue("ebookAccess"); ebookAccess != "" {
+		if !validEbookAccess(ebookAccess) {
+			releaseUpload(coverPath)
+			releaseUpload(ebookPath)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "Akses ebook harus member atau loan",
+			})
+			return
+		}
+		query += `, ebookAccess=?`
+		args = append(args, ebookAccess)
+	}
+	// Lisensi ebook (terpisah dari stok fisik)
+	licenses, loanDays, msg := parseEbookLicenseForm(r)
+	if msg != "" {
+		releaseUpload(coverPath)
+		releaseUpload(ebookPath)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": msg,
+		})
+		return
+	}
+	if licenses != nil {
+		query += `, ebookLicenses=?`
+		args = append(args, *licenses)
+	}
+	if loanDays != nil {
+		query += `, ebookLoanDays=?`
+		args = append(args, *loanDays)
+	}
+
 	query += ` WHERE id=?`
 	args = append(args, id)
 
@@ -1742,12 +2346,33 @@ func updateBookHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
+		releaseUpload(coverPath)
+		releaseUpload(ebookPath)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
 			"message": "Database error: " + err.Error(),
 		})
 		return
 	}
+	// File lama yang diganti dihapus jika tidak dipakai buku lain
+	if coverPath != "" && coverPath != oldCover.String {
+		releaseUpload(oldCover.String)
+		queueCoverProcessing(coverPath)
+	}
+	if ebookPath != "" && ebookPath != oldEbook.String {
+		releaseUpload(oldEbook.String)
+	}
+	if bookID > 0 {
+		syncBookTaxonomy(bookID, genre, author)
+		reindexBook(bookID)
+		// Lisensi bisa bertambah: teruskan ke antrean
+		go promoteEbookWaitlist(bookID)
+		if ebookPath != "" {
+			purgeWatermarkCache(bookID)
+			applyEbookMetadata(bookID, ebookPath)
+			queueEbookText(bookID)
+		}
+	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -1814,27 +2439,39 @@ func bacaBukuPageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ambil detail buku (terutama path ebookFile)
+	// Ambil detail buku
 	var book Book
-	var ebookFile sql.NullString
-	err := db.QueryRow("SELECT id, title, ebookFile FROM books WHERE id = ?", bookID).Scan(&book.ID, &book.Title, &ebookFile)
+	var format sql.NullString
+	err := db.QueryRow("SELECT id, title, ebookFormat FROM books WHERE id = ?", bookID).Scan(&book.ID, &book.Title, &format)
 	if err != nil {
 		http.Error(w, "Buku tidak ditemukan", http.StatusNotFound)
 		return
 	}
 
+	// File ebook tidak lagi publik: reader memakai URL bertanda tangan
+	if _, status, msg := ebookEntitlement(user.ID, user.Role, book.ID); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	ebookURL, _ := signedEbookURL(user.ID, book.ID)
+
 	data := struct {
-		User      User
-		BookID    int
-		Title     string
-		EbookFile string
+		User     User
+		BookID   int
+		Title    string
+		EbookURL string
 	}{
-		User:      user,
-		BookID:    book.ID,
-		Title:     book.Title,
-		EbookFile: ebookFile.String,
+		User:     user,
+		BookID:   book.ID,
+		Title:    book.Title,
+		EbookURL: ebookURL,
 	}
 
+	// EPUB memakai reader terpisah (epub.js), alurnya tetap lewat /baca_buku
+	if format.String == ebookFormatEPUB {
+		renderTemplate(w, "baca_epub.html", data)
+		return
+	}
 	renderTemplate(w, "baca_buku.html", data)
 }
 
@@ -1850,7 +2487,7 @@ func ebookHistoryAPIHandler(w http.ResponseWriter, r *http.Request) {
 	// GET: Ambil daftar history user
 	if r.Method == http.MethodGet {
 		rows, err := db.Query(`
-			SELECT h.id, h.bookId, b.title, b.coverFile, h.lastPage, h.dateLastRead
+			SELECT h.id, h.bookId, b.title, b.coverFile, h.lastPage, h.lastLocation, h.progress, h.dateLastRead
 			FROM ebook_history h
 			JOIN books b ON h.bookId = b.id
 			WHERE h.userId = ?
@@ -1867,11 +2504,12 @@ func ebookHistoryAPIHandler(w http.ResponseWriter, r *http.Request) {
 		for rows.Next() {
 			var item EbookHistoryItem
 			var dateRaw time.Time
-			var cover sql.NullString
-			if err := rows.Scan(&item.ID, &item.BookID, &item.Title, &cover, &item.LastPage, &dateRaw); err != nil {
+			var cover, location sql.NullString
+			if err := rows.Scan(&item.ID, &item.BookID, &item.Title, &cover, &item.LastPage, &location, &item.Progress, &dateRaw); err != nil {
 				continue
 			}
 			item.CoverFile = cover.String
+			item.Location = location.String
 			item.DateLastRead = dateRaw.Format("2006-01-02 15:04")
 			history = append(history, item)
 		}
@@ -1922,31 +2560,60 @@ func ebookProgressAPIHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Insert or Update (Upsert)
-		_, err := db.Exec(`
-			INSERT INTO ebook_history (userId, bookId, lastPage, dateLastRead)
-			VALUES (?, ?, ?, NOW())
-			ON DUPLICATE KEY UPDATE lastPage = ?, dateLastRead = NOW()
-		`, user.ID, req.BookID, req.Page, req.Page)
+		if req.Location != "" {
+			// EPUB: posisi berupa CFI, progres dalam persen
+			if !strings.HasPrefix(req.Location, "epubcfi(") || !strings.HasSuffix(req.Location, ")") || len(req.Location) > 1024 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(Response{Success: false, Message: "Lokasi CFI tidak valid"})
+				return
+			}
+		}
+		if _, _, ok := normalizeDevice(req.DeviceID, req.DeviceName); !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "deviceId tidak valid"})
+			return
+		}
+		// Progres hanya untuk yang boleh membaca (pinjaman ebook masih aktif)
+		if _, status, msg := ebookEntitlement(user.ID, user.Role, req.BookID); status != 0 {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: msg})
+			return
+		}
 
+		// Posisi utama hanya diganti sesuai kebijakan konflik antar perangkat
+		applied, current, err := syncEbookProgress(user.ID, req)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
 			return
 		}
-		json.NewEncoder(w).Encode(Response{Success: true, Message: "Progress saved"})
+		// Riwayat tidak lagi hilang: tiap simpan progres juga jadi event sesi baca
+		if req.SessionID != "" {
+			if status, msg := recordReadingEvent(user, ReadingEventRequest{
+				BookID: req.BookID, SessionID: req.SessionID, Kind: readingEventPage,
+				Page: req.Page, Location: req.Location, Progress: req.Progress,
+			}); status != 0 {
+				log.Printf("Event baca buku %d tidak dicatat: %s", req.BookID, msg)
+			}
+		}
+		message := "Progress saved"
+		if !applied {
+			message = "Progress perangkat disimpan, posisi utama tetap"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"message":  message,
+			"applied":  applied,
+			"policy":   progressPolicy,
+			"position": current,
+		})
 		return
 	}
 
-	// GET: Ambil halaman terakhir (untuk resume)
+	// GET: Ambil posisi terakhir (untuk resume); ?deviceId= untuk prompt antar perangkat
 	if r.Method == http.MethodGet {
-		bookId := r.URL.Query().Get("bookId")
-		var lastPage int
-		err := db.QueryRow("SELECT lastPage FROM ebook_history WHERE userId = ? AND bookId = ?", user.ID, bookId).Scan(&lastPage)
-		if err != nil {
-			lastPage = 1 // Default halaman 1
-		}
-		json.NewEncoder(w).Encode(map[string]int{"page": lastPage})
+		bookID, _ := strconv.Atoi(r.URL.Query().Get("bookId"))
+		json.NewEncoder(w).Encode(ebookResumeInfo(user.ID, bookID, r.URL.Query().Get("deviceId")))
 		return
 	}
 }
@@ -2813,7 +3480,17 @@ func bookmarkHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		_, err := db.Exec("INSERT INTO bookmarks (userId, bookId) VALUES (?, ?)", userId, bm.BookId)
+		// Bookmark = buku di rak default
+		shelfID, err := defaultShelfID(userId)
+		if err == nil {
+			var added bool
+			added, err = addShelfItem(shelfID, bm.BookId, "")
+			if err == nil && !added {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(Response{Success: false, Message: "Buku sudah di-bookmark"})
+				return
+			}
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
@@ -2830,7 +3507,10 @@ func bookmarkHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		_, err := db.Exec("DELETE FROM bookmarks WHERE userId=? AND bookId=?", userId, bm.BookId)
+		shelfID, err := defaultShelfID(userId)
+		if err == nil {
+			_, err = removeShelfItem(shelfID, bm.BookId)
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
@@ -2858,7 +3538,9 @@ func checkBookmarkHandler(w http.ResponseWriter, r *http.Request) {
 	bookId, _ := strconv.Atoi(bookIdStr)
 
 	var exists int
-	err = db.QueryRow("SELECT COUNT(*) FROM bookmarks WHERE userId=? AND bookId=?", userId, bookId).Scan(&exists)
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM shelf_items i JOIN shelves s ON s.id = i.shelfId
+		WHERE s.userId = ? AND s.isDefault = 1 AND i.bookId = ?`, userId, bookId).Scan(&exists)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
@@ -2878,55 +3560,51 @@ func getBookmarksHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// QUERY: Mengambil semua kolom persis seperti listBooksHandler
-	query := `
-        SELECT 
-            b.id, b.title, b.author, b.year, b.genre, b.category, b.type, 
-            b.stockMax, b.fineAmount, b.description, b.coverFile, b.location, b.ebookFile
-        FROM bookmarks bm
-        JOIN books b ON bm.bookId = b.id
-        WHERE bm.userId = ?`
-
-	rows, err := db.Query(query, userId)
+	lq, err := parseBookListQuery(r.URL.Query())
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	// Slice of Maps (Sama persis formatnya dengan listBooksHandler)
-	var booksList []map[string]interface{}
+	// Format data sama persis dengan listBooksHandler (termasuk filter, sort & pagination)
+	q := r.URL.Query()
+	search := strings.TrimSpace(q.Get("search"))
+	q.Del("search")
+	conditions, args := buildBookFilters(q)
+	conditions = append([]string{"s.userId = ?", "s.isDefault = 1"}, conditions...)
+	args = append([]interface{}{userId}, args...)
 
-	for rows.Next() {
-		var id int
-		var year, stockMax, fineAmount sql.NullInt64
-		var title, author, genre, category, tipe, description, coverFile, location, ebookFile sql.NullString
+	// Facet dihitung dari tabel books, jadi batasan bookmark ditulis sebagai subquery
+	scopeConds := []string{"b.id IN (SELECT i.bookId FROM shelf_items i JOIN shelves s ON s.id = i.shelfId WHERE s.userId = ? AND s.isDefault = 1)"}
+	scopeArgs := []interface{}{userId}
+	if search != "" {
+		searchConds, searchArgs := applyBookSearch(search, &lq, nil, nil)
+		conditions = append(conditions, searchConds...)
+		args = append(args, searchArgs...)
+		scopeConds = append(scopeConds, searchConds...)
+		scopeArgs = append(scopeArgs, searchArgs...)
+	}
 
-		// Scan menggunakan sql.Null types untuk keamanan data kosong
-		if err := rows.Scan(&id, &title, &author, &year, &genre, &category, &tipe,
-			&stockMax, &fineAmount, &description, &coverFile, &location, &ebookFile); err != nil {
-			log.Println("Scan error in bookmarks:", err)
-			continue
-		}
+	res, err := queryBookList("shelf_items i JOIN shelves s ON s.id = i.shelfId JOIN books b ON i.bookId = b.id", conditions, args, lq)
+	if err != nil {
+		log.Println("Query error in bookmarks:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
 
-		// Mapping ke JSON
-		booksList = append(booksList, map[string]interface{}{
-			"id":          id,
-			"title":       title.String,
-			"author":      author.String,
-			"year":        int(year.Int64),
-			"genre":       genre.String,
-			"category":    category.String,
-			"type":        tipe.String,
-			"stock":       int(stockMax.Int64),
-			"fineAmount":  int(fineAmount.Int64),
-			"description": description.String,
-			"coverFile":   coverFile.String,
-			"location":    location.String,
-			"ebookFile":   ebookFile.String,
-		})
+	resp := bookListResponse(res, lq)
+	if len(lq.Facets) > 0 {
+		facets, err := computeBookFacets(q, scopeConds, scopeArgs, lq.Facets)
+		if err != nil {
+			log.Println("Facet error in bookmarks:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+			return
+		}
+		resp.(map[string]interface{})["facets"] = facets
 	}
 
-	json.NewEncoder(w).Encode(booksList)
+	json.NewEncoder(w).Encode(resp)
 }
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ==========================================
+// MARC21 (ISO 2709) & MARCXML
+// ==========================================
+
+// Karakter pemisah ISO 2709
+const (
+	marcSubfieldDelimiter = 0x1F
+	marcFieldTerminator   = 0x1E
+	marcRecordTerminator  = 0x1D
+)
+
+const marcXMLNamespace = "http://www.loc.gov/MARC21/slim"
+
+// Satu record MARC. Struktur ini juga dipakai langsung untuk encode/decode MARCXML.
+type marcRecord struct {
+	XMLName       xml.Name           `xml:"record"`
+	Leader        string             `xml:"leader"`
+	ControlFields []marcControlField `xml:"controlfield"`
+	DataFields    []marcDataField    `xml:"datafield"`
+}
+
+type marcControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Tambah datafield, subfield kosong dilewati. Field tanpa subfield tidak ditambahkan.
+// subs berisi pasangan kode & nilai: "a", "Judul", "c", "2020"
+func (rec *marcRecord) addData(tag, ind1, ind2 string, subs ...string) {
+	f := marcDataField{Tag: tag, Ind1: ind1, Ind2: ind2}
+	for i := 0; i+1 < len(subs); i += 2 {
+		if v := strings.TrimSpace(subs[i+1]); v != "" {
+			f.Subfields = append(f.Subfields, marcSubfield{Code: subs[i], Value: v})
+		}
+	}
+	if len(f.Subfields) > 0 {
+		rec.DataFields = append(rec.DataFields, f)
+	}
+}
+
+// Ubah data buku menjadi record MARC21 dengan pemetaan umum:
+// 001 id, 008 tahun, 020 ISBN, 100 penulis, 245 judul, 260 penerbit/tahun,
+// 520 deskripsi, 650 genre, 852 lokasi (nomor panggil), 856 link halaman buku.
+// File ebook tidak pernah ditautkan langsung karena hanya bisa diakses lewat
+// stream bertanda tangan; base kosong = 856 tidak ditulis.
+func bookToMARC(b catalogBook, base string) marcRecord {
+	rec := marcRecord{Leader: "00000nam a2200000   4500"}
+
+	rec.ControlFields = append(rec.ControlFields, marcControlField{Tag: "001", Value: strconv.Itoa(b.ID)})
+	if !b.UpdatedAt.IsZero() {
+		rec.ControlFields = append(rec.ControlFields, marcControlField{Tag: "005", Value: b.UpdatedAt.Format("20060102150405") + ".0"})
+	}
+
+	// 008: 40 karakter fixed-length, kita isi tanggal entri (00-05) & tahun terbit (07-10)
+	f008 := []byte(strings.Repeat(" ", 40))
+	if !b.CreatedAt.IsZero() {
+		copy(f008[0:6], b.CreatedAt.Format("060102"))
+	}
+	f008[6] = 's'
+	if b.Year > 0 {
+		copy(f008[7:11], fmt.Sprintf("%04d", b.Year))
+	} else {
+		copy(f008[7:11], "uuuu")
+	}
+	copy(f008[35:38], "ind")
+	rec.ControlFields = append(rec.ControlFields, marcControlField{Tag: "008", Value: string(f008)})
+
+	rec.addData("020", " ", " ", "a", b.ISBN)
+	rec.addData("100", "1", " ", "a", b.Author)
+	ind1 := "0"
+	if b.Author != "" {
+		ind1 = "1"
+	}
+	rec.addData("245", ind1, "0", "a", b.Title)
+
+	year := ""
+	if b.Year > 0 {
+		year = strconv.Itoa(b.Year)
+	}
+	rec.addData("260", " ", " ", "b", b.Publisher, "c", year)
+	rec.addData("520", " ", " ", "a", b.Description)
+
+	for _, g := range strings.Split(b.Genre, ",") {
+		rec.addData("650", " ", "4", "a", g)
+	}
+	rec.addData("852", " ", " ", "h", b.Location, "k", b.Category)
+	if b.EbookFile != "" && base != "" {
+		rec.addData("856", "4", "2", "u", feedItemLink(base, b.ID), "z", "Ebook tersedia untuk member (perlu login)")
+	}
+	return rec
+}
+
+// Tulis record dalam format biner ISO 2709
+func writeMARC21(w io.Writer, rec marcRecord) error {
+	var directory, fields bytes.Buffer
+
+	addField := func(tag string, data []byte) {
+		fmt.Fprintf(&directory, "%s%04d%05d", tag, len(data)+1, fields.Len())
+		fields.Write(data)
+		fields.WriteByte(marcFieldTerminator)
+	}
+
+	for _, c := range rec.ControlFields {
+		addField(c.Tag, []byte(c.Value))
+	}
+	for _, f := range rec.DataFields {
+		var buf bytes.Buffer
+		buf.WriteString(marcIndicator(f.Ind1))
+		buf.WriteString(marcIndicator(f.Ind2))
+		for _, sf := range f.Subfields {
+			buf.WriteByte(marcSubfieldDelimiter)
+			buf.WriteString(sf.Code)
+			buf.WriteString(sf.Value)
+		}
+		addField(f.Tag, buf.Bytes())
+	}
+	directory.WriteByte(marcFieldTerminator)
+
+	baseAddress := 24 + directory.Len()
+	recordLength := baseAddress + fields.Len() + 1
+	if recordLength > 99999 {
+		return fmt.Errorf("record MARC terlalu panjang (%d byte)", recordLength)
+	}
+
+	// Leader: panjang record (00-04) dan base address (12-16) dihitung ulang
+	leader := []byte(rec.Leader)
+	if len(leader) != 24 {
+		leader = []byte("00000nam a2200000   4500")
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", recordLength))
+	copy(leader[12:17], fmt.Sprintf("%05d", baseAddress))
+	leader[9] = 'a' // UTF-8
+
+	if _, err := w.Write(leader); err != nil {
+		return err
+	}
+	if _, err := w.Write(directory.Bytes()); err != nil {
+		return err
+	}
+	if _, err := w.Write(fields.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{marcRecordTerminator})
+	return err
+}
+
+func marcIndicator(ind string) string {
+	if ind == "" {
+		return " "
+	}
+	return ind[:1]
+}
+
+// Tulis satu record sebagai elemen <record> MARCXML (tanpa pembungkus <collection>)
+func writeMARCXMLRecord(w io.Writer, rec marcRecord) error {
+	enc := xml.NewEncoder(w)
+	start := xml.StartElement{Name: xml.Name{Space: marcXMLNamespace, Local: "record"}}
+	if err := enc.EncodeElement(rec, start); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Nilai control field pertama dengan tag tertentu
+func (rec *marcRecord) control(tag string) string {
+	for _, c := range rec.ControlFields {
+		if c.Tag == tag {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// Nilai semua subfield dengan kode tertentu dari semua field bertag tertentu
+func (rec *marcRecord) subfields(tag, code string) []string {
+	var out []string
+	for _, f := range rec.DataFields {
+		if f.Tag != tag {
+			continue
+		}
+		for _, sf := range f.Subfields {
+			if sf.Code == code {
+				out = append(out, sf.Value)
+			}
+		}
+	}
+	return out
+}
+
+// Nilai subfield pertama (atau "" jika tidak ada)
+func (rec *marcRecord) subfield(tag, code string) string {
+	if v := rec.subfields(tag, code); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Leader/09 "a" = UCS/Unicode (UTF-8); spasi = MARC-8
+func (rec *marcRecord) isUnicode() bool {
+	return len(rec.Leader) > 9 && rec.Leader[9] == 'a'
+}
+
+// Parse satu record ISO 2709 (tanpa record terminator di akhir juga diterima)
+func parseMARC21(data []byte) (marcRecord, error) {
+	var rec marcRecord
+	if len(data) < 25 {
+		return rec, fmt.Errorf("record MARC terlalu pendek")
+	}
+	rec.Leader = string(data[:24])
+
+	baseAddress, err := strconv.Atoi(string(data[12:17]))
+	if err != nil || baseAddress < 25 || baseAddress > len(data) {
+		return rec, fmt.Errorf("base address MARC tidak valid")
+	}
+
+	directory := data[24 : baseAddress-1]
+	if len(directory)%12 != 0 {
+		return rec, fmt.Errorf("directory MARC tidak valid")
+	}
+
+	for i := 0; i < len(directory); i += 12 {
+		entry := directory[i : i+12]
+		tag := string(entry[0:3])
+		length, err1 := strconv.Atoi(string(entry[3:7]))
+		start, err2 := strconv.Atoi(string(entry[7:12]))
+		if err1 != nil || err2 != nil {
+			return rec, fmt.Errorf("entry directory MARC tidak valid untuk tag %s", tag)
+		}
+		from := baseAddress + start
+		to := from + length
+		if from > len(data) || to > len(data) || length < 1 {
+			return rec, fmt.Errorf("field %s melewati batas record", tag)
+		}
+		value := bytes.TrimRight(data[from:to], string([]byte{marcFieldTerminator}))
+
+		if strings.HasPrefix(tag, "00") {
+			rec.ControlFields = append(rec.ControlFields, marcControlField{Tag: tag, Value: string(value)})
+			continue
+		}
+
+		f := marcDataField{Tag: tag, Ind1: " ", Ind2: " "}
+		if len(value) >= 2 {
+			f.Ind1, f.Ind2 = string(value[0:1]), string(value[1:2])
+			value = value[2:]
+		}
+		for _, part := range bytes.Split(value, []byte{marcSubfieldDelimiter}) {
+			if len(part) == 0 {
+				continue
+			}
+			f.Subfields = append(f.Subfields, marcSubfield{Code: string(part[0:1]), Value: string(part[1:])})
+		}
+		rec.DataFields = append(rec.DataFields, f)
+	}
+	return rec, nil
+}
+
+// Pecah file ISO 2709 menjadi record-record mentah
+func splitMARC21(data []byte) [][]byte {
+	var out [][]byte
+	for _, part := range bytes.Split(data, []byte{marcRecordTerminator}) {
+		part = bytes.TrimLeft(part, "\r\n ")
+		if len(part) > 0 {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// Parse dokumen MARCXML (<collection> atau satu <record>), namespace diabaikan
+func parseMARCXML(r io.Reader) ([]marcRecord, error) {
+	dec := xml.NewDecoder(r)
+	var records []marcRecord
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return records, fmt.Errorf("MARCXML tidak valid: %v", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		var rec marcRecord
+		if err := dec.DecodeElement(&rec, &start); err != nil {
+			return records, fmt.Errorf("MARCXML tidak valid: %v", err)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
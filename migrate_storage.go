@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// ==========================================
+// MIGRASI PENYIMPANAN FILE
+// Perintah satu kali: ./project migrate-storage
+//
+//  1. Salin file lama di uploads/covers, uploads/ebooks dan uploads/users
+//     dari disk lokal ke backend aktif (jika bukan lokal). File yang sudah
+//     ada dengan ukuran sama dilewati, jadi aman dijalankan berulang.
+//  2. Foto profil yang masih tersimpan sebagai data URL base64 di tabel
+//     users dipindah menjadi file uploads/users/<hash>.
+//  3. Laporkan path di database yang filenya tidak ada di backend.
+//
+// File lokal tidak dihapus; hapus manual setelah hasil migrasi dicek.
+// ==========================================
+
+func migrateStorage() {
+	if _, local := blobs.(*localBlobStore); local {
+		fmt.Println("Backend penyimpanan lokal: file tidak perlu dipindah")
+	} else {
+		src := newLocalBlobStore(".")
+		for _, dir := range []string{"uploads/covers", "uploads/ebooks", "uploads/users"} {
+			copied, skipped, failed := 0, 0, 0
+			err := src.List(dir, func(key string, info BlobInfo) error {
+				if dst, err := blobs.Stat(key); err == nil && dst.Size == info.Size {
+					skipped++
+					return nil
+				}
+				rc, _, err := src.Get(key)
+				if err != nil {
+					log.Printf("Gagal membaca %s: %v", key, err)
+					failed++
+					return nil
+				}
+				defer rc.Close()
+				if err := blobs.Put(key, rc, info.Size, info.ContentType); err != nil {
+					log.Printf("Gagal menyalin %s: %v", key, err)
+					failed++
+					return nil
+				}
+				copied++
+				return nil
+			})
+			if err != nil {
+				log.Printf("Gagal membaca folder %s: %v", dir, err)
+			}
+			fmt.Printf("%s: %d disalin, %d sudah ada, %d gagal\n", dir, copied, skipped, failed)
+		}
+	}
+
+	migrateProfilePictures()
+	reportMissingBlobs()
+}
+
+// Foto profil base64 di database -> file lewat layanan upload
+func migrateProfilePictures() {
+	rows, err := db.Query("SELECT id, profile_picture FROM users WHERE profile_picture LIKE 'data:%'")
+	if err != nil {
+		log.Println("Gagal membaca foto profil:", err)
+		return
+	}
+	type pending struct {
+		id   int
+		data string
+	}
+	var list []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.data); err == nil {
+			list = append(list, p)
+		}
+	}
+	rows.Close()
+
+	moved := 0
+	for _, p := range list {
+		up, err := saveDataURLUpload(p.data, uploadKindUser)
+		if err != nil {
+			log.Printf("Foto profil user %d dilewati: %v", p.id, err)
+			continue
+		}
+		if _, err := db.Exec("UPDATE users SET profile_picture = ? WHERE id = ?", up.Path, p.id); err != nil {
+			log.Printf("Gagal menyimpan foto profil user %d: %v", p.id, err)
+			continue
+		}
+		moved++
+	}
+	fmt.Printf("Foto profil: %d dari %d dipindah ke penyimpanan file\n", moved, len(list))
+}
+
+func reportMissingBlobs() {
+	rows, err := db.Query(`
+		SELECT coverFile FROM books WHERE coverFile LIKE 'uploads/%'
+		UNION SELECT ebookFile FROM books WHERE ebookFile LIKE 'uploads/%'
+		UNION SELECT profile_picture FROM users WHERE profile_picture LIKE 'uploads/%'`)
+	if err != nil {
+		log.Println("Gagal memeriksa referensi file:", err)
+		return
+	}
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err == nil {
+			keys = append(keys, k)
+		}
+	}
+	rows.Close()
+
+	missing := 0
+	for _, k := range keys {
+		if _, err := blobs.Stat(k); err != nil {
+			fmt.Println("⚠ File tidak ditemukan:", k)
+			missing++
+		}
+	}
+	fmt.Printf("Referensi file: %d diperiksa, %d tidak ditemukan\n", len(keys), missing)
+}
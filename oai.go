@@ -0,0 +1,551 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// OAI-PMH 2.0 PROVIDER (HARVESTING METADATA KATALOG)
+// ==========================================
+
+const (
+	oaiPageSize    = 50
+	oaiGranularity = "YYYY-MM-DDThh:mm:ssZ"
+	oaiTimeFormat  = "2006-01-02T15:04:05Z"
+	oaiDateFormat  = "2006-01-02"
+)
+
+// Datestamp record = waktu terakhir metadata diubah, atau waktu dibuat
+const oaiDatestampColumn = "COALESCE(updated_at, created_at)"
+
+var oaiSetSpecInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Format metadata yang didukung
+var oaiMetadataFormats = []struct {
+	Prefix, Schema, Namespace string
+}{
+	{"oai_dc", "http://www.openarchives.org/OAI/2.0/oai_dc.xsd", "http://www.openarchives.org/OAI/2.0/oai_dc/"},
+	{"marc21", "http://www.loc.gov/standards/marcxml/schema/MARC21slim.xsd", marcXMLNamespace},
+}
+
+// Identifier repository, bisa diatur lewat env OAI_REPOSITORY_ID
+func oaiRepositoryID() string {
+	if id := os.Getenv("OAI_REPOSITORY_ID"); id != "" {
+		return id
+	}
+	return "libra"
+}
+
+func oaiIdentifier(bookID int) string {
+	return fmt.Sprintf("oai:%s:book:%d", oaiRepositoryID(), bookID)
+}
+
+// Kebalikan oaiIdentifier, 0 jika format tidak cocok
+func oaiBookID(identifier string) int {
+	prefix := "oai:" + oaiRepositoryID() + ":book:"
+	if !strings.HasPrefix(identifier, prefix) {
+		return 0
+	}
+	id, _ := strconv.Atoi(strings.TrimPrefix(identifier, prefix))
+	return id
+}
+
+// setSpec kategori: huruf kecil, karakter selain huruf/angka jadi "-"
+func oaiSetSpec(category string) string {
+	return "category:" + strings.Trim(oaiSetSpecInvalid.ReplaceAllString(strings.ToLower(category), "-"), "-")
+}
+
+// Error protokol OAI-PMH
+type oaiError struct {
+	Code, Message string
+}
+
+// Argumen list request, juga isi dari resumptionToken
+type oaiListArgs struct {
+	Prefix string
+	Set    string
+	From   string
+	Until  string
+	LastID int
+}
+
+// Handler /oai
+func oaiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	args := r.Form
+
+	verb := args.Get("verb")
+	var body bytes.Buffer
+	var oerr *oaiError
+
+	// Argumen yang diizinkan per verb (selain verb itu sendiri)
+	allowed := map[string][]string{
+		"Identify":            {},
+		"ListMetadataFormats": {"identifier"},
+		"ListSets":            {"resumptionToken"},
+		"GetRecord":           {"identifier", "metadataPrefix"},
+		"ListIdentifiers":     {"metadataPrefix", "from", "until", "set", "resumptionToken"},
+		"ListRecords":         {"metadataPrefix", "from", "until", "set", "resumptionToken"},
+	}
+
+	if keys, ok := allowed[verb]; !ok {
+		oerr = &oaiError{"badVerb", "Verb tidak dikenal atau tidak ada"}
+	} else {
+		oerr = oaiCheckArguments(args, keys)
+	}
+
+	if oerr == nil {
+		switch verb {
+		case "Identify":
+			oerr = oaiIdentify(&body, r)
+		case "ListMetadataFormats":
+			oerr = oaiListMetadataFormats(&body, args.Get("identifier"))
+		case "ListSets":
+			oerr = oaiListSets(&body, args.Get("resumptionToken"))
+		case "GetRecord":
+			oerr = oaiGetRecord(&body, requestBaseURL(r), args.Get("identifier"), args.Get("metadataPrefix"))
+		case "ListIdentifiers", "ListRecords":
+			oerr = oaiList(&body, requestBaseURL(r), verb, args)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<OAI-PMH xmlns="http://www.openarchives.org/OAI/2.0/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.openarchives.org/OAI/2.0/ http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd">
+<responseDate>%s</responseDate>
+`, time.Now().UTC().Format(oaiTimeFormat))
+
+	// Elemen request: atribut hanya ditulis jika request valid (sesuai spesifikasi)
+	fmt.Fprint(w, "<request")
+	if oerr == nil || (oerr.Code != "badVerb" && oerr.Code != "badArgument") {
+		for _, key := range []string{"verb", "identifier", "metadataPrefix", "from", "until", "set", "resumptionToken"} {
+			if v := args.Get(key); v != "" {
+				fmt.Fprintf(w, ` %s="%s"`, key, xmlEscape(v))
+			}
+		}
+	}
+	fmt.Fprintf(w, ">%s</request>\n", xmlEscape(oaiBaseURL(r)))
+
+	if oerr != nil {
+		fmt.Fprintf(w, "<error code=\"%s\">%s</error>\n", oerr.Code, xmlEscape(oerr.Message))
+	} else {
+		w.Write(body.Bytes())
+	}
+	fmt.Fprint(w, "</OAI-PMH>\n")
+}
+
+// Tolak argumen yang tidak dikenal / duplikat, dan resumptionToken yang dicampur argumen lain
+func oaiCheckArguments(args map[string][]string, keys []string) *oaiError {
+	allowed := map[string]bool{"verb": true}
+	for _, k := range keys {
+		allowed[k] = true
+	}
+	for k, v := range args {
+		if !allowed[k] {
+			return &oaiError{"badArgument", "Argumen tidak valid: " + k}
+		}
+		if len(v) > 1 {
+			return &oaiError{"badArgument", "Argumen duplikat: " + k}
+		}
+	}
+	if _, ok := args["resumptionToken"]; ok && len(args) > 2 {
+		return &oaiError{"badArgument", "resumptionToken harus menjadi satu-satunya argumen"}
+	}
+	return nil
+}
+
+func oaiBaseURL(r *http.Request) string {
+	return requestBaseURL(r) + "/oai"
+}
+
+func oaiIdentify(w *bytes.Buffer, r *http.Request) *oaiError {
+	var earliest sql.NullTime
+	db.QueryRow("SELECT MIN(created_at) FROM books").Scan(&earliest)
+	if !earliest.Valid {
+		earliest.Time = time.Now()
+	}
+
+	adminEmail := os.Getenv("SMTP_EMAIL")
+	if adminEmail == "" {
+		adminEmail = "admin@libra.local"
+	}
+
+	fmt.Fprintf(w, `<Identify>
+<repositoryName>Perpustakaan Libra</repositoryName>
+<baseURL>%s</baseURL>
+<protocolVersion>2.0</protocolVersion>
+<adminEmail>%s</adminEmail>
+<earliestDatestamp>%s</earliestDatestamp>
+<deletedRecord>no</deletedRecord>
+<granularity>%s</granularity>
+<description>
+<oai-identifier xmlns="http://www.openarchives.org/OAI/2.0/oai-identifier" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.openarchives.org/OAI/2.0/oai-identifier http://www.openarchives.org/OAI/2.0/oai-identifier.xsd">
+<scheme>oai</scheme>
+<repositoryIdentifier>%s</repositoryIdentifier>
+<delimiter>:</delimiter>
+<sampleIdentifier>%s</sampleIdentifier>
+</oai-identifier>
+</description>
+</Identify>
+`, xmlEscape(oaiBaseURL(r)), xmlEscape(adminEmail), earliest.Time.UTC().Format(oaiTimeFormat), oaiGranularity,
+		xmlEscape(oaiRepositoryID()), xmlEscape(oaiIdentifier(1)))
+	return nil
+}
+
+func oaiListMetadataFormats(w *bytes.Buffer, identifier string) *oaiError {
+	if identifier != "" {
+		var exists bool
+		id := oaiBookID(identifier)
+		db.QueryRow("SELECT EXISTS(SELECT 1 FROM books WHERE id = ?)", id).Scan(&exists)
+		if id == 0 || !exists {
+			return &oaiError{"idDoesNotExist", "Identifier tidak ditemukan"}
+		}
+	}
+
+	w.WriteString("<ListMetadataFormats>\n")
+	for _, f := range oaiMetadataFormats {
+		fmt.Fprintf(w, "<metadataFormat><metadataPrefix>%s</metadataPrefix><schema>%s</schema><metadataNamespace>%s</metadataNamespace></metadataFormat>\n",
+			f.Prefix, f.Schema, f.Namespace)
+	}
+	w.WriteString("</ListMetadataFormats>\n")
+	return nil
+}
+
+// Set = kategori buku. Jumlah kategori sedikit, jadi tanpa paging.
+func oaiListSets(w *bytes.Buffer, token string) *oaiError {
+	if token != "" {
+		return &oaiError{"badResumptionToken", "ListSets tidak memakai resumptionToken"}
+	}
+
+	categories, err := oaiCategories()
+	if err != nil {
+		log.Println("OAI ListSets error:", err)
+		return &oaiError{"badArgument", "Gagal mengambil daftar set"}
+	}
+	if len(categories) == 0 {
+		return &oaiError{"noSetHierarchy", "Repository belum memiliki set"}
+	}
+
+	specs := make([]string, 0, len(categories))
+	for spec := range categories {
+		specs = append(specs, spec)
+	}
+	sort.Strings(specs)
+
+	w.WriteString("<ListSets>\n")
+	for _, spec := range specs {
+		fmt.Fprintf(w, "<set><setSpec>%s</setSpec><setName>%s</setName></set>\n", xmlEscape(spec), xmlEscape(categories[spec]))
+	}
+	w.WriteString("</ListSets>\n")
+	return nil
+}
+
+// setSpec -> nama kategori asli
+func oaiCategories() (map[string]string, error) {
+	rows, err := db.Query("SELECT DISTINCT category FROM books WHERE category IS NOT NULL AND category <> '' ORDER BY category")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]string{}
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err == nil {
+			out[oaiSetSpec(c)] = c
+		}
+	}
+	return out, rows.Err()
+}
+
+func oaiGetRecord(w *bytes.Buffer, base, identifier, prefix string) *oaiError {
+	if identifier == "" || prefix == "" {
+		return &oaiError{"badArgument", "identifier dan metadataPrefix wajib diisi"}
+	}
+	if !oaiKnownPrefix(prefix) {
+		return &oaiError{"cannotDisseminateFormat", "metadataPrefix tidak didukung"}
+	}
+
+	id := oaiBookID(identifier)
+	rows, err := db.Query("SELECT "+catalogBookColumns+" FROM books WHERE id = ?", id)
+	if err != nil {
+		log.Println("OAI GetRecord error:", err)
+		return &oaiError{"idDoesNotExist", "Identifier tidak ditemukan"}
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return &oaiError{"idDoesNotExist", "Identifier tidak ditemukan"}
+	}
+	b, err := scanCatalogBook(rows)
+	if err != nil {
+		return &oaiError{"idDoesNotExist", "Identifier tidak ditemukan"}
+	}
+
+	w.WriteString("<GetRecord>\n")
+	oaiWriteRecord(w, base, b, prefix, true)
+	w.WriteString("</GetRecord>\n")
+	return nil
+}
+
+// ListIdentifiers & ListRecords, paging memakai resumptionToken berbasis id terakhir
+func oaiList(w *bytes.Buffer, base, verb string, args map[string][]string) *oaiError {
+	get := func(k string) string {
+		if v := args[k]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	var la oaiListArgs
+	if token := get("resumptionToken"); token != "" {
+		var ok bool
+		if la, ok = oaiDecodeToken(token); !ok {
+			return &oaiError{"badResumptionToken", "resumptionToken tidak valid"}
+		}
+	} else {
+		la = oaiListArgs{Prefix: get("metadataPrefix"), Set: get("set"), From: get("from"), Until: get("until")}
+		if la.Prefix == "" {
+			return &oaiError{"badArgument", "metadataPrefix wajib diisi"}
+		}
+	}
+
+	if !oaiKnownPrefix(la.Prefix) {
+		return &oaiError{"cannotDisseminateFormat", "metadataPrefix tidak didukung"}
+	}
+
+	var conditions []string
+	var params []interface{}
+
+	from, fromGran, ok := oaiParseDate(la.From, false)
+	if !ok {
+		return &oaiError{"badArgument", "Format from tidak valid"}
+	}
+	until, untilGran, ok := oaiParseDate(la.Until, true)
+	if !ok {
+		return &oaiError{"badArgument", "Format until tidak valid"}
+	}
+	if la.From != "" && la.Until != "" && fromGran != untilGran {
+		return &oaiError{"badArgument", "Granularity from dan until harus sama"}
+	}
+	if la.From != "" {
+		conditions = append(conditions, oaiDatestampColumn+" >= ?")
+		params = append(params, from)
+	}
+	if la.Until != "" {
+		conditions = append(conditions, oaiDatestampColumn+" <= ?")
+		params = append(params, until)
+	}
+
+	if la.Set != "" {
+		categories, err := oaiCategories()
+		if err != nil {
+			log.Println("OAI set error:", err)
+		}
+		category, ok := categories[la.Set]
+		if !ok {
+			return &oaiError{"noRecordsMatch", "Set tidak ditemukan"}
+		}
+		conditions = append(conditions, "category = ?")
+		params = append(params, category)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	db.QueryRow("SELECT COUNT(*) FROM books"+where, params...).Scan(&total)
+
+	pageWhere := where
+	pageParams := append([]interface{}{}, params...)
+	if la.LastID > 0 {
+		if pageWhere == "" {
+			pageWhere = " WHERE id > ?"
+		} else {
+			pageWhere += " AND id > ?"
+		}
+		pageParams = append(pageParams, la.LastID)
+	}
+
+	// cursor = jumlah record yang sudah dikirim di halaman-halaman sebelumnya
+	cursor := total - oaiCountRemaining(where, params, la.LastID)
+
+	rows, err := db.Query("SELECT "+catalogBookColumns+" FROM books"+pageWhere+" ORDER BY id LIMIT ?", append(pageParams, oaiPageSize+1)...)
+	if err != nil {
+		log.Println("OAI list error:", err)
+		return &oaiError{"badArgument", "Gagal mengambil record"}
+	}
+	defer rows.Close()
+
+	var list []catalogBook
+	for rows.Next() {
+		b, err := scanCatalogBook(rows)
+		if err == nil {
+			list = append(list, b)
+		}
+	}
+	if len(list) == 0 {
+		return &oaiError{"noRecordsMatch", "Tidak ada record yang cocok"}
+	}
+
+	hasMore := len(list) > oaiPageSize
+	if hasMore {
+		list = list[:oaiPageSize]
+	}
+
+	fmt.Fprintf(w, "<%s>\n", verb)
+	for _, b := range list {
+		oaiWriteRecord(w, base, b, la.Prefix, verb == "ListRecords")
+	}
+
+	// resumptionToken: kosong di halaman terakhir jika request sebelumnya memakai token
+	if hasMore {
+		next := la
+		next.LastID = list[len(list)-1].ID
+		fmt.Fprintf(w, "<resumptionToken completeListSize=\"%d\" cursor=\"%d\">%s</resumptionToken>\n",
+			total, cursor, oaiEncodeToken(next))
+	} else if la.LastID > 0 {
+		fmt.Fprintf(w, "<resumptionToken completeListSize=\"%d\" cursor=\"%d\"/>\n", total, cursor)
+	}
+	fmt.Fprintf(w, "</%s>\n", verb)
+	return nil
+}
+
+// Jumlah record setelah lastID (untuk menghitung cursor)
+func oaiCountRemaining(where string, params []interface{}, lastID int) int {
+	query := "SELECT COUNT(*) FROM books" + where
+	if where == "" {
+		query += " WHERE id > ?"
+	} else {
+		query += " AND id > ?"
+	}
+	var n int
+	db.QueryRow(query, append(append([]interface{}{}, params...), lastID)...).Scan(&n)
+	return n
+}
+
+// Tulis <record> (atau hanya <header> untuk ListIdentifiers)
+func oaiWriteRecord(w *bytes.Buffer, base string, b catalogBook, prefix string, withMetadata bool) {
+	datestamp := b.UpdatedAt
+	if datestamp.IsZero() {
+		datestamp = b.CreatedAt
+	}
+
+	header := fmt.Sprintf("<header><identifier>%s</identifier><datestamp>%s</datestamp>",
+		xmlEscape(oaiIdentifier(b.ID)), datestamp.UTC().Format(oaiTimeFormat))
+	if b.Category != "" {
+		header += "<setSpec>" + xmlEscape(oaiSetSpec(b.Category)) + "</setSpec>"
+	}
+	header += "</header>\n"
+
+	if !withMetadata {
+		w.WriteString(header)
+		return
+	}
+
+	w.WriteString("<record>\n")
+	w.WriteString(header)
+	w.WriteString("<metadata>\n")
+	if prefix == "marc21" {
+		writeMARCXMLRecord(w, bookToMARC(b, base))
+	} else {
+		oaiWriteDC(w, b)
+	}
+	w.WriteString("</metadata>\n</record>\n")
+}
+
+// Dublin Core sederhana (oai_dc)
+func oaiWriteDC(w *bytes.Buffer, b catalogBook) {
+	w.WriteString(`<oai_dc:dc xmlns:oai_dc="http://www.openarchives.org/OAI/2.0/oai_dc/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.openarchives.org/OAI/2.0/oai_dc/ http://www.openarchives.org/OAI/2.0/oai_dc.xsd">` + "\n")
+
+	el := func(name, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			fmt.Fprintf(w, "<dc:%s>%s</dc:%s>\n", name, xmlEscape(value), name)
+		}
+	}
+
+	el("title", b.Title)
+	el("creator", b.Author)
+	for _, g := range strings.Split(b.Genre, ",") {
+		el("subject", g)
+	}
+	el("description", b.Description)
+	el("publisher", b.Publisher)
+	if b.Year > 0 {
+		el("date", strconv.Itoa(b.Year))
+	}
+	el("type", "Text")
+	el("format", b.Type)
+	if b.ISBN != "" {
+		el("identifier", "urn:isbn:"+b.ISBN)
+	}
+	el("identifier", oaiIdentifier(b.ID))
+	el("language", "ind")
+	w.WriteString("</oai_dc:dc>\n")
+}
+
+func oaiKnownPrefix(prefix string) bool {
+	for _, f := range oaiMetadataFormats {
+		if f.Prefix == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse tanggal OAI (YYYY-MM-DD atau YYYY-MM-DDThh:mm:ssZ).
+// Untuk until dengan format hari, batas dijadikan akhir hari tersebut.
+func oaiParseDate(s string, endOfDay bool) (time.Time, string, bool) {
+	if s == "" {
+		return time.Time{}, "", true
+	}
+	if t, err := time.Parse(oaiTimeFormat, s); err == nil {
+		return t, "second", true
+	}
+	if t, err := time.Parse(oaiDateFormat, s); err == nil {
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		return t, "day", true
+	}
+	return time.Time{}, "", false
+}
+
+// resumptionToken = base64url dari "prefix|set|from|until|lastID"
+func oaiEncodeToken(a oaiListArgs) string {
+	raw := strings.Join([]string{a.Prefix, a.Set, a.From, a.Until, strconv.Itoa(a.LastID)}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func oaiDecodeToken(token string) (oaiListArgs, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return oaiListArgs{}, false
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 5 {
+		return oaiListArgs{}, false
+	}
+	lastID, err := strconv.Atoi(parts[4])
+	if err != nil || lastID < 0 {
+		return oaiListArgs{}, false
+	}
+	return oaiListArgs{Prefix: parts[0], Set: parts[1], From: parts[2], Until: parts[3], LastID: lastID}, true
+}
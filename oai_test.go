@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestOAIResumptionToken(t *testing.T) {
+	tests := []oaiListArgs{
+		{Prefix: "oai_dc", LastID: 100},
+		{Prefix: "marc21", Set: "genre:novel", From: "2024-01-01", Until: "2024-12-31T23:59:59Z", LastID: 42},
+		{Prefix: "oai_dc", Set: "type:ebook", From: "2024-06-01", LastID: 0},
+	}
+	for _, want := range tests {
+		token := oaiEncodeToken(want)
+		got, ok := oaiDecodeToken(token)
+		if !ok || got != want {
+			t.Errorf("decode(%q) = %+v, %v; ingin %+v", token, got, ok, want)
+		}
+	}
+}
+
+func TestOAIResumptionTokenInvalid(t *testing.T) {
+	enc := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := map[string]string{
+		"bukan base64":       "!!!",
+		"bagian kurang":      enc("oai_dc|||"),
+		"bagian lebih":       enc("oai_dc|||||5"),
+		"id bukan angka":     enc("oai_dc||||abc"),
+		"id negatif":         enc("oai_dc||||-1"),
+		"base64 ber-padding": base64.URLEncoding.EncodeToString([]byte("oai_dc||||1")),
+	}
+	for name, token := range tests {
+		if _, ok := oaiDecodeToken(token); ok {
+			t.Errorf("%s: token %q harus ditolak", name, token)
+		}
+	}
+}
+
+func TestOAICheckArguments(t *testing.T) {
+	keys := []string{"metadataPrefix", "set", "resumptionToken"}
+	tests := []struct {
+		name string
+		args map[string][]string
+		code string
+	}{
+		{"valid", map[string][]string{"verb": {"ListRecords"}, "metadataPrefix": {"oai_dc"}}, ""},
+		{"hanya token", map[string][]string{"verb": {"ListRecords"}, "resumptionToken": {"x"}}, ""},
+		{"token dicampur", map[string][]string{"verb": {"ListRecords"}, "resumptionToken": {"x"}, "set": {"a"}}, "badArgument"},
+		{"argumen asing", map[string][]string{"verb": {"ListRecords"}, "halaman": {"2"}}, "badArgument"},
+		{"duplikat", map[string][]string{"verb": {"ListRecords"}, "metadataPrefix": {"oai_dc", "marc21"}}, "badArgument"},
+	}
+	for _, tt := range tests {
+		err := oaiCheckArguments(tt.args, keys)
+		code := ""
+		if err != nil {
+			code = err.Code
+		}
+		if code != tt.code {
+			t.Errorf("%s: kode = %q, ingin %q", tt.name, code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,721 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ==========================================
+// OPDS CATALOG (1.2 Atom & 2.0 JSON) UNTUK EBOOK
+// ==========================================
+
+const (
+	opdsPageSize        = 25
+	opdsAtomNavigation  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	opdsAtomAcquisition = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	opdsJSON            = "application/opds+json"
+	opdsOpenSearch      = "application/opensearchdescription+xml"
+	opdsRelAcquisition  = "http://opds-spec.org/acquisition"
+	opdsRelImage        = "http://opds-spec.org/image"
+	opdsRelThumbnail    = "http://opds-spec.org/image/thumbnail"
+)
+
+// Kondisi buku yang tampil di OPDS: hanya yang punya ebook
+const opdsEbookCondition = "type IN ('Ebook', 'Fisik & Ebook') AND ebookFile IS NOT NULL AND ebookFile <> ''"
+
+// Model feed yang netral, lalu dirender ke Atom (OPDS 1.2) atau JSON (OPDS 2.0)
+type opdsFeed struct {
+	ID           string
+	Title        string
+	Self         string
+	Kind         string // navigation / acquisition
+	Next         string
+	Prev         string
+	Navigation   []opdsNavEntry
+	Publications []catalogBook
+}
+
+type opdsNavEntry struct {
+	Title   string
+	Href    string
+	Kind    string
+	Summary string
+}
+
+// Context satu request OPDS: base path (dengan token jika ada) & versi
+type opdsContext struct {
+	Base string // contoh: /opds atau /opds/t/<token>
+	V2   bool
+	User User
+}
+
+func (c opdsContext) link(p string, q url.Values) string {
+	href := c.Base
+	if c.V2 {
+		href += "/v2"
+	}
+	href += p
+	if len(q) > 0 {
+		href += "?" + q.Encode()
+	}
+	return href
+}
+
+// Handler utama /opds/...
+//
+//	/opds                      root navigasi
+//	/opds/categories           navigasi per kategori
+//	/opds/genres               navigasi per genre
+//	/opds/books?category=&genre=&search=&page=   feed akuisisi
+//	/opds/new                  ebook terbaru
+//	/opds/search.xml           OpenSearch description
+//	/opds/download/{id}        unduh ebook (cek hak akses seperti reader)
+//
+// Prefix /opds/v2/... menghasilkan OPDS 2.0 (JSON).
+// Prefix /opds/t/{token}/... untuk aplikasi e-reader yang memakai feed token.
+func opdsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/opds")
+	ctx := opdsContext{Base: "/opds"}
+
+	token := ""
+	if strings.HasPrefix(rest, "/t/") {
+		parts := strings.SplitN(strings.TrimPrefix(rest, "/t/"), "/", 2)
+		token = parts[0]
+		ctx.Base = "/opds/t/" + token
+		rest = ""
+		if len(parts) == 2 {
+			rest = "/" + parts[1]
+		}
+	}
+
+	user, ok := opdsAuthenticate(r, token)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Libra OPDS", charset="UTF-8"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ctx.User = user
+
+	if rest == "/v2" || strings.HasPrefix(rest, "/v2/") {
+		ctx.V2 = true
+		rest = strings.TrimPrefix(rest, "/v2")
+	}
+	rest = strings.TrimSuffix(rest, "/")
+
+	// Link akuisisi: file ebook tidak publik, dilayani setelah cek hak akses
+	if strings.HasPrefix(rest, "/download/") {
+		bookID, err := strconv.Atoi(strings.TrimPrefix(rest, "/download/"))
+		if err != nil {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		file, status, msg := ebookEntitlement(user.ID, user.Role, bookID)
+		if status != 0 {
+			http.Error(w, msg, status)
+			return
+		}
+		serveEbookFile(w, r, user.ID, user.Role, bookID, file, time.Time{})
+		return
+	}
+
+	var feed opdsFeed
+	var err error
+	switch rest {
+	case "":
+		feed = opdsRootFeed(ctx)
+	case "/categories":
+		feed, err = opdsCategoriesFeed(ctx)
+	case "/genres":
+		feed, err = opdsGenresFeed(ctx)
+	case "/books", "/new":
+		q := r.URL.Query()
+		if rest == "/new" {
+			q.Set("sort", "new")
+		}
+		feed, err = opdsBooksFeed(ctx, rest, q)
+	case "/search.xml":
+		opdsOpenSearchHandler(w, ctx)
+		return
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Println("OPDS error:", err)
+		http.Error(w, "Gagal membuat feed", http.StatusInternalServerError)
+		return
+	}
+
+	if ctx.V2 {
+		writeOPDS2(w, ctx, feed)
+	} else {
+		writeOPDSAtom(w, ctx, feed)
+	}
+}
+
+// Autentikasi: feed token, session cookie, atau HTTP Basic
+func opdsAuthenticate(r *http.Request, token string) (User, bool) {
+	if token != "" {
+		var u User
+		err := db.QueryRow(`
+			SELECT u.id, u.fullname, u.username, u.email, u.role
+			FROM opds_tokens t
+			JOIN users u ON t.userId = u.id
+			WHERE t.token = ?`, token).Scan(&u.ID, &u.Fullname, &u.Username, &u.Email, &u.Role)
+		if err != nil {
+			return User{}, false
+		}
+		db.Exec("UPDATE opds_tokens SET lastUsed = NOW() WHERE token = ?", token)
+		return u, true
+	}
+
+	if u := getCurrentUser(r); u.ID != 0 {
+		return u, true
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return User{}, false
+	}
+
+	var u User
+	var passwordHash string
+	var verified bool
+	err := db.QueryRow(`
+		SELECT id, fullname, username, email, role, password, verified
+		FROM users
+		WHERE username = ?`, username).
+		Scan(&u.ID, &u.Fullname, &u.Username, &u.Email, &u.Role, &passwordHash, &verified)
+	if err != nil || !verified {
+		return User{}, false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) != nil {
+		return User{}, false
+	}
+	return u, true
+}
+
+func opdsRootFeed(ctx opdsContext) opdsFeed {
+	return opdsFeed{
+		ID:    "urn:libra:opds:root",
+		Title: "Libra - Katalog Ebook",
+		Self:  ctx.link("", nil),
+		Kind:  "navigation",
+		Navigation: []opdsNavEntry{
+			{Title: "Semua Ebook", Href: ctx.link("/books", nil), Kind: "acquisition", Summary: "Seluruh koleksi ebook perpustakaan"},
+			{Title: "Ebook Terbaru", Href: ctx.link("/new", nil), Kind: "acquisition", Summary: "Ebook yang baru ditambahkan"},
+			{Title: "Kategori", Href: ctx.link("/categories", nil), Kind: "navigation", Summary: "Telusuri ebook per kategori"},
+			{Title: "Genre", Href: ctx.link("/genres", nil), Kind: "navigation", Summary: "Telusuri ebook per genre"},
+		},
+	}
+}
+
+func opdsCategoriesFeed(ctx opdsContext) (opdsFeed, error) {
+	feed := opdsFeed{ID: "urn:libra:opds:categories", Title: "Kategori", Self: ctx.link("/categories", nil), Kind: "navigation"}
+
+	rows, err := db.Query(`
+		SELECT category, COUNT(*) FROM books
+		WHERE ` + opdsEbookCondition + ` AND category IS NOT NULL AND category <> ''
+		GROUP BY category ORDER BY category`)
+	if err != nil {
+		return feed, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var category string
+		var count int
+		if err := rows.Scan(&category, &count); err != nil {
+			continue
+		}
+		feed.Navigation = append(feed.Navigation, opdsNavEntry{
+			Title:   category,
+			Href:    ctx.link("/books", url.Values{"category": {category}}),
+			Kind:    "acquisition",
+			Summary: fmt.Sprintf("%d ebook", count),
+		})
+	}
+	return feed, rows.Err()
+}
+
+func opdsGenresFeed(ctx opdsContext) (opdsFeed, error) {
+	feed := opdsFeed{ID: "urn:libra:opds:genres", Title: "Genre", Self: ctx.link("/genres", nil), Kind: "navigation"}
+
+	rows, err := db.Query("SELECT genre FROM books WHERE " + opdsEbookCondition + " AND genre IS NOT NULL")
+	if err != nil {
+		return feed, err
+	}
+	defer rows.Close()
+
+	// Genre disimpan sebagai teks dipisah koma, hitung per tag
+	counts := map[string]int{}
+	names := map[string]string{}
+	for rows.Next() {
+		var genre string
+		if err := rows.Scan(&genre); err != nil {
+			continue
+		}
+		for _, g := range strings.Split(genre, ",") {
+			g = strings.TrimSpace(g)
+			if g == "" {
+				continue
+			}
+			key := strings.ToLower(g)
+			if _, ok := names[key]; !ok {
+				names[key] = g
+			}
+			counts[key]++
+		}
+	}
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		feed.Navigation = append(feed.Navigation, opdsNavEntry{
+			Title:   names[k],
+			Href:    ctx.link("/books", url.Values{"genre": {names[k]}}),
+			Kind:    "acquisition",
+			Summary: fmt.Sprintf("%d ebook", counts[k]),
+		})
+	}
+	return feed, rows.Err()
+}
+
+// Feed akuisisi, filter memakai logika yang sama dengan /books
+func opdsBooksFeed(ctx opdsContext, p string, q url.Values) (opdsFeed, error) {
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	filter := url.Values{}
+	for _, key := range []string{"search", "category", "genre"} {
+		if v, ok := q[key]; ok {
+			filter[key] = v
+		}
+	}
+
+	title := "Semua Ebook"
+	switch {
+	case q.Get("sort") == "new":
+		title = "Ebook Terbaru"
+	case filter.Get("search") != "":
+		title = "Hasil pencarian: " + filter.Get("search")
+	case filter.Get("category") != "":
+		title = "Kategori: " + filter.Get("category")
+	case filter.Get("genre") != "":
+		title = "Genre: " + strings.Join(filter["genre"], ", ")
+	}
+
+	pageLink := func(n int) string {
+		v := url.Values{}
+		for k, vals := range filter {
+			v[k] = vals
+		}
+		if n > 1 {
+			v.Set("page", strconv.Itoa(n))
+		}
+		return ctx.link(p, v)
+	}
+
+	feed := opdsFeed{
+		ID:    "urn:libra:opds:books:" + filter.Encode() + ":" + strconv.Itoa(page),
+		Title: title,
+		Self:  pageLink(page),
+		Kind:  "acquisition",
+	}
+
+	conditions, args := buildBookFilters(filter)
+	conditions = append(conditions, opdsEbookCondition)
+
+	order := " ORDER BY title, id"
+	if q.Get("sort") == "new" {
+		order = " ORDER BY created_at DESC, id DESC"
+	}
+
+	query := "SELECT " + catalogBookColumns + " FROM books b WHERE " + strings.Join(conditions, " AND ") + order + " LIMIT ? OFFSET ?"
+	args = append(args, opdsPageSize+1, (page-1)*opdsPageSize)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return feed, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		b, err := scanCatalogBook(rows)
+		if err != nil {
+			continue
+		}
+		feed.Publications = append(feed.Publications, b)
+	}
+
+	if len(feed.Publications) > opdsPageSize {
+		feed.Publications = feed.Publications[:opdsPageSize]
+		feed.Next = pageLink(page + 1)
+	}
+	if page > 1 {
+		feed.Prev = pageLink(page - 1)
+	}
+	return feed, rows.Err()
+}
+
+// OpenSearch description, template mengarah ke feed akuisisi dengan ?search=
+func opdsOpenSearchHandler(w http.ResponseWriter, ctx opdsContext) {
+	acq := ctx
+	acq.V2 = false
+	template := acq.link("/books", nil) + "?search={searchTerms}"
+
+	w.Header().Set("Content-Type", opdsOpenSearch+"; charset=utf-8")
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+  <ShortName>Libra</ShortName>
+  <Description>Cari ebook di perpustakaan Libra</Description>
+  <InputEncoding>UTF-8</InputEncoding>
+  <OutputEncoding>UTF-8</OutputEncoding>
+  <Url type="%s" template="%s"/>
+</OpenSearchDescription>
+`, xmlEscape(opdsAtomAcquisition), xmlEscape(template))
+}
+
+// --- Render OPDS 1.2 (Atom) ---
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	XmlnsDC string      `xml:"xmlns:dc,attr"`
+	XmlnsOS string      `xml:"xmlns:opds,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomAuthor   `xml:"author"`
+	Identifier string         `xml:"dc:identifier,omitempty"`
+	Publisher  string         `xml:"dc:publisher,omitempty"`
+	Issued     string         `xml:"dc:issued,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+	Content    *atomContent   `xml:"content,omitempty"`
+	Links      []atomLink     `xml:"link"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func writeOPDSAtom(w http.ResponseWriter, ctx opdsContext, feed opdsFeed) {
+	kindType := opdsAtomNavigation
+	if feed.Kind == "acquisition" {
+		kindType = opdsAtomAcquisition
+	}
+
+	out := atomFeed{
+		Xmlns:   "http://www.w3.org/2005/Atom",
+		XmlnsDC: "http://purl.org/dc/terms/",
+		XmlnsOS: "http://opds-spec.org/2010/catalog",
+		ID:      feed.ID,
+		Title:   feed.Title,
+		Updated: time.Now().Format(time.RFC3339),
+		Author:  &atomAuthor{Name: "Perpustakaan Libra"},
+		Links: []atomLink{
+			{Rel: "self", Href: feed.Self, Type: kindType},
+			{Rel: "start", Href: ctx.link("", nil), Type: opdsAtomNavigation},
+			{Rel: "search", Href: ctx.link("/search.xml", nil), Type: opdsOpenSearch},
+		},
+	}
+	if feed.Next != "" {
+		out.Links = append(out.Links, atomLink{Rel: "next", Href: feed.Next, Type: kindType})
+	}
+	if feed.Prev != "" {
+		out.Links = append(out.Links, atomLink{Rel: "previous", Href: feed.Prev, Type: kindType})
+	}
+
+	for _, nav := range feed.Navigation {
+		t := opdsAtomNavigation
+		if nav.Kind == "acquisition" {
+			t = opdsAtomAcquisition
+		}
+		out.Entries = append(out.Entries, atomEntry{
+			ID:      "urn:libra:opds:nav:" + nav.Href,
+			Title:   nav.Title,
+			Updated: out.Updated,
+			Content: &atomContent{Type: "text", Value: nav.Summary},
+			Links:   []atomLink{{Rel: "subsection", Href: nav.Href, Type: t}},
+		})
+	}
+
+	for _, b := range feed.Publications {
+		entry := atomEntry{
+			ID:         fmt.Sprintf("urn:libra:book:%d", b.ID),
+			Title:      b.Title,
+			Updated:    b.CreatedAt.Format(time.RFC3339),
+			Identifier: opdsIdentifier(b),
+			Publisher:  b.Publisher,
+			Summary:    b.Description,
+		}
+		if b.Author != "" {
+			entry.Authors = append(entry.Authors, atomAuthor{Name: b.Author})
+		}
+		if b.Year > 0 {
+			entry.Issued = strconv.Itoa(b.Year)
+		}
+		for _, g := range opdsSubjects(b) {
+			entry.Categories = append(entry.Categories, atomCategory{Term: g, Label: g})
+		}
+		for _, l := range opdsBookLinks(ctx, b) {
+			entry.Links = append(entry.Links, atomLink{Rel: l.Rel, Href: l.Href, Type: l.Type})
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+
+	w.Header().Set("Content-Type", kindType+"; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		log.Println("OPDS encode error:", err)
+	}
+}
+
+// --- Render OPDS 2.0 (JSON) ---
+
+type opds2Link struct {
+	Rel       string `json:"rel,omitempty"`
+	Href      string `json:"href"`
+	Type      string `json:"type,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Templated bool   `json:"templated,omitempty"`
+}
+
+func writeOPDS2(w http.ResponseWriter, ctx opdsContext, feed opdsFeed) {
+	links := []opds2Link{
+		{Rel: "self", Href: feed.Self, Type: opdsJSON},
+		{Rel: "start", Href: ctx.link("", nil), Type: opdsJSON},
+		{Rel: "search", Href: ctx.link("/books", nil) + "{?search}", Type: opdsJSON, Templated: true},
+	}
+	if feed.Next != "" {
+		links = append(links, opds2Link{Rel: "next", Href: feed.Next, Type: opdsJSON})
+	}
+	if feed.Prev != "" {
+		links = append(links, opds2Link{Rel: "previous", Href: feed.Prev, Type: opdsJSON})
+	}
+
+	out := map[string]interface{}{
+		"metadata": map[string]interface{}{"title": feed.Title},
+		"links":    links,
+	}
+
+	if len(feed.Navigation) > 0 {
+		var nav []opds2Link
+		for _, n := range feed.Navigation {
+			nav = append(nav, opds2Link{Href: n.Href, Title: n.Title, Type: opdsJSON})
+		}
+		out["navigation"] = nav
+	}
+
+	if feed.Kind == "acquisition" {
+		pubs := []map[string]interface{}{}
+		for _, b := range feed.Publications {
+			meta := map[string]interface{}{
+				"@type":      "http://schema.org/Book",
+				"identifier": opdsIdentifier(b),
+				"title":      b.Title,
+				"modified":   b.CreatedAt.Format(time.RFC3339),
+			}
+			if b.Author != "" {
+				meta["author"] = b.Author
+			}
+			if b.Publisher != "" {
+				meta["publisher"] = b.Publisher
+			}
+			if b.Year > 0 {
+				meta["published"] = strconv.Itoa(b.Year)
+			}
+			if b.Description != "" {
+				meta["description"] = b.Description
+			}
+			if subjects := opdsSubjects(b); len(subjects) > 0 {
+				meta["subject"] = subjects
+			}
+
+			var bookLinks, images []opds2Link
+			for _, l := range opdsBookLinks(ctx, b) {
+				if l.Rel == opdsRelImage || l.Rel == opdsRelThumbnail {
+					images = append(images, opds2Link{Href: l.Href, Type: l.Type})
+					continue
+				}
+				bookLinks = append(bookLinks, l)
+			}
+
+			pub := map[string]interface{}{"metadata": meta, "links": bookLinks}
+			if len(images) > 0 {
+				pub["images"] = images
+			}
+			pubs = append(pubs, pub)
+		}
+		out["publications"] = pubs
+	}
+
+	w.Header().Set("Content-Type", opdsJSON+"; charset=utf-8")
+	json.NewEncoder(w).Encode(out)
+}
+
+// Identifier publikasi: urn:isbn jika ada ISBN, selain itu urn internal
+func opdsIdentifier(b catalogBook) string {
+	if b.ISBN != "" {
+		return "urn:isbn:" + b.ISBN
+	}
+	return fmt.Sprintf("urn:libra:book:%d", b.ID)
+}
+
+func opdsSubjects(b catalogBook) []string {
+	var out []string
+	for _, g := range strings.Split(b.Genre, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// Link akuisisi & gambar sampul satu buku
+func opdsBookLinks(ctx opdsContext, b catalogBook) []opds2Link {
+	var links []opds2Link
+	if b.EbookFile != "" {
+		href := fmt.Sprintf("%s/download/%d", ctx.Base, b.ID)
+		links = append(links, opds2Link{Rel: opdsRelAcquisition, Href: href, Type: opdsFileType(b.EbookFile)})
+	}
+	if b.CoverFile != "" {
+		cover := "/" + strings.TrimPrefix(b.CoverFile, "/")
+		links = append(links,
+			opds2Link{Rel: opdsRelImage, Href: cover, Type: opdsFileType(b.CoverFile)},
+			opds2Link{Rel: opdsRelThumbnail, Href: cover, Type: opdsFileType(b.CoverFile)},
+		)
+	}
+	return links
+}
+
+func opdsFileType(file string) string {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".pdf":
+		return "application/pdf"
+	case ".epub":
+		return "application/epub+zip"
+	}
+	if t := mime.TypeByExtension(path.Ext(file)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+// API Handler: Feed token OPDS milik user yang login
+// GET  -> ambil token (dibuat jika belum ada)
+// POST -> buat ulang token (token lama tidak berlaku)
+func opdsTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user := getCurrentUser(r)
+	if user.ID == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "User belum login"})
+		return
+	}
+
+	var token string
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		err = db.QueryRow("SELECT token FROM opds_tokens WHERE userId = ?", user.ID).Scan(&token)
+		if err == sql.ErrNoRows {
+			token, err = createOPDSToken(user.ID)
+		}
+	case http.MethodPost:
+		token, err = createOPDSToken(user.ID)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Method tidak diizinkan"})
+		return
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"token":   token,
+		"feedUrl": "/opds/t/" + token,
+		"feedV2":  "/opds/t/" + token + "/v2",
+	})
+}
+
+func createOPDSToken(userID int) (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	_, err := db.Exec(`
+		INSERT INTO opds_tokens (userId, token) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE token = ?, createdAt = NOW(), lastUsed = NULL
+	`, userID, token, token)
+	return token, err
+}
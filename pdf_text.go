@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// PDF TEKS SEDERHANA
+// Penulis PDF minimal (A4, font standar Helvetica, encoding WinAnsi) untuk
+// dokumen yang isinya hanya teks, misalnya ekspor catatan ebook. Tidak perlu
+// library tambahan; lebar teks diperkirakan dari rata-rata lebar huruf.
+// ==========================================
+
+const (
+	pdfPageWidth  = 595.0 // A4 dalam point
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+)
+
+type pdfLine struct {
+	text string
+	size float64
+	bold bool
+	gray bool
+	x, y float64
+}
+
+type textPDF struct {
+	title string
+	pages [][]pdfLine
+	y     float64
+}
+
+func newTextPDF(title string) *textPDF {
+	p := &textPDF{title: title}
+	p.newPage()
+	return p
+}
+
+func (p *textPDF) newPage() {
+	p.pages = append(p.pages, nil)
+	p.y = pdfPageHeight - pdfMargin
+}
+
+// Tambah paragraf; teks panjang dipecah per kata mengikuti lebar halaman
+func (p *textPDF) paragraph(text string, size float64, bold bool, indent float64) {
+	p.write(text, size, bold, indent, false)
+}
+
+// Sama seperti paragraph tetapi dicetak abu-abu (untuk keterangan kecil)
+func (p *textPDF) caption(text string, size float64, indent float64) {
+	p.write(text, size, false, indent, true)
+}
+
+func (p *textPDF) write(text string, size float64, bold bool, indent float64, gray bool) {
+	// Perkiraan lebar huruf Helvetica ~0.5em (bold sedikit lebih lebar)
+	charWidth := size * 0.5
+	if bold {
+		charWidth = size * 0.55
+	}
+	maxChars := int((pdfPageWidth - 2*pdfMargin - indent) / charWidth)
+
+	for _, para := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		for _, line := range wrapWords(para, maxChars) {
+			p.put(pdfLine{text: line, size: size, bold: bold, gray: gray, x: pdfMargin + indent})
+		}
+	}
+}
+
+// Jarak vertikal kosong
+func (p *textPDF) space(h float64) {
+	p.y -= h
+}
+
+func (p *textPDF) put(l pdfLine) {
+	lead := l.size * 1.35
+	if p.y-lead < pdfMargin {
+		p.newPage()
+	}
+	p.y -= lead
+	l.y = p.y
+	p.pages[len(p.pages)-1] = append(p.pages[len(p.pages)-1], l)
+}
+
+func wrapWords(s string, maxChars int) []string {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	var lines []string
+	cur := ""
+	for _, w := range words {
+		// Kata yang lebih panjang dari satu baris dipotong paksa
+		for len([]rune(w)) > maxChars {
+			if cur != "" {
+				lines = append(lines, cur)
+				cur = ""
+			}
+			rw := []rune(w)
+			lines = append(lines, string(rw[:maxChars]))
+			w = string(rw[maxChars:])
+		}
+		switch {
+		case cur == "":
+			cur = w
+		case len([]rune(cur))+1+len([]rune(w)) <= maxChars:
+			cur += " " + w
+		default:
+			lines = append(lines, cur)
+			cur = w
+		}
+	}
+	return append(lines, cur)
+}
+
+// Ubah teks ke WinAnsi dan escape karakter khusus string PDF
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteString("    ")
+		case r < 32:
+			// karakter kontrol dibuang
+		case r < 128:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			if c, ok := winAnsiExtra[r]; ok {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
+
+// Karakter Unicode yang ada di rentang 0x80-0x9F WinAnsi
+var winAnsiExtra = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '•': 0x95,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+func (p *textPDF) Bytes() []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catalog, 2 pages, 3-4 font, 5 info, lalu (page, content) per halaman
+	const firstPage = 6
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	obj(fmt.Sprintf("<< /Title (%s) /Producer (Perpustakaan) /CreationDate (D:%s) >>",
+		pdfString(p.title), time.Now().Format("20060102150405")))
+
+	for i, lines := range p.pages {
+		var content bytes.Buffer
+		for _, l := range lines {
+			font := "F1"
+			if l.bold {
+				font = "F2"
+			}
+			color := "0 g"
+			if l.gray {
+				color = "0.4 g"
+			}
+			fmt.Fprintf(&content, "BT %s /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", color, font, l.size, l.x, l.y, pdfString(l.text))
+		}
+		fmt.Fprintf(&content, "BT 0.5 g /F1 8 Tf %.2f %.2f Td (%d / %d) Tj ET\n", pdfPageWidth/2-10, pdfMargin/2, i+1, len(p.pages))
+
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, firstPage+2*i+1))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWrapWords(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		max  int
+		want []string
+	}{
+		{"kosong", "   ", 10, []string{""}},
+		{"muat satu baris", "halo dunia", 10, []string{"halo dunia"}},
+		{"pindah baris", "satu dua tiga empat", 9, []string{"satu dua", "tiga", "empat"}},
+		{"spasi berlebih", "  satu \n dua\tt ", 20, []string{"satu dua t"}},
+		{"kata terlalu panjang", "ab abcdefghijkl cd", 5, []string{"ab", "abcde", "fghij", "kl cd"}},
+		{"unicode dihitung per karakter", "café résumé", 6, []string{"café", "résumé"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wrapWords(tt.text, tt.max); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrapWords(%q, %d) = %q, ingin %q", tt.text, tt.max, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	tests := map[string]string{
+		"Halo":          "Halo",
+		`(catatan) a\b`: `\(catatan\) a\\b`,
+		"a\tb":          "a    b",
+		"baris\nbaru\r": "barisbaru",
+		"café":          `caf\351`,
+		"“kutip” – €5":  `\223kutip\224 \226 \2005`,
+		"日本":            "??",
+	}
+	for in, want := range tests {
+		if got := pdfString(in); got != want {
+			t.Errorf("pdfString(%q) = %q, ingin %q", in, got, want)
+		}
+	}
+}
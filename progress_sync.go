@@ -0,0 +1,377 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// SINKRONISASI PROGRES BACA ANTAR PERANGKAT
+// Setiap simpan progres membawa ID perangkat & waktu klien. Posisi terakhir
+// tiap perangkat selalu dicatat di ebook_progress_devices; posisi utama
+// (ebook_history) hanya diganti sesuai kebijakan (env EBOOK_PROGRESS_POLICY):
+//
+//	furthest  posisi terjauh yang menang (default)
+//	latest    waktu klien terbaru yang menang; perangkat lain yang posisinya
+//	          berbeda mendapat tawaran (prompt) untuk pindah ke posisi itu
+//
+// Perbandingan posisi: halaman untuk PDF, persentase untuk EPUB (CFI).
+// ==========================================
+
+const (
+	progressPolicyFurthest = "furthest"
+	progressPolicyLatest   = "latest"
+
+	defaultDeviceID = "web" // klien lama yang belum mengirim deviceId
+	// Jam klien yang terlalu maju dipotong ke waktu server
+	maxClientClockSkew = 5 * time.Minute
+)
+
+var (
+	progressPolicy = loadProgressPolicy()
+
+	deviceIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,64}$`)
+)
+
+func loadProgressPolicy() string {
+	if strings.ToLower(os.Getenv("EBOOK_PROGRESS_POLICY")) == progressPolicyLatest {
+		return progressPolicyLatest
+	}
+	return progressPolicyFurthest
+}
+
+// Posisi baca pada satu buku
+type EbookPosition struct {
+	Page       int        `json:"page"`
+	Location   string     `json:"location"`
+	Progress   float64    `json:"progress"`
+	DeviceID   string     `json:"deviceId,omitempty"`
+	DeviceName string     `json:"deviceName,omitempty"`
+	ClientAt   *time.Time `json:"clientAt,omitempty"`
+}
+
+// Posisi p lebih jauh atau sama dengan q
+func (p EbookPosition) atLeast(q EbookPosition) bool {
+	if p.Location != "" || q.Location != "" {
+		return p.Progress >= q.Progress
+	}
+	return p.Page >= q.Page
+}
+
+func (p EbookPosition) samePlace(q EbookPosition) bool {
+	if p.Location != "" || q.Location != "" {
+		return p.Location == q.Location
+	}
+	return p.Page == q.Page
+}
+
+type EbookDevice struct {
+	DeviceID   string    `json:"deviceId"`
+	Name       string    `json:"name"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	// Posisi terakhir perangkat (buku yang terakhir dibaca, atau ?bookId=)
+	BookID   int            `json:"bookId,omitempty"`
+	Title    string         `json:"title,omitempty"`
+	Position *EbookPosition `json:"position,omitempty"`
+}
+
+// Waktu klien (ms epoch); kosong / terlalu maju -> waktu server
+func clientTimeOf(ms int64) time.Time {
+	now := time.Now()
+	if ms <= 0 {
+		return now
+	}
+	t := time.UnixMilli(ms)
+	if t.After(now.Add(maxClientClockSkew)) {
+		return now
+	}
+	return t
+}
+
+// ID & nama perangkat yang disimpan; false jika deviceId tidak valid
+func normalizeDevice(id, name string) (string, string, bool) {
+	if id == "" {
+		id = defaultDeviceID
+	}
+	if !deviceIDPattern.MatchString(id) {
+		return "", "", false
+	}
+	name = truncateRunes(strings.TrimSpace(name), 100)
+	if name == "" {
+		name = "Perangkat " + id[:minInt(len(id), 8)]
+	}
+	return id, name, true
+}
+
+// Simpan progres perangkat & terapkan kebijakan konflik ke posisi utama.
+// Mengembalikan apakah posisi utama diganti, beserta posisi utama terkini.
+func syncEbookProgress(userID int, req EbookProgressRequest) (bool, EbookPosition, error) {
+	deviceID, deviceName, _ := normalizeDevice(req.DeviceID, req.DeviceName)
+	clientAt := clientTimeOf(req.ClientTime)
+	incoming := EbookPosition{
+		Page:       req.Page,
+		Location:   req.Location,
+		Progress:   math.Max(0, math.Min(100, req.Progress)),
+		DeviceID:   deviceID,
+		DeviceName: deviceName,
+		ClientAt:   &clientAt,
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, EbookPosition{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO ebook_devices (userId, deviceId, name, lastSeenAt) VALUES (?, ?, ?, NOW())
+		ON DUPLICATE KEY UPDATE name = VALUES(name), lastSeenAt = NOW()`,
+		userID, deviceID, deviceName); err != nil {
+		return false, EbookPosition{}, err
+	}
+	// Posisi per perangkat: kiriman yang datang terlambat (clientAt lebih lama) diabaikan.
+	// clientAt di-SET paling akhir karena kondisi IF membaca nilai lamanya.
+	if _, err := tx.Exec(`
+		INSERT INTO ebook_progress_devices (userId, bookId, deviceId, page, location, progress, clientAt, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NOW())
+		ON DUPLICATE KEY UPDATE
+			page = IF(VALUES(clientAt) >= clientAt, VALUES(page), page),
+			location = IF(VALUES(clientAt) >= clientAt, VALUES(location), location),
+			progress = IF(VALUES(clientAt) >= clientAt, VALUES(progress), progress),
+			updatedAt = NOW(),
+			clientAt = GREATEST(clientAt, VALUES(clientAt))`,
+		userID, req.BookID, deviceID, req.Page, nullIfEmpty(req.Location), incoming.Progress, clientAt); err != nil {
+		return false, EbookPosition{}, err
+	}
+
+	current, exists, err := loadEbookPosition(tx, userID, req.BookID, true)
+	if err != nil {
+		return false, EbookPosition{}, err
+	}
+
+	apply := !exists
+	if exists {
+		switch progressPolicy {
+		case progressPolicyLatest:
+			apply = current.ClientAt == nil || !clientAt.Before(*current.ClientAt)
+		default:
+			apply = incoming.atLeast(current)
+		}
+	}
+
+	if apply {
+		// PDF menyimpan halaman, EPUB menyimpan CFI; kolom lainnya dibiarkan
+		if req.Location != "" {
+			_, err = tx.Exec(`
+				INSERT INTO ebook_history (userId, bookId, lastLocation, progress, lastDeviceId, lastClientAt, dateLastRead)
+				VALUES (?, ?, ?, ?, ?, ?, NOW())
+				ON DUPLICATE KEY UPDATE lastLocation = VALUES(lastLocation), progress = VALUES(progress),
+					lastDeviceId = VALUES(lastDeviceId), lastClientAt = VALUES(lastClientAt), dateLastRead = NOW()`,
+				userID, req.BookID, req.Location, incoming.Progress, deviceID, clientAt)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO ebook_history (userId, bookId, lastPage, lastDeviceId, lastClientAt, dateLastRead)
+				VALUES (?, ?, ?, ?, ?, NOW())
+				ON DUPLICATE KEY UPDATE lastPage = VALUES(lastPage),
+					lastDeviceId = VALUES(lastDeviceId), lastClientAt = VALUES(lastClientAt), dateLastRead = NOW()`,
+				userID, req.BookID, req.Page, deviceID, clientAt)
+		}
+		current = incoming
+	} else {
+		// Posisi utama tetap, tapi buku tetap naik di riwayat baca
+		_, err = tx.Exec("UPDATE ebook_history SET dateLastRead = NOW() WHERE userId = ? AND bookId = ?", userID, req.BookID)
+	}
+	if err != nil {
+		return false, EbookPosition{}, err
+	}
+	return apply, current, tx.Commit()
+}
+
+// Posisi utama dari ebook_history (forUpdate: kunci baris dalam transaksi)
+func loadEbookPosition(q sqlQueryer, userID, bookID int, forUpdate bool) (EbookPosition, bool, error) {
+	query := `
+		SELECT h.lastPage, h.lastLocation, h.progress, h.lastDeviceId, d.name, h.lastClientAt
+		FROM ebook_history h
+		LEFT JOIN ebook_devices d ON d.userId = h.userId AND d.deviceId = h.lastDeviceId
+		WHERE h.userId = ? AND h.bookId = ?`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var p EbookPosition
+	var location, deviceID, deviceName sql.NullString
+	var clientAt sql.NullTime
+	err := q.QueryRow(query, userID, bookID).Scan(&p.Page, &location, &p.Progress, &deviceID, &deviceName, &clientAt)
+	if err == sql.ErrNoRows {
+		return p, false, nil
+	}
+	if err != nil {
+		return p, false, err
+	}
+	p.Location, p.DeviceID, p.DeviceName = location.String, deviceID.String, deviceName.String
+	if clientAt.Valid {
+		p.ClientAt = &clientAt.Time
+	}
+	return p, true, nil
+}
+
+// Posisi terakhir satu perangkat pada satu buku
+func loadDevicePosition(userID, bookID int, deviceID string) (EbookPosition, bool) {
+	var p EbookPosition
+	var location, name sql.NullString
+	var clientAt time.Time
+	err := db.QueryRow(`
+		SELECT p.page, p.location, p.progress, d.name, p.clientAt
+		FROM ebook_progress_devices p
+		LEFT JOIN ebook_devices d ON d.userId = p.userId AND d.deviceId = p.deviceId
+		WHERE p.userId = ? AND p.bookId = ? AND p.deviceId = ?`, userID, bookID, deviceID).
+		Scan(&p.Page, &location, &p.Progress, &name, &clientAt)
+	if err != nil {
+		return p, false
+	}
+	p.Location, p.DeviceID, p.DeviceName, p.ClientAt = location.String, deviceID, name.String, &clientAt
+	return p, true
+}
+
+// Data resume untuk reader. Dengan kebijakan "latest", perangkat yang posisinya
+// berbeda dari posisi utama (dibaca di perangkat lain) mendapat prompt: reader
+// mulai dari posisinya sendiri lalu menawarkan pindah ke posisi utama.
+func ebookResumeInfo(userID, bookID int, deviceID string) map[string]interface{} {
+	current, _, err := loadEbookPosition(db, userID, bookID, false)
+	if err != nil {
+		log.Println("Ambil progres ebook gagal:", err)
+	}
+	if current.Page < 1 {
+		current.Page = 1 // Default halaman 1
+	}
+
+	resp := map[string]interface{}{
+		"page":     current.Page,
+		"location": current.Location,
+		"progress": current.Progress,
+		"policy":   progressPolicy,
+		"position": current,
+	}
+	if progressPolicy != progressPolicyLatest || deviceID == "" || current.DeviceID == "" || current.DeviceID == deviceID {
+		return resp
+	}
+	own, ok := loadDevicePosition(userID, bookID, deviceID)
+	if !ok || own.samePlace(current) {
+		return resp
+	}
+	if own.Page < 1 {
+		own.Page = 1
+	}
+	resp["page"], resp["location"], resp["progress"] = own.Page, own.Location, own.Progress
+	resp["prompt"] = current
+	return resp
+}
+
+// API Handler: daftar perangkat member & posisi terakhir masing-masing
+// GET /api/ebook/devices?bookId=1 (opsional: posisi pada buku tertentu)
+// DELETE /api/ebook/devices?deviceId=abc (lupakan perangkat)
+func ebookDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user := getCurrentUser(r)
+	if user.ID == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "User belum login"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		bookID, _ := strconv.Atoi(r.URL.Query().Get("bookId"))
+		devices, err := loadEbookDevices(user.ID, bookID)
+		if err != nil {
+			log.Println("Daftar perangkat gagal:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Gagal memuat perangkat"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"policy":  progressPolicy,
+			"devices": devices,
+		})
+
+	case http.MethodDelete:
+		deviceID := r.URL.Query().Get("deviceId")
+		res, err := db.Exec("DELETE FROM ebook_devices WHERE userId = ? AND deviceId = ?", user.ID, deviceID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Gagal menghapus perangkat"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Perangkat tidak ditemukan"})
+			return
+		}
+		db.Exec("DELETE FROM ebook_progress_devices WHERE userId = ? AND deviceId = ?", user.ID, deviceID)
+		json.NewEncoder(w).Encode(Response{Success: true, Message: "Perangkat dihapus"})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Method not allowed"})
+	}
+}
+
+func loadEbookDevices(userID, bookID int) ([]EbookDevice, error) {
+	rows, err := db.Query("SELECT deviceId, name, lastSeenAt FROM ebook_devices WHERE userId = ? ORDER BY lastSeenAt DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	devices := []EbookDevice{}
+	byID := make(map[string]*EbookDevice)
+	for rows.Next() {
+		var d EbookDevice
+		if rows.Scan(&d.DeviceID, &d.Name, &d.LastSeenAt) == nil {
+			devices = append(devices, d)
+		}
+	}
+	rows.Close()
+	for i := range devices {
+		byID[devices[i].DeviceID] = &devices[i]
+	}
+
+	query := `
+		SELECT p.deviceId, p.bookId, b.title, p.page, p.location, p.progress, p.clientAt
+		FROM ebook_progress_devices p
+		JOIN books b ON b.id = p.bookId
+		WHERE p.userId = ?`
+	args := []interface{}{userID}
+	if bookID > 0 {
+		query += " AND p.bookId = ?"
+		args = append(args, bookID)
+	}
+	rows, err = db.Query(query+" ORDER BY p.clientAt DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var deviceID, title string
+		var id int
+		var pos EbookPosition
+		var location sql.NullString
+		var clientAt time.Time
+		if rows.Scan(&deviceID, &id, &title, &pos.Page, &location, &pos.Progress, &clientAt) != nil {
+			continue
+		}
+		// Baris pertama per perangkat = posisi terbaru
+		d := byID[deviceID]
+		if d == nil || d.Position != nil {
+			continue
+		}
+		pos.Location, pos.ClientAt = location.String, &clientAt
+		d.BookID, d.Title, d.Position = id, title, &pos
+	}
+	return devices, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEbookPositionAtLeast(t *testing.T) {
+	tests := []struct {
+		name string
+		p, q EbookPosition
+		want bool
+	}{
+		{"halaman lebih jauh", EbookPosition{Page: 12}, EbookPosition{Page: 10}, true},
+		{"halaman sama", EbookPosition{Page: 10}, EbookPosition{Page: 10}, true},
+		{"halaman mundur", EbookPosition{Page: 3}, EbookPosition{Page: 10}, false},
+		{"CFI progres lebih jauh", EbookPosition{Location: "epubcfi(/6/8!/4/2)", Progress: 40}, EbookPosition{Location: "epubcfi(/6/4!/4/2)", Progress: 25.5}, true},
+		{"CFI progres mundur", EbookPosition{Location: "epubcfi(/6/4!/4/2)", Progress: 25.5}, EbookPosition{Location: "epubcfi(/6/8!/4/2)", Progress: 40}, false},
+		// Salah satu berupa CFI: halaman diabaikan, dibandingkan dari persen
+		{"CFI melawan halaman", EbookPosition{Location: "epubcfi(/6/2!/4)", Progress: 10}, EbookPosition{Page: 50}, true},
+		{"halaman melawan CFI", EbookPosition{Page: 50}, EbookPosition{Location: "epubcfi(/6/2!/4)", Progress: 10}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.atLeast(tt.q); got != tt.want {
+				t.Errorf("atLeast = %v, ingin %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientTimeOf(t *testing.T) {
+	past := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	if got := clientTimeOf(past.UnixMilli()); !got.Equal(past) {
+		t.Errorf("waktu klien masa lalu = %v, ingin %v", got, past)
+	}
+	for _, ms := range []int64{0, -1, time.Now().Add(maxClientClockSkew + time.Hour).UnixMilli()} {
+		if got := clientTimeOf(ms); time.Since(got) > time.Second {
+			t.Errorf("clientTimeOf(%d) = %v, ingin waktu server", ms, got)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadingStreaks(t *testing.T) {
+	today := time.Date(2026, 3, 10, 0, 0, 0, 0, time.Local)
+	day := func(offset int) time.Time { return today.AddDate(0, 0, offset) }
+
+	tests := []struct {
+		name                 string
+		days                 []time.Time
+		wantCurrent, wantMax int
+	}{
+		{"belum pernah membaca", nil, 0, 0},
+		{"hanya hari ini", []time.Time{day(0)}, 1, 1},
+		{"terakhir kemarin masih berjalan", []time.Time{day(-1), day(-2), day(-3)}, 3, 3},
+		{"terputus dua hari lalu", []time.Time{day(-2), day(-3)}, 0, 2},
+		{"streak lama lebih panjang", []time.Time{day(0), day(-1), day(-5), day(-6), day(-7), day(-8)}, 2, 4},
+		{"ada hari bolong", []time.Time{day(0), day(-2), day(-3)}, 1, 2},
+		{"melewati pergantian bulan", []time.Time{
+			time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local),
+			time.Date(2026, 2, 28, 0, 0, 0, 0, time.Local),
+			time.Date(2026, 2, 27, 0, 0, 0, 0, time.Local),
+		}, 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, longest := readingStreaks(tt.days, today)
+			if current != tt.wantCurrent || longest != tt.wantMax {
+				t.Errorf("readingStreaks = (%d, %d), ingin (%d, %d)", current, longest, tt.wantCurrent, tt.wantMax)
+			}
+		})
+	}
+}
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// REKOMENDASI BUKU
+// - Collaborative filtering item-ke-item ("yang meminjam ini juga meminjam")
+// - Kemiripan konten (genre, penulis, kategori)
+// - Feed beranda: gabungan keduanya + fallback buku populer untuk user baru
+// Model dibangun ulang berkala di background dan dilayani dari memori.
+// ==========================================
+
+const (
+	recommendRebuildInterval = 30 * time.Minute
+	recommendNeighbors       = 30  // tetangga terdekat yang disimpan per buku
+	recommendMaxUserItems    = 200 // batasi pasangan per user agar build tidak meledak
+	recommendDefaultLimit    = 10
+	recommendMaxLimit        = 50
+	recommendPopularDays     = 90
+)
+
+// Bobot sinyal interaksi member dengan buku
+const (
+	signalBorrowed  = 3.0 // transaksi DIPINJAM / DIKEMBALIKAN / HILANG
+	signalReading   = 2.0 // pernah membuka ebook (ebook_history)
+	signalBookmark  = 1.0 // ada di salah satu rak baca
+	signalRequested = 1.0 // masih diajukan / disetujui
+)
+
+// Data buku ringkas yang dikirim ke frontend
+type recommendBook struct {
+	ID       int     `json:"id"`
+	Title    string  `json:"title"`
+	Author   string  `json:"author"`
+	Synopsis string  `json:"synopsis"`
+	Cover    string  `json:"cover"`
+	Category string  `json:"category"`
+	Type     string  `json:"type"`
+	Score    float64 `json:"score"`
+	Reason   string  `json:"reason,omitempty"`
+}
+
+type scoredBook struct {
+	ID    int
+	Score float64
+}
+
+type recommendModel struct {
+	builtAt   time.Time
+	books     map[int]recommendBook
+	userItems map[int]map[int]float64 // userID -> bookID -> bobot
+	coBorrow  map[int][]scoredBook    // CF item-ke-item, urut skor
+	content   map[int][]scoredBook    // kemiripan konten, urut skor
+	popular   []scoredBook            // cold start
+	newest    []int
+}
+
+var (
+	recommender   *recommendModel
+	recommenderMu sync.RWMutex
+)
+
+func currentRecommendModel() *recommendModel {
+	recommenderMu.RLock()
+	defer recommenderMu.RUnlock()
+	return recommender
+}
+
+// Bangun model saat startup lalu ulangi tiap recommendRebuildInterval
+func startRecommender() {
+	go func() {
+		for {
+			rebuildRecommendModel()
+			time.Sleep(recommendRebuildInterval)
+		}
+	}()
+}
+
+func rebuildRecommendModel() {
+	started := time.Now()
+	m, err := buildRecommendModel()
+	if err != nil {
+		log.Println("Gagal membangun model rekomendasi:", err)
+		return
+	}
+	recommenderMu.Lock()
+	recommender = m
+	recommenderMu.Unlock()
+	log.Printf("Model rekomendasi siap: %d buku, %d user (%s)", len(m.books), len(m.userItems), time.Since(started).Round(time.Millisecond))
+}
+
+func buildRecommendModel() (*recommendModel, error) {
+	m := &recommendModel{
+		builtAt:   time.Now(),
+		books:     make(map[int]recommendBook),
+		userItems: make(map[int]map[int]float64),
+	}
+
+	// 1. Data buku
+	rows, err := db.Query("SELECT id, title, author, description, coverFile, category, type FROM books ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var b recommendBook
+		var title, author, description, cover, category, tipe sql.NullString
+		if err := rows.Scan(&b.ID, &title, &author, &description, &cover, &category, &tipe); err != nil {
+			continue
+		}
+		b.Title, b.Author, b.Synopsis, b.Cover = title.String, author.String, description.String, cover.String
+		b.Category, b.Type = category.String, tipe.String
+		m.books[b.ID] = b
+		m.newest = append(m.newest, b.ID)
+	}
+	rows.Close()
+
+	// 2. Sinyal interaksi (diambil bobot terbesar per user-buku)
+	addSignal := func(userID, bookID int, w float64) {
+		if _, ok := m.books[bookID]; !ok {
+			return
+		}
+		items := m.userItems[userID]
+		if items == nil {
+			items = make(map[int]float64)
+			m.userItems[userID] = items
+		}
+		if w > items[bookID] {
+			items[bookID] = w
+		}
+	}
+	signalQueries := []struct {
+		query  string
+		weight float64
+	}{
+		{"SELECT user_id, book_id FROM transactions WHERE status IN ('DIPINJAM', 'DIKEMBALIKAN', 'HILANG')", signalBorrowed},
+		{"SELECT user_id, book_id FROM transactions WHERE status IN ('DIAJUKAN', 'DISETUJUI')", signalRequested},
+		{"SELECT userId, bookId FROM ebook_history", signalReading},
+		{"SELECT s.userId, i.bookId FROM shelf_items i JOIN shelves s ON s.id = i.shelfId", signalBookmark},
+	}
+	for _, sq := range signalQueries {
+		rows, err := db.Query(sq.query)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var userID, bookID int
+			if rows.Scan(&userID, &bookID) == nil {
+				addSignal(userID, bookID, sq.weight)
+			}
+		}
+		rows.Close()
+	}
+
+	m.coBorrow = buildCoBorrow(m.userItems)
+
+	content, err := buildContentSimilarity()
+	if err != nil {
+		return nil, err
+	}
+	m.content = content
+
+	// 3. Popularitas: peminjaman 90 hari terakhir dihitung penuh, sisanya setengah
+	rows, err = db.Query(`
+		SELECT book_id, SUM(CASE WHEN dateRequested >= NOW() - INTERVAL ? DAY THEN 1 ELSE 0.5 END)
+		FROM transactions
+		WHERE status IN ('DIPINJAM', 'DIKEMBALIKAN', 'HILANG')
+		GROUP BY book_id`, recommendPopularDays)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var s scoredBook
+		if rows.Scan(&s.ID, &s.Score) == nil {
+			if _, ok := m.books[s.ID]; ok {
+				m.popular = append(m.popular, s)
+			}
+		}
+	}
+	rows.Close()
+	sortScored(m.popular)
+
+	return m, nil
+}
+
+// Cosine similarity antar buku berdasarkan vektor interaksi user
+func buildCoBorrow(userItems map[int]map[int]float64) map[int][]scoredBook {
+	dot := make(map[int]map[int]float64)
+	norm := make(map[int]float64)
+
+	for _, items := range userItems {
+		list := make([]scoredBook, 0, len(items))
+		for id, w := range items {
+			list = append(list, scoredBook{ID: id, Score: w})
+			norm[id] += w * w
+		}
+		// User dengan riwayat sangat panjang: ambil sinyal terkuat saja
+		if len(list) > recommendMaxUserItems {
+			sortScored(list)
+			list = list[:recommendMaxUserItems]
+		}
+		for i := range list {
+			for j := range list {
+				if i == j {
+					continue
+				}
+				a, b := list[i], list[j]
+				if dot[a.ID] == nil {
+					dot[a.ID] = make(map[int]float64)
+				}
+				dot[a.ID][b.ID] += a.Score * b.Score
+			}
+		}
+	}
+
+	out := make(map[int][]scoredBook, len(dot))
+	for a, neighbors := range dot {
+		list := make([]scoredBook, 0, len(neighbors))
+		for b, d := range neighbors {
+			list = append(list, scoredBook{ID: b, Score: d / math.Sqrt(norm[a]*norm[b])})
+		}
+		out[a] = topScored(list, recommendNeighbors)
+	}
+	return out
+}
+
+// Kemiripan konten: genre (Jaccard) 50%, penulis sama 30%, kategori sama 20%.
+// Hanya pasangan yang berbagi minimal satu fitur yang dihitung (lewat inverted list).
+func buildContentSimilarity() (map[int][]scoredBook, error) {
+	genres := make(map[int]map[int]bool)
+	authors := make(map[int]map[int]bool)
+	category := make(map[int]string)
+	byFeature := make(map[string][]int)
+
+	load := func(query, prefix string, target map[int]map[int]bool) error {
+		rows, err := db.Query(query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var bookID, termID int
+			if rows.Scan(&bookID, &termID) != nil {
+				continue
+			}
+			if target[bookID] == nil {
+				target[bookID] = make(map[int]bool)
+			}
+			target[bookID][termID] = true
+			key := prefix + strconv.Itoa(termID)
+			byFeature[key] = append(byFeature[key], bookID)
+		}
+		return rows.Err()
+	}
+	if err := load("SELECT book_id, genre_id FROM book_genres", "g", genres); err != nil {
+		return nil, err
+	}
+	if err := load("SELECT book_id, author_id FROM book_authors", "a", authors); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT id, category FROM books WHERE category IS NOT NULL AND category <> ''")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var c string
+		if rows.Scan(&id, &c) == nil {
+			category[id] = c
+			byFeature["c"+c] = append(byFeature["c"+c], id)
+		}
+	}
+	rows.Close()
+
+	candidates := make(map[int]map[int]bool)
+	for _, ids := range byFeature {
+		// Fitur yang terlalu umum (mis. kategori besar) tidak cukup untuk jadi kandidat sendiri
+		if len(ids) > 2000 {
+			continue
+		}
+		for _, a := range ids {
+			if candidates[a] == nil {
+				candidates[a] = make(map[int]bool)
+			}
+			for _, b := range ids {
+				if a != b {
+					candidates[a][b] = true
+				}
+			}
+		}
+	}
+
+	out := make(map[int][]scoredBook, len(candidates))
+	for a, others := range candidates {
+		list := make([]scoredBook, 0, len(others))
+		for b := range others {
+			score := 0.5*jaccard(genres[a], genres[b]) + 0.3*jaccard(authors[a], authors[b])
+			if category[a] != "" && category[a] == category[b] {
+				score += 0.2
+			}
+			if score > 0 {
+				list = append(list, scoredBook{ID: b, Score: score})
+			}
+		}
+		out[a] = topScored(list, recommendNeighbors)
+	}
+	return out, nil
+}
+
+func jaccard(a, b map[int]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	inter := 0
+	for k := range a {
+		if b[k] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+func sortScored(list []scoredBook) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].ID < list[j].ID
+	})
+}
+
+func topScored(list []scoredBook, n int) []scoredBook {
+	sortScored(list)
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+// Feed beranda untuk satu user. Skor CF dan konten dinormalisasi lalu digabung;
+// user tanpa riwayat (atau belum login) mendapat buku populer & terbaru.
+func (m *recommendModel) homeFeed(userID, limit int) []recommendBook {
+	history := m.userItems[userID]
+
+	cf := make(map[int]float64)
+	content := make(map[int]float64)
+	for bookID, w := range history {
+		for _, n := range m.coBorrow[bookID] {
+			if _, seen := history[n.ID]; !seen {
+				cf[n.ID] += w * n.Score
+			}
+		}
+		for _, n := range m.content[bookID] {
+			if _, seen := history[n.ID]; !seen {
+				content[n.ID] += w * n.Score
+			}
+		}
+	}
+	normalizeScores(cf)
+	normalizeScores(content)
+
+	scores := make(map[int]float64)
+	reasons := make(map[int]string)
+	for id, s := range cf {
+		scores[id] += 0.6 * s
+		reasons[id] = "Dipinjam juga oleh pembaca dengan selera serupa"
+	}
+	for id, s := range content {
+		scores[id] += 0.4 * s
+		if _, ok := reasons[id]; !ok {
+			reasons[id] = "Mirip dengan buku yang pernah kamu baca"
+		}
+	}
+
+	var list []scoredBook
+	for id, s := range scores {
+		list = append(list, scoredBook{ID: id, Score: s})
+	}
+	list = topScored(list, limit)
+
+	// Cold start / hasil kurang: isi dengan buku populer lalu buku terbaru
+	picked := make(map[int]bool)
+	for _, s := range list {
+		picked[s.ID] = true
+	}
+	fill := func(id int, reason string) {
+		if len(list) >= limit || picked[id] {
+			return
+		}
+		if _, seen := history[id]; seen {
+			return
+		}
+		picked[id] = true
+		reasons[id] = reason
+		list = append(list, scoredBook{ID: id})
+	}
+	for _, p := range m.popular {
+		fill(p.ID, "Populer di perpustakaan")
+	}
+	for _, id := range m.newest {
+		fill(id, "Koleksi terbaru")
+	}
+
+	return m.cards(list, reasons)
+}
+
+// Rekomendasi untuk halaman detail buku
+func (m *recommendModel) similarTo(bookID, limit int) (alsoBorrowed, similar []recommendBook) {
+	cf := m.coBorrow[bookID]
+	if len(cf) > limit {
+		cf = cf[:limit]
+	}
+	ct := m.content[bookID]
+	if len(ct) > limit {
+		ct = ct[:limit]
+	}
+	return m.cards(cf, nil), m.cards(ct, nil)
+}
+
+func (m *recommendModel) cards(list []scoredBook, reasons map[int]string) []recommendBook {
+	out := make([]recommendBook, 0, len(list))
+	for _, s := range list {
+		b, ok := m.books[s.ID]
+		if !ok {
+			continue
+		}
+		b.Score = math.Round(s.Score*1000) / 1000
+		b.Reason = reasons[s.ID]
+		out = append(out, b)
+	}
+	return out
+}
+
+func normalizeScores(scores map[int]float64) {
+	max := 0.0
+	for _, s := range scores {
+		if s > max {
+			max = s
+		}
+	}
+	if max == 0 {
+		return
+	}
+	for id := range scores {
+		scores[id] /= max
+	}
+}
+
+func recommendLimit(r *http.Request, def int) int {
+	limit := def
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	if limit > recommendMaxLimit {
+		limit = recommendMaxLimit
+	}
+	return limit
+}
+
+// GET /api/recommendations/home?limit=10 (memakai session jika login)
+func homeRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	m := currentRecommendModel()
+	if m == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Model rekomendasi sedang disiapkan"})
+		return
+	}
+
+	user := getCurrentUser(r)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"books":   m.homeFeed(user.ID, recommendLimit(r, recommendDefaultLimit)),
+		"builtAt": m.builtAt,
+	})
+}
+
+// GET /api/recommendations/similar?bookId=1&limit=10
+func similarBooksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	bookID, err := strconv.Atoi(r.URL.Query().Get("bookId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "bookId tidak valid"})
+		return
+	}
+
+	m := currentRecommendModel()
+	if m == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Model rekomendasi sedang disiapkan"})
+		return
+	}
+
+	alsoBorrowed, similar := m.similarTo(bookID, recommendLimit(r, recommendDefaultLimit))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alsoBorrowed": alsoBorrowed,
+		"similar":      similar,
+	})
+}
+
+// POST /api/admin/recommendations/rebuild -> bangun ulang model sekarang juga
+func rebuildRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := getCurrentUser(r)
+	if user.Role != "admin" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Method not allowed"})
+		return
+	}
+
+	go rebuildRecommendModel()
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Model rekomendasi sedang dibangun ulang"})
+}
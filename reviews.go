@@ -0,0 +1,393 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ==========================================
+// ULASAN & RATING BUKU
+// Hanya member yang sudah mengembalikan buku (transaksi DIKEMBALIKAN)
+// atau sudah membaca ebook cukup jauh yang boleh memberi ulasan.
+// Rata-rata & jumlah rating disimpan di books.rating_avg / rating_count
+// supaya bisa ditampilkan & dipakai sort di /books tanpa JOIN tambahan.
+// ==========================================
+
+const (
+	reviewMinEbookPct = 10   // ebook dianggap "sudah dibaca" mulai persen progres ini
+	reviewMaxLength   = 2000 // karakter
+	reviewPageSize    = 20
+
+	reviewVisible = "tampil"
+	reviewHidden  = "disembunyikan"
+)
+
+type BookReview struct {
+	ID             int       `json:"id"`
+	BookID         int       `json:"bookId"`
+	BookTitle      string    `json:"bookTitle,omitempty"`
+	UserID         int       `json:"userId"`
+	Fullname       string    `json:"fullname"`
+	ProfilePicture string    `json:"profilePicture"`
+	Rating         int       `json:"rating"`
+	Review         string    `json:"review"`
+	Status         string    `json:"status"`
+	ModerationNote string    `json:"moderationNote,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+const bookReviewSelect = `
+	SELECT r.id, r.bookId, b.title, r.userId, u.fullname, u.profile_picture, r.rating, r.review,
+	       r.status, r.moderationNote, r.createdAt, r.updatedAt
+	FROM book_reviews r
+	JOIN users u ON u.id = r.userId
+	JOIN books b ON b.id = r.bookId`
+
+func scanBookReview(rows *sql.Rows) (BookReview, error) {
+	var rv BookReview
+	var fullname, picture, review, note sql.NullString
+	err := rows.Scan(&rv.ID, &rv.BookID, &rv.BookTitle, &rv.UserID, &fullname, &picture, &rv.Rating, &review,
+		&rv.Status, &note, &rv.CreatedAt, &rv.UpdatedAt)
+	rv.Fullname = fullname.String
+	rv.Review = review.String
+	rv.ModerationNote = note.String
+
+	// Path foto profil sama seperti di feedback
+	rv.ProfilePicture = picture.String
+	if rv.ProfilePicture == "" {
+		rv.ProfilePicture = "/img/default_user.png"
+	} else if !strings.HasPrefix(rv.ProfilePicture, "data:") && !strings.HasPrefix(rv.ProfilePicture, "uploads/") {
+		rv.ProfilePicture = "uploads/" + rv.ProfilePicture
+	}
+	return rv, err
+}
+
+// Member boleh mengulas jika pernah mengembalikan buku ini atau membaca ebook-nya.
+// Progres ebook diambil dari reading_sessions yang hanya dicatat untuk pembaca yang
+// berhak (lihat recordReadingEvent), bukan dari ebook_history yang ditulis klien.
+func canReviewBook(userID, bookID int) bool {
+	var ok bool
+	db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM transactions WHERE user_id = ? AND book_id = ? AND status = 'DIKEMBALIKAN')
+		    OR EXISTS(SELECT 1 FROM reading_sessions s JOIN books b ON b.id = s.bookId
+		              WHERE s.userId = ? AND s.bookId = ? AND s.maxProgress >= ?
+		                AND b.ebookFile IS NOT NULL AND b.ebookFile <> '')`,
+		userID, bookID, userID, bookID, reviewMinEbookPct).Scan(&ok)
+	return ok
+}
+
+// Hitung ulang agregat rating satu buku (hanya ulasan yang tampil)
+func refreshBookRating(bookID int) error {
+	_, err := db.Exec(`
+		UPDATE books SET
+			rating_avg = (SELECT COALESCE(AVG(rating), 0) FROM book_reviews WHERE bookId = ? AND status = ?),
+			rating_count = (SELECT COUNT(*) FROM book_reviews WHERE bookId = ? AND status = ?)
+		WHERE id = ?`, bookID, reviewVisible, bookID, reviewVisible, bookID)
+	return err
+}
+
+// /api/reviews
+//
+//	GET    ?bookId=1&page=1  -> ulasan yang tampil + ringkasan rating (publik)
+//	POST   {"bookId":1,"rating":5,"review":"..."} -> buat / ubah ulasan sendiri
+//	DELETE ?id=3             -> hapus ulasan sendiri (admin: ulasan siapa saja)
+func reviewsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user := getCurrentUser(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		listBookReviews(w, r, user)
+	case http.MethodPost:
+		saveBookReview(w, r, user)
+	case http.MethodDelete:
+		deleteBookReview(w, r, user)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Method not allowed"})
+	}
+}
+
+func listBookReviews(w http.ResponseWriter, r *http.Request, user User) {
+	bookID, err := strconv.Atoi(r.URL.Query().Get("bookId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "bookId tidak valid"})
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	var avg float64
+	var count int
+	err = db.QueryRow("SELECT COALESCE(rating_avg, 0), COALESCE(rating_count, 0) FROM books WHERE id = ?", bookID).Scan(&avg, &count)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Buku tidak ditemukan"})
+		return
+	}
+
+	// Sebaran bintang 1-5
+	distribution := map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}
+	dist, err := db.Query("SELECT rating, COUNT(*) FROM book_reviews WHERE bookId = ? AND status = ? GROUP BY rating", bookID, reviewVisible)
+	if err == nil {
+		for dist.Next() {
+			var star, n int
+			if dist.Scan(&star, &n) == nil {
+				distribution[star] = n
+			}
+		}
+		dist.Close()
+	}
+
+	rows, err := db.Query(bookReviewSelect+` WHERE r.bookId = ? AND r.status = ?
+		ORDER BY r.updatedAt DESC, r.id DESC LIMIT ? OFFSET ?`,
+		bookID, reviewVisible, reviewPageSize, (page-1)*reviewPageSize)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	reviews := []BookReview{}
+	for rows.Next() {
+		rv, err := scanBookReview(rows)
+		if err != nil {
+			continue
+		}
+		rv.ModerationNote = ""
+		reviews = append(reviews, rv)
+	}
+
+	result := map[string]interface{}{
+		"bookId":       bookID,
+		"ratingAvg":    avg,
+		"ratingCount":  count,
+		"distribution": distribution,
+		"reviews":      reviews,
+		"page":         page,
+	}
+
+	// Info untuk member yang login: boleh mengulas? ulasan miliknya (termasuk yang disembunyikan)
+	if user.ID != 0 {
+		result["canReview"] = canReviewBook(user.ID, bookID)
+		mine, err := db.Query(bookReviewSelect+" WHERE r.bookId = ? AND r.userId = ?", bookID, user.ID)
+		if err == nil {
+			if mine.Next() {
+				if rv, err := scanBookReview(mine); err == nil {
+					result["myReview"] = rv
+				}
+			}
+			mine.Close()
+		}
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+func saveBookReview(w http.ResponseWriter, r *http.Request, user User) {
+	if user.ID == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "User belum login"})
+		return
+	}
+
+	var input struct {
+		BookID int    `json:"bookId"`
+		Rating int    `json:"rating"`
+		Review string `json:"review"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Body JSON tidak valid"})
+		return
+	}
+
+	input.Review = strings.TrimSpace(input.Review)
+	switch {
+	case input.Rating < 1 || input.Rating > 5:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Rating harus 1 sampai 5"})
+		return
+	case utf8.RuneCountInString(input.Review) > reviewMaxLength:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Ulasan maksimal " + strconv.Itoa(reviewMaxLength) + " karakter"})
+		return
+	}
+
+	if !canReviewBook(user.ID, input.BookID) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Ulasan hanya bisa diberikan setelah meminjam & mengembalikan buku atau membaca ebook-nya"})
+		return
+	}
+
+	// Satu ulasan per member per buku; kirim ulang = ubah ulasan.
+	// Status moderasi tidak berubah agar ulasan yang disembunyikan tidak muncul lagi diam-diam.
+	_, err := db.Exec(`
+		INSERT INTO book_reviews (bookId, userId, rating, review)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE rating = VALUES(rating), review = VALUES(review), updatedAt = NOW()`,
+		input.BookID, user.ID, input.Rating, input.Review)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	refreshBookRating(input.BookID)
+
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Ulasan berhasil disimpan"})
+}
+
+func deleteBookReview(w http.ResponseWriter, r *http.Request, user User) {
+	if user.ID == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "User belum login"})
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "ID tidak valid"})
+		return
+	}
+
+	var bookID, ownerID int
+	var status string
+	err = db.QueryRow("SELECT bookId, userId, status FROM book_reviews WHERE id = ?", id).Scan(&bookID, &ownerID, &status)
+	if err != nil || (ownerID != user.ID && user.Role != "admin") {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Ulasan tidak ditemukan"})
+		return
+	}
+	// Ulasan yang disembunyikan tetap disimpan: jika dihapus, member bisa kirim ulang
+	// dan ulasan baru langsung tampil tanpa melewati moderasi
+	if status == reviewHidden && user.Role != "admin" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Ulasan yang disembunyikan moderator tidak bisa dihapus"})
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM book_reviews WHERE id = ?", id); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	refreshBookRating(bookID)
+
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Ulasan berhasil dihapus"})
+}
+
+// GET /api/admin/reviews?status=tampil|disembunyikan&bookId=&page=
+func adminReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := getCurrentUser(r)
+	if user.Role != "admin" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Unauthorized"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Method not allowed"})
+		return
+	}
+
+	q := r.URL.Query()
+	var conditions []string
+	var args []interface{}
+	if s := q.Get("status"); s != "" {
+		conditions = append(conditions, "r.status = ?")
+		args = append(args, s)
+	}
+	if id, err := strconv.Atoi(q.Get("bookId")); err == nil {
+		conditions = append(conditions, "r.bookId = ?")
+		args = append(args, id)
+	}
+	query := bookReviewSelect
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	query += " ORDER BY r.updatedAt DESC, r.id DESC LIMIT ? OFFSET ?"
+	args = append(args, reviewPageSize, (page-1)*reviewPageSize)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	reviews := []BookReview{}
+	for rows.Next() {
+		if rv, err := scanBookReview(rows); err == nil {
+			reviews = append(reviews, rv)
+		}
+	}
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// POST /api/admin/reviews/moderate {"id":3,"status":"disembunyikan","note":"spoiler"}
+func moderateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user := getCurrentUser(r)
+	if user.Role != "admin" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Method not allowed"})
+		return
+	}
+
+	var input struct {
+		ID     int    `json:"id"`
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Body JSON tidak valid"})
+		return
+	}
+	if input.Status != reviewVisible && input.Status != reviewHidden {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Status harus 'tampil' atau 'disembunyikan'"})
+		return
+	}
+
+	var bookID int
+	if err := db.QueryRow("SELECT bookId FROM book_reviews WHERE id = ?", input.ID).Scan(&bookID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Ulasan tidak ditemukan"})
+		return
+	}
+
+	_, err := db.Exec("UPDATE book_reviews SET status = ?, moderationNote = ?, moderatedBy = ? WHERE id = ?",
+		input.Status, strings.TrimSpace(input.Note), user.ID, input.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+		return
+	}
+	refreshBookRating(bookID)
+
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Status ulasan diperbarui"})
+}
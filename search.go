@@ -0,0 +1,514 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ==========================================
+// FULL-TEXT SEARCH BUKU (INVERTED INDEX + BM25)
+// Index disimpan di memori, dibangun saat startup lalu diperbarui
+// setiap kali buku ditambah / diubah / dihapus.
+// ==========================================
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// Batas jumlah hasil search yang dikirim ke query SQL (IN (...))
+	searchMaxHits = 1000
+)
+
+// Bobot tiap field: kecocokan di judul lebih penting dari deskripsi
+var searchFieldWeights = map[string]float64{
+	"title":       3,
+	"author":      2,
+	"genre":       1.5,
+	"publisher":   1,
+	"description": 1,
+}
+
+// Stopword bahasa Indonesia (plus beberapa bahasa Inggris untuk judul campuran)
+var searchStopwords = map[string]bool{
+	"yang": true, "dan": true, "di": true, "ke": true, "dari": true, "untuk": true, "dengan": true,
+	"pada": true, "dalam": true, "ini": true, "itu": true, "atau": true, "adalah": true, "sebagai": true,
+	"oleh": true, "akan": true, "juga": true, "tidak": true, "ada": true, "karena": true, "para": true,
+	"bagi": true, "tentang": true, "serta": true, "agar": true, "bisa": true, "dapat": true, "telah": true,
+	"sudah": true, "saja": true, "lebih": true, "secara": true, "kepada": true, "hingga": true, "sang": true,
+	"si": true, "pun": true, "lalu": true, "namun": true, "tetapi": true, "jika": true, "kami": true,
+	"kita": true, "mereka": true, "ia": true, "dia": true, "aku": true, "saya": true, "anda": true,
+	"the": true, "of": true, "a": true, "an": true, "and": true, "to": true, "in": true, "for": true, "on": true,
+}
+
+// Dokumen yang sudah diindex (dipakai saat update / hapus)
+type searchDoc struct {
+	fields searchFields
+	terms  map[string]float64 // term -> tf berbobot
+	length float64
+}
+
+type searchIndex struct {
+	mu       sync.RWMutex
+	ready    bool
+	docs     map[int]*searchDoc
+	postings map[string]map[int]float64 // term -> bookID -> tf berbobot
+	totalLen float64
+	version  int // naik setiap ada perubahan, dipakai cache kamus suggest
+
+	// Selama rebuildBookIndex berjalan, buku yang berubah dicatat lalu
+	// diindex ulang setelah index baru dipasang (perubahan tidak hilang)
+	rebuilding bool
+	touched    map[int]bool
+
+	suggestMu       sync.Mutex
+	suggestCache    *suggestDict
+	suggestBuilding bool // rebuild kamus sedang berjalan di background
+}
+
+// Hasil pencarian, urut skor tertinggi
+type searchHit struct {
+	ID    int
+	Score float64
+}
+
+var bookIndex = newSearchIndex()
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		docs:     make(map[int]*searchDoc),
+		postings: make(map[string]map[int]float64),
+	}
+}
+
+// Field buku yang diindex
+type searchFields struct {
+	Title, Author, Genre, Publisher, Description string
+}
+
+func (f searchFields) values() map[string]string {
+	return map[string]string{
+		"title":       f.Title,
+		"author":      f.Author,
+		"genre":       f.Genre,
+		"publisher":   f.Publisher,
+		"description": f.Description,
+	}
+}
+
+// Tambah / ganti dokumen di index
+func (ix *searchIndex) put(id int, f searchFields) {
+	doc := &searchDoc{fields: f, terms: make(map[string]float64)}
+	for field, text := range f.values() {
+		weight := searchFieldWeights[field]
+		for _, term := range analyzeText(text) {
+			doc.terms[term] += weight
+			doc.length += weight
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.touchLocked(id)
+	ix.removeLocked(id)
+	ix.docs[id] = doc
+	ix.totalLen += doc.length
+	ix.version++
+	for term, tf := range doc.terms {
+		p := ix.postings[term]
+		if p == nil {
+			p = make(map[int]float64)
+			ix.postings[term] = p
+		}
+		p[id] = tf
+	}
+}
+
+func (ix *searchIndex) remove(id int) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.touchLocked(id)
+	ix.removeLocked(id)
+}
+
+func (ix *searchIndex) touchLocked(id int) {
+	if ix.rebuilding {
+		ix.touched[id] = true
+	}
+}
+
+func (ix *searchIndex) removeLocked(id int) {
+	doc, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		if p := ix.postings[term]; p != nil {
+			delete(p, id)
+			if len(p) == 0 {
+				delete(ix.postings, term)
+			}
+		}
+	}
+	ix.totalLen -= doc.length
+	delete(ix.docs, id)
+	ix.version++
+}
+
+// Cari buku dengan ranking BM25. Term yang tidak ada persis di index
+// dicocokkan ke term terdekat (edit distance) dengan skor yang dikurangi.
+func (ix *searchIndex) search(query string) []searchHit {
+	terms := analyzeText(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	n := float64(len(ix.docs))
+	if n == 0 {
+		return nil
+	}
+	avgLen := ix.totalLen / n
+
+	scores := make(map[int]float64)
+	for _, qt := range terms {
+		for term, factor := range ix.expandTermLocked(qt) {
+			p := ix.postings[term]
+			idf := math.Log(1 + (n-float64(len(p))+0.5)/(float64(len(p))+0.5))
+			for id, tf := range p {
+				dl := ix.docs[id].length
+				scores[id] += factor * idf * (tf * (bm25K1 + 1)) / (tf + bm25K1*(1-bm25B+bm25B*dl/avgLen))
+			}
+		}
+	}
+
+	hits := make([]searchHit, 0, len(scores))
+	for id, s := range scores {
+		hits = append(hits, searchHit{ID: id, Score: s})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits
+}
+
+// Term query -> term di index beserta faktor skornya.
+// Cocok persis = 1, typo 1 huruf = 0.5, typo 2 huruf = 0.33.
+func (ix *searchIndex) expandTermLocked(qt string) map[string]float64 {
+	out := make(map[string]float64)
+	if _, ok := ix.postings[qt]; ok {
+		out[qt] = 1
+	}
+
+	maxDist := fuzzyMaxDistance(qt)
+	if maxDist == 0 {
+		return out
+	}
+	for term := range ix.postings {
+		if term == qt || absInt(len([]rune(term))-len([]rune(qt))) > maxDist {
+			continue
+		}
+		if d := editDistance(qt, term, maxDist); d <= maxDist {
+			out[term] = 1 / float64(d+1)
+		}
+	}
+	return out
+}
+
+// Kata pendek tidak di-fuzzy supaya "buku" tidak cocok ke "baku", "suku", dst.
+func fuzzyMaxDistance(term string) int {
+	switch l := len([]rune(term)); {
+	case l < 4:
+		return 0
+	case l < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Levenshtein distance, berhenti lebih awal jika sudah melewati max
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Pecah teks jadi token, buang stopword, lalu stem
+func analyzeText(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var terms []string
+	for _, w := range words {
+		if searchStopwords[w] {
+			continue
+		}
+		if t := stemIndonesian(w); t != "" {
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// Stemmer bahasa Indonesia sederhana (berbasis aturan Nazief-Adriani, tanpa kamus).
+// Karena query dan dokumen di-stem dengan aturan yang sama, hasilnya konsisten
+// walaupun kata dasar yang dihasilkan tidak selalu sempurna.
+func stemIndonesian(word string) string {
+	if len([]rune(word)) <= 3 {
+		return word
+	}
+	w := word
+
+	// 1. Partikel: -lah, -kah, -tah, -pun
+	for _, suf := range []string{"lah", "kah", "tah", "pun"} {
+		if strings.HasSuffix(w, suf) && len(w)-len(suf) >= 4 {
+			w = strings.TrimSuffix(w, suf)
+			break
+		}
+	}
+	// 2. Kata ganti milik: -ku, -mu, -nya
+	for _, suf := range []string{"nya", "ku", "mu"} {
+		if strings.HasSuffix(w, suf) && len(w)-len(suf) >= 4 {
+			w = strings.TrimSuffix(w, suf)
+			break
+		}
+	}
+	// 3. Akhiran turunan: -kan, -an, -i
+	for _, suf := range []string{"kan", "an", "i"} {
+		if strings.HasSuffix(w, suf) && len(w)-len(suf) >= 4 {
+			w = strings.TrimSuffix(w, suf)
+			break
+		}
+	}
+
+	// 4. Awalan, maksimal dua kali (contoh: mem-per-, di-per-)
+	for i := 0; i < 2; i++ {
+		next := stripIndonesianPrefix(w)
+		if next == w || len([]rune(next)) < 3 {
+			break
+		}
+		w = next
+	}
+	return w
+}
+
+func isVowel(b byte) bool {
+	return strings.IndexByte("aiueo", b) >= 0
+}
+
+// Hapus satu awalan beserta peluluhan bunyi (meny- -> s, mem- -> p, men- -> t)
+func stripIndonesianPrefix(w string) string {
+	switch {
+	case strings.HasPrefix(w, "di"), strings.HasPrefix(w, "ke"), strings.HasPrefix(w, "se"):
+		return w[2:]
+	case strings.HasPrefix(w, "ter"):
+		return w[3:]
+	case strings.HasPrefix(w, "ber"):
+		return w[3:]
+	case strings.HasPrefix(w, "bel") && strings.HasPrefix(w[3:], "ajar"):
+		return w[3:]
+	case strings.HasPrefix(w, "per"):
+		return w[3:]
+	}
+
+	for _, pre := range []string{"me", "pe"} {
+		if !strings.HasPrefix(w, pre) {
+			continue
+		}
+		rest := w[2:]
+		switch {
+		case strings.HasPrefix(rest, "ny") && len(rest) > 2 && isVowel(rest[2]):
+			return "s" + rest[2:]
+		case strings.HasPrefix(rest, "ng"):
+			// mengajar -> ajar, menggambar -> gambar
+			return rest[2:]
+		case strings.HasPrefix(rest, "m") && len(rest) > 1 && (isVowel(rest[1]) || rest[1] == 'r'):
+			// memukul -> pukul, pemrograman -> program
+			return "p" + rest[1:]
+		case strings.HasPrefix(rest, "m"):
+			return rest[1:]
+		case strings.HasPrefix(rest, "n") && len(rest) > 1 && isVowel(rest[1]):
+			// menulis -> tulis
+			return "t" + rest[1:]
+		case strings.HasPrefix(rest, "n"):
+			return rest[1:]
+		case strings.HasPrefix(rest, "r") && len(rest) > 1 && isVowel(rest[1]):
+			// merawat -> rawat
+			return rest
+		case strings.HasPrefix(rest, "l"), strings.HasPrefix(rest, "w"), strings.HasPrefix(rest, "y"):
+			return rest
+		}
+	}
+	return w
+}
+
+// ==========================================
+// SINKRONISASI INDEX DENGAN DATABASE
+// ==========================================
+
+// Bangun ulang seluruh index dari tabel books (dipanggil saat startup)
+func rebuildBookIndex() {
+	bookIndex.mu.Lock()
+	bookIndex.rebuilding = true
+	bookIndex.touched = make(map[int]bool)
+	bookIndex.mu.Unlock()
+
+	rows, err := db.Query("SELECT id, title, author, genre, publisher, description FROM books")
+	if err != nil {
+		bookIndex.mu.Lock()
+		bookIndex.rebuilding = false
+		bookIndex.touched = nil
+		bookIndex.mu.Unlock()
+		log.Println("Gagal membangun index search:", err)
+		return
+	}
+	defer rows.Close()
+
+	fresh := newSearchIndex()
+	count := 0
+	for rows.Next() {
+		id, f, err := scanSearchFields(rows)
+		if err != nil {
+			continue
+		}
+		fresh.put(id, f)
+		count++
+	}
+
+	bookIndex.mu.Lock()
+	bookIndex.docs = fresh.docs
+	bookIndex.postings = fresh.postings
+	bookIndex.totalLen = fresh.totalLen
+	bookIndex.version++
+	bookIndex.ready = true
+	touched := bookIndex.touched
+	bookIndex.rebuilding = false
+	bookIndex.touched = nil
+	bookIndex.mu.Unlock()
+
+	// Buku yang ditambah / diubah / dihapus selama query berjalan bisa belum
+	// (atau masih) ada di snapshot, ambil ulang dari database
+	for id := range touched {
+		reindexBook(id)
+	}
+	log.Printf("Index search siap: %d buku", count)
+}
+
+// Index ulang satu buku setelah insert / update
+func reindexBook(id int) {
+	rows, err := db.Query("SELECT id, title, author, genre, publisher, description FROM books WHERE id = ?", id)
+	if err != nil {
+		log.Println("Gagal index ulang buku:", err)
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		bookIndex.remove(id)
+		return
+	}
+	if _, f, err := scanSearchFields(rows); err == nil {
+		bookIndex.put(id, f)
+	}
+}
+
+func scanSearchFields(rows *sql.Rows) (int, searchFields, error) {
+	var id int
+	var title, author, genre, publisher, description sql.NullString
+	err := rows.Scan(&id, &title, &author, &genre, &publisher, &description)
+	return id, searchFields{
+		Title:       title.String,
+		Author:      author.String,
+		Genre:       genre.String,
+		Publisher:   publisher.String,
+		Description: description.String,
+	}, err
+}
+
+func (ix *searchIndex) isReady() bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.ready
+}
+
+// Terapkan ?search= ke query list buku. Jika index siap, hasil dibatasi ke buku
+// yang cocok dan (tanpa sort eksplisit) diurutkan berdasarkan relevansi.
+// Jika index belum siap, kembali ke LIKE judul/penulis seperti sebelumnya.
+func applyBookSearch(search string, lq *bookListQuery, conditions []string, args []interface{}) ([]string, []interface{}) {
+	// Query yang isinya stopword semua ("Dia", "The") tidak punya term untuk indeks,
+	// jadi dicari apa adanya seperti saat indeks belum siap
+	if !bookIndex.isReady() || len(analyzeText(search)) == 0 {
+		like := "%" + search + "%"
+		conditions = append(conditions, "(LOWER(b.title) LIKE LOWER(?) OR LOWER(b.author) LIKE LOWER(?))")
+		return conditions, append(args, like, like)
+	}
+
+	hits := bookIndex.search(search)
+	if len(hits) == 0 {
+		return append(conditions, "1 = 0"), args
+	}
+	if len(hits) > searchMaxHits {
+		hits = hits[:searchMaxHits]
+	}
+
+	ids := make([]int, len(hits))
+	placeholders := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+		placeholders[i] = "?"
+		args = append(args, h.ID)
+	}
+	conditions = append(conditions, "b.id IN ("+strings.Join(placeholders, ",")+")")
+
+	lq.RankedIDs = ids
+	if lq.Sort == "" {
+		lq.Sort = "relevance"
+	}
+	return conditions, args
+}
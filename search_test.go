@@ -0,0 +1,79 @@
+package main
+
+import "testing"
+
+func TestStemIndonesian(t *testing.T) {
+	tests := []struct {
+		word, want string
+	}{
+		{"buku", "buku"},
+		{"ada", "ada"},
+		{"membaca", "baca"},
+		{"dibaca", "baca"},
+		{"pembacaan", "baca"},
+		{"bacakan", "baca"},
+		{"menulis", "tulis"},
+		{"penulis", "tulis"},
+		{"mengambil", "ambil"},
+		{"terbaik", "baik"},
+		{"belajar", "ajar"},
+		{"perjalanan", "jalan"},
+		{"kebudayaan", "budaya"},
+		{"bukunya", "buku"},
+		{"rumahku", "rumah"},
+		{"mempelajari", "lajar"},
+		{"pelajaran", "lajar"},
+	}
+	for _, tt := range tests {
+		if got := stemIndonesian(tt.word); got != tt.want {
+			t.Errorf("stemIndonesian(%q) = %q, ingin %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeText(t *testing.T) {
+	got := analyzeText("Buku-buku yang Dibaca oleh Anak")
+	want := []string{"buku", "buku", "baca", "anak"}
+	if len(got) != len(want) {
+		t.Fatalf("analyzeText = %v, ingin %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("analyzeText = %v, ingin %v", got, want)
+			break
+		}
+	}
+}
+
+func TestSearchIndexTouchedDuringRebuild(t *testing.T) {
+	ix := newSearchIndex()
+	ix.put(1, searchFields{Title: "Laskar Pelangi"})
+	if ix.touched != nil {
+		t.Fatal("perubahan di luar rebuild tidak perlu dicatat")
+	}
+
+	ix.rebuilding = true
+	ix.touched = make(map[int]bool)
+	ix.put(2, searchFields{Title: "Bumi"})
+	ix.remove(1)
+	if !ix.touched[1] || !ix.touched[2] || len(ix.touched) != 2 {
+		t.Errorf("touched = %v, ingin buku 1 dan 2", ix.touched)
+	}
+}
+
+func TestApplyBookSearchStopwordOnly(t *testing.T) {
+	saved := bookIndex
+	t.Cleanup(func() { bookIndex = saved })
+	bookIndex = newSearchIndex()
+	bookIndex.put(1, searchFields{Title: "Dia"})
+	bookIndex.ready = true
+
+	var lq bookListQuery
+	conds, args := applyBookSearch("Dia", &lq, nil, nil)
+	if len(conds) != 1 || conds[0] == "1 = 0" || len(args) != 2 || args[0] != "%Dia%" {
+		t.Errorf("kondisi = %v %v, ingin pencarian LIKE", conds, args)
+	}
+	if lq.RankedIDs != nil {
+		t.Errorf("RankedIDs = %v, ingin kosong", lq.RankedIDs)
+	}
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// RAK BACA (SHELVES)
+// Tiap member punya satu rak default ("Bookmark") yang menggantikan tabel
+// bookmarks lama; endpoint /bookmark, /bookmark/status dan /api/bookmarks
+// tetap bekerja di atas rak default ini. Member bisa membuat rak lain,
+// mengurutkan isi rak, memberi catatan per buku dan membagikan rak lewat link.
+// ==========================================
+
+const defaultShelfName = "Bookmark"
+
+type Shelf struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	IsDefault   bool      `json:"isDefault"`
+	IsPublic    bool      `json:"isPublic"`
+	ShareToken  string    `json:"shareToken,omitempty"`
+	ItemCount   int       `json:"itemCount"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type ShelfItem struct {
+	BookID    int       `json:"bookId"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author"`
+	CoverFile string    `json:"coverFile"`
+	Type      string    `json:"type"`
+	Position  int       `json:"position"`
+	Note      string    `json:"note"`
+	AddedAt   time.Time `json:"addedAt"`
+}
+
+// Ambil id rak default user, buat jika belum ada
+func defaultShelfID(userID int) (int, error) {
+	var id int
+	err := db.QueryRow("SELECT id FROM shelves WHERE userId = ? AND isDefault = 1", userID).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	res, err := db.Exec("INSERT INTO shelves (userId, name, isDefault) VALUES (?, ?, 1)", userID, defaultShelfName)
+	if err != nil {
+		// Request paralel sudah membuatnya lebih dulu
+		if err2 := db.QueryRow("SELECT id FROM shelves WHERE userId = ? AND isDefault = 1", userID).Scan(&id); err2 == nil {
+			return id, nil
+		}
+		return 0, err
+	}
+	newID, _ := res.LastInsertId()
+	return int(newID), nil
+}
+
+// Tambah buku ke rak di posisi paling akhir. Mengembalikan false jika sudah ada.
+func addShelfItem(shelfID, bookID int, note string) (bool, error) {
+	res, err := db.Exec(`
+		INSERT IGNORE INTO shelf_items (shelfId, bookId, position, note)
+		SELECT ?, ?, COALESCE(MAX(position), 0) + 1, ? FROM shelf_items WHERE shelfId = ?`,
+		shelfID, bookID, note, shelfID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		db.Exec("UPDATE shelves SET updatedAt = NOW() WHERE id = ?", shelfID)
+	}
+	return n > 0, nil
+}
+
+func removeShelfItem(shelfID, bookID int) (bool, error) {
+	res, err := db.Exec("DELETE FROM shelf_items WHERE shelfId = ? AND bookId = ?", shelfID, bookID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		db.Exec("UPDATE shelves SET updatedAt = NOW() WHERE id = ?", shelfID)
+	}
+	return n > 0, nil
+}
+
+// Migrasi: isi tabel bookmarks lama dipindah ke rak default tiap user.
+// Hanya user yang belum punya rak default yang diproses, jadi aman diulang.
+func migrateBookmarksToShelves() {
+	rows, err := db.Query(`
+		SELECT DISTINCT bm.userId FROM bookmarks bm
+		WHERE NOT EXISTS (SELECT 1 FROM shelves s WHERE s.userId = bm.userId AND s.isDefault = 1)`)
+	if err != nil {
+		log.Println("Migrasi bookmark gagal:", err)
+		return
+	}
+	var users []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			users = append(users, id)
+		}
+	}
+	rows.Close()
+
+	for _, userID := range users {
+		shelfID, err := defaultShelfID(userID)
+		if err != nil {
+			log.Printf("Migrasi bookmark user %d gagal: %v", userID, err)
+			continue
+		}
+		// Urutan mengikuti urutan bookmark dibuat (id)
+		_, err = db.Exec(`
+			INSERT IGNORE INTO shelf_items (shelfId, bookId, position)
+			SELECT ?, bm.bookId, bm.id FROM bookmarks bm WHERE bm.userId = ?`,
+			shelfID, userID)
+		if err != nil {
+			log.Printf("Migrasi bookmark user %d gagal: %v", userID, err)
+		}
+	}
+	if len(users) > 0 {
+		log.Printf("Migrasi bookmark: %d user dipindah ke rak default", len(users))
+	}
+}
+
+// Pastikan rak milik user; mengembalikan data rak
+func loadOwnShelf(userID, shelfID int) (Shelf, bool) {
+	var s Shelf
+	var desc, token sql.NullString
+	err := db.QueryRow(`
+		SELECT id, name, description, isDefault, isPublic, shareToken, createdAt, updatedAt
+		FROM shelves WHERE id = ? AND userId = ?`, shelfID, userID).
+		Scan(&s.ID, &s.Name, &desc, &s.IsDefault, &s.IsPublic, &token, &s.CreatedAt, &s.UpdatedAt)
+	s.Description, s.ShareToken = desc.String, token.String
+	return s, err == nil
+}
+
+func listShelfItems(shelfID int) ([]ShelfItem, error) {
+	rows, err := db.Query(`
+		SELECT b.id, b.title, b.author, b.coverFile, b.type, i.position, i.note, i.addedAt
+		FROM shelf_items i JOIN books b ON b.id = i.bookId
+		WHERE i.shelfId = ?
+		ORDER BY i.position, i.id`, shelfID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ShelfItem{}
+	for rows.Next() {
+		var it ShelfItem
+		var author, cover, tipe, note sql.NullString
+		if err := rows.Scan(&it.BookID, &it.Title, &author, &cover, &tipe, &it.Position, &note, &it.AddedAt); err != nil {
+			return nil, err
+		}
+		it.Author, it.CoverFile, it.Type, it.Note = author.String, cover.String, tipe.String, note.String
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func writeShelfError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{Success: false, Message: msg})
+}
+
+// Router /api/shelves
+//
+//	GET    /api/shelves                      daftar rak milik user
+//	POST   /api/shelves                      {"name","description","isPublic"}
+//	PUT    /api/shelves/{id}                 ubah nama / deskripsi / publik
+//	DELETE /api/shelves/{id}                 hapus rak (rak default tidak bisa dihapus)
+//	GET    /api/shelves/{id}/items           isi rak, urut posisi
+//	POST   /api/shelves/{id}/items           {"bookId","note"}
+//	PUT    /api/shelves/{id}/items/{bookId}  {"note"}
+//	DELETE /api/shelves/{id}/items/{bookId}
+//	PUT    /api/shelves/{id}/order           {"bookIds":[3,1,2]}
+//	POST   /api/shelves/{id}/share           buat link publik
+//	DELETE /api/shelves/{id}/share           cabut link publik
+//	GET    /api/shelves/shared/{token}       lihat rak yang dibagikan (tanpa login)
+func shelvesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/shelves"), "/"), "/")
+	if parts[0] == "shared" && len(parts) == 2 && r.Method == http.MethodGet {
+		sharedShelfHandler(w, parts[1])
+		return
+	}
+
+	userID, err := getUserIdFromSession(r)
+	if err != nil {
+		writeShelfError(w, http.StatusUnauthorized, "User belum login")
+		return
+	}
+
+	if parts[0] == "" {
+		switch r.Method {
+		case http.MethodGet:
+			listShelves(w, userID)
+		case http.MethodPost:
+			createShelf(w, r, userID)
+		default:
+			writeShelfError(w, http.StatusMethodNotAllowed, "Method tidak diizinkan")
+		}
+		return
+	}
+
+	shelfID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		writeShelfError(w, http.StatusBadRequest, "ID rak tidak valid")
+		return
+	}
+	shelf, ok := loadOwnShelf(userID, shelfID)
+	if !ok {
+		writeShelfError(w, http.StatusNotFound, "Rak tidak ditemukan")
+		return
+	}
+
+	sub := ""
+	if len(parts) > 1 {
+		sub = parts[1]
+	}
+	switch {
+	case sub == "" && r.Method == http.MethodGet:
+		items, err := listShelfItems(shelf.ID)
+		if err != nil {
+			writeShelfError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		shelf.ItemCount = len(items)
+		json.NewEncoder(w).Encode(map[string]interface{}{"shelf": shelf, "items": items})
+	case sub == "" && r.Method == http.MethodPut:
+		updateShelf(w, r, userID, shelf)
+	case sub == "" && r.Method == http.MethodDelete:
+		deleteShelf(w, shelf)
+	case sub == "items":
+		shelfItemsHandler(w, r, shelf, parts[2:])
+	case sub == "order" && r.Method == http.MethodPut:
+		reorderShelf(w, r, shelf)
+	case sub == "share" && r.Method == http.MethodPost:
+		shareShelf(w, shelf)
+	case sub == "share" && r.Method == http.MethodDelete:
+		db.Exec("UPDATE shelves SET isPublic = 0, shareToken = NULL WHERE id = ?", shelf.ID)
+		json.NewEncoder(w).Encode(Response{Success: true, Message: "Link rak dicabut"})
+	default:
+		writeShelfError(w, http.StatusNotFound, "Endpoint tidak ditemukan")
+	}
+}
+
+func listShelves(w http.ResponseWriter, userID int) {
+	// Rak default selalu ada supaya frontend bisa langsung menampilkannya
+	if _, err := defaultShelfID(userID); err != nil {
+		writeShelfError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT s.id, s.name, s.description, s.isDefault, s.isPublic, s.shareToken, s.createdAt, s.updatedAt,
+		       (SELECT COUNT(*) FROM shelf_items i WHERE i.shelfId = s.id)
+		FROM shelves s WHERE s.userId = ?
+		ORDER BY s.isDefault DESC, s.name`, userID)
+	if err != nil {
+		writeShelfError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	shelves := []Shelf{}
+	for rows.Next() {
+		var s Shelf
+		var desc, token sql.NullString
+		if err := rows.Scan(&s.ID, &s.Name, &desc, &s.IsDefault, &s.IsPublic, &token, &s.CreatedAt, &s.UpdatedAt, &s.ItemCount); err != nil {
+			continue
+		}
+		s.Description, s.ShareToken = desc.String, token.String
+		shelves = append(shelves, s)
+	}
+	json.NewEncoder(w).Encode(shelves)
+}
+
+type shelfInput struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	IsPublic    *bool   `json:"isPublic"`
+}
+
+func createShelf(w http.ResponseWriter, r *http.Request, userID int) {
+	var in shelfInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Name == nil || strings.TrimSpace(*in.Name) == "" {
+		writeShelfError(w, http.StatusBadRequest, "Nama rak wajib diisi")
+		return
+	}
+	desc := ""
+	if in.Description != nil {
+		desc = *in.Description
+	}
+	public := in.IsPublic != nil && *in.IsPublic
+
+	// Rak default dibuat lebih dulu supaya namanya tidak terambil rak biasa
+	// (nama unik per user, dan rak default dibuat otomatis saat bookmark pertama)
+	if _, err := defaultShelfID(userID); err != nil {
+		writeShelfError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res, err := db.Exec("INSERT INTO shelves (userId, name, description) VALUES (?, ?, ?)", userID, strings.TrimSpace(*in.Name), desc)
+	if err != nil {
+		writeShelfError(w, http.StatusConflict, "Rak dengan nama tersebut sudah ada")
+		return
+	}
+	id, _ := res.LastInsertId()
+	shelf, _ := loadOwnShelf(userID, int(id))
+	if public {
+		shareShelf(w, shelf)
+		return
+	}
+	json.NewEncoder(w).Encode(shelf)
+}
+
+func updateShelf(w http.ResponseWriter, r *http.Request, userID int, shelf Shelf) {
+	var in shelfInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeShelfError(w, http.StatusBadRequest, "Body invalid")
+		return
+	}
+	if in.Name != nil {
+		if strings.TrimSpace(*in.Name) == "" {
+			writeShelfError(w, http.StatusBadRequest, "Nama rak wajib diisi")
+			return
+		}
+		shelf.Name = strings.TrimSpace(*in.Name)
+		if _, err := defaultShelfID(userID); err != nil {
+			writeShelfError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if in.Description != nil {
+		shelf.Description = *in.Description
+	}
+
+	_, err := db.Exec("UPDATE shelves SET name = ?, description = ?, updatedAt = NOW() WHERE id = ?", shelf.Name, shelf.Description, shelf.ID)
+	if err != nil {
+		writeShelfError(w, http.StatusConflict, "Rak dengan nama tersebut sudah ada")
+		return
+	}
+
+	if in.IsPublic != nil && *in.IsPublic != shelf.IsPublic {
+		if *in.IsPublic {
+			shareShelf(w, shelf)
+			return
+		}
+		db.Exec("UPDATE shelves SET isPublic = 0, shareToken = NULL WHERE id = ?", shelf.ID)
+	}
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Rak berhasil diperbarui"})
+}
+
+func deleteShelf(w http.ResponseWriter, shelf Shelf) {
+	if shelf.IsDefault {
+		writeShelfError(w, http.StatusBadRequest, "Rak default tidak bisa dihapus")
+		return
+	}
+	if _, err := db.Exec("DELETE FROM shelves WHERE id = ?", shelf.ID); err != nil {
+		writeShelfError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Rak berhasil dihapus"})
+}
+
+func shelfItemsHandler(w http.ResponseWriter, r *http.Request, shelf Shelf, rest []string) {
+	var input struct {
+		BookID int     `json:"bookId"`
+		Note   *string `json:"note"`
+	}
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeShelfError(w, http.StatusBadRequest, "Body invalid")
+			return
+		}
+	}
+	if len(rest) > 0 {
+		id, err := strconv.Atoi(rest[0])
+		if err != nil {
+			writeShelfError(w, http.StatusBadRequest, "ID buku tidak valid")
+			return
+		}
+		input.BookID = id
+	}
+
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		items, err := listShelfItems(shelf.ID)
+		if err != nil {
+			writeShelfError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(items)
+
+	case len(rest) == 0 && r.Method == http.MethodPost:
+		var exists bool
+		db.QueryRow("SELECT EXISTS(SELECT 1 FROM books WHERE id = ?)", input.BookID).Scan(&exists)
+		if !exists {
+			writeShelfError(w, http.StatusNotFound, "Buku tidak ditemukan")
+			return
+		}
+		note := ""
+		if input.Note != nil {
+			note = *input.Note
+		}
+		added, err := addShelfItem(shelf.ID, input.BookID, note)
+		if err != nil {
+			writeShelfError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !added {
+			writeShelfError(w, http.StatusConflict, "Buku sudah ada di rak ini")
+			return
+		}
+		json.NewEncoder(w).Encode(Response{Success: true, Message: "Buku ditambahkan ke rak"})
+
+	case len(rest) == 1 && r.Method == http.MethodPut:
+		if input.Note == nil {
+			writeShelfError(w, http.StatusBadRequest, "note wajib diisi")
+			return
+		}
+		res, err := db.Exec("UPDATE shelf_items SET note = ? WHERE shelfId = ? AND bookId = ?", *input.Note, shelf.ID, input.BookID)
+		if err != nil {
+			writeShelfError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			var exists bool
+			db.QueryRow("SELECT EXISTS(SELECT 1 FROM shelf_items WHERE shelfId = ? AND bookId = ?)", shelf.ID, input.BookID).Scan(&exists)
+			if !exists {
+				writeShelfError(w, http.StatusNotFound, "Buku tidak ada di rak ini")
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(Response{Success: true, Message: "Catatan disimpan"})
+
+	case len(rest) == 1 && r.Method == http.MethodDelete:
+		removed, err := removeShelfItem(shelf.ID, input.BookID)
+		if err != nil {
+			writeShelfError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !removed {
+			writeShelfError(w, http.StatusNotFound, "Buku tidak ada di rak ini")
+			return
+		}
+		json.NewEncoder(w).Encode(Response{Success: true, Message: "Buku dihapus dari rak"})
+
+	default:
+		writeShelfError(w, http.StatusMethodNotAllowed, "Method tidak diizinkan")
+	}
+}
+
+// Urutan baru dikirim lengkap; buku yang tidak disebut tetap di belakang dengan urutan lama
+func reorderShelf(w http.ResponseWriter, r *http.Request, shelf Shelf) {
+	var input struct {
+		BookIDs []int `json:"bookIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || len(input.BookIDs) == 0 {
+		writeShelfError(w, http.StatusBadRequest, "bookIds wajib diisi")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeShelfError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	listed := make(map[int]bool)
+	pos := 0
+	for _, id := range input.BookIDs {
+		if listed[id] {
+			continue
+		}
+		listed[id] = true
+		pos++
+		if _, err := tx.Exec("UPDATE shelf_items SET position = ? WHERE shelfId = ? AND bookId = ?", pos, shelf.ID, id); err != nil {
+			writeShelfError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	in, args := intInClause(input.BookIDs)
+	_, err = tx.Exec(`
+		UPDATE shelf_items SET position = position + ?
+		WHERE shelfId = ? AND bookId NOT IN `+in, append([]interface{}{pos, shelf.ID}, args...)...)
+	if err != nil {
+		writeShelfError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	tx.Exec("UPDATE shelves SET updatedAt = NOW() WHERE id = ?", shelf.ID)
+	if err := tx.Commit(); err != nil {
+		writeShelfError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(Response{Success: true, Message: "Urutan rak disimpan"})
+}
+
+func shareShelf(w http.ResponseWriter, shelf Shelf) {
+	token := shelf.ShareToken
+	if token == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			writeShelfError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		token = hex.EncodeToString(buf)
+	}
+	if _, err := db.Exec("UPDATE shelves SET isPublic = 1, shareToken = ? WHERE id = ?", token, shelf.ID); err != nil {
+		writeShelfError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"message":    "Rak bisa dilihat lewat link",
+		"shelfId":    shelf.ID,
+		"shareToken": token,
+		"shareUrl":   "/api/shelves/shared/" + token,
+	})
+}
+
+func sharedShelfHandler(w http.ResponseWriter, token string) {
+	var s Shelf
+	var desc sql.NullString
+	var owner string
+	err := db.QueryRow(`
+		SELECT s.id, s.name, s.description, s.createdAt, s.updatedAt, u.fullname
+		FROM shelves s JOIN users u ON u.id = s.userId
+		WHERE s.shareToken = ? AND s.isPublic = 1`, token).
+		Scan(&s.ID, &s.Name, &desc, &s.CreatedAt, &s.UpdatedAt, &owner)
+	if err != nil {
+		writeShelfError(w, http.StatusNotFound, "Rak tidak ditemukan atau tidak dibagikan")
+		return
+	}
+	s.Description = desc.String
+	s.IsPublic = true
+
+	items, err := listShelfItems(s.ID)
+	if err != nil {
+		writeShelfError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.ItemCount = len(items)
+	json.NewEncoder(w).Encode(map[string]interface{}{"shelf": s, "owner": owner, "items": items})
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ==========================================
+// AUTOCOMPLETE & "DID YOU MEAN"
+// Kamus dibangun dari dokumen di bookIndex (judul, penulis, genre)
+// dan dibangun ulang di background saat katalog berubah.
+// ==========================================
+
+const (
+	suggestDefaultLimit = 8
+	suggestMaxLimit     = 20
+	// Batas waktu pencarian kandidat, sisa kandidat diabaikan jika terlewati
+	suggestBudget = 30 * time.Millisecond
+)
+
+// Satu frasa yang bisa disarankan
+type suggestPhrase struct {
+	Text  string `json:"text"`
+	Kind  string `json:"kind"` // title | author | genre
+	Count int    `json:"count"`
+}
+
+// Kunci pencarian prefix: frasa mulai dari tiap awal kata
+type suggestKey struct {
+	key    string
+	phrase int
+	start  bool // true jika kunci = awal frasa
+}
+
+type suggestDict struct {
+	version int
+	phrases []suggestPhrase
+	keys    []suggestKey   // urut berdasarkan key
+	vocab   map[string]int // kata -> frekuensi, untuk koreksi ejaan
+}
+
+func normalizeSuggest(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// Ambil kamus terbaru. Jika index sudah berubah, kamus dibangun ulang di
+// background dan kamus lama tetap dipakai sampai yang baru siap.
+func (ix *searchIndex) suggestions() *suggestDict {
+	ix.mu.RLock()
+	version := ix.version
+	ix.mu.RUnlock()
+
+	ix.suggestMu.Lock()
+	d := ix.suggestCache
+	if d != nil && d.version != version && !ix.suggestBuilding {
+		ix.suggestBuilding = true
+		go func() {
+			ix.storeSuggestions(ix.buildSuggestions())
+			ix.suggestMu.Lock()
+			ix.suggestBuilding = false
+			ix.suggestMu.Unlock()
+		}()
+	}
+	ix.suggestMu.Unlock()
+
+	// Belum pernah dibangun: tidak ada kamus lama, bangun sekarang
+	if d == nil {
+		d = ix.buildSuggestions()
+		ix.storeSuggestions(d)
+	}
+	return d
+}
+
+// Simpan kamus jika lebih baru dari yang ada
+func (ix *searchIndex) storeSuggestions(d *suggestDict) {
+	ix.suggestMu.Lock()
+	defer ix.suggestMu.Unlock()
+	if ix.suggestCache == nil || ix.suggestCache.version < d.version {
+		ix.suggestCache = d
+	}
+}
+
+// Bangun kamus dari salinan field dokumen; index hanya dikunci selama menyalin
+func (ix *searchIndex) buildSuggestions() *suggestDict {
+	ix.mu.RLock()
+	d := &suggestDict{version: ix.version, vocab: make(map[string]int)}
+	docs := make([]searchFields, 0, len(ix.docs))
+	for _, doc := range ix.docs {
+		docs = append(docs, doc.fields)
+	}
+	ix.mu.RUnlock()
+
+	index := make(map[string]int) // kind|text -> posisi di phrases
+
+	add := func(text, kind string) {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return
+		}
+		id := kind + "|" + normalizeSuggest(text)
+		if i, ok := index[id]; ok {
+			d.phrases[i].Count++
+			return
+		}
+		index[id] = len(d.phrases)
+		d.phrases = append(d.phrases, suggestPhrase{Text: text, Kind: kind, Count: 1})
+	}
+
+	for _, f := range docs {
+		add(f.Title, "title")
+		add(f.Author, "author")
+		for _, g := range strings.Split(f.Genre, ",") {
+			add(g, "genre")
+		}
+		for _, text := range []string{f.Title, f.Author, f.Genre, f.Publisher} {
+			for _, w := range suggestWords(text) {
+				d.vocab[w]++
+			}
+		}
+	}
+
+	for i, p := range d.phrases {
+		words := strings.Fields(normalizeSuggest(p.Text))
+		for j := range words {
+			d.keys = append(d.keys, suggestKey{key: strings.Join(words[j:], " "), phrase: i, start: j == 0})
+		}
+	}
+	sort.Slice(d.keys, func(i, j int) bool { return d.keys[i].key < d.keys[j].key })
+	return d
+}
+
+func suggestWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Prefix completion. Frasa yang diawali prefix didahulukan, lalu yang paling sering muncul.
+func (d *suggestDict) complete(prefix, kind string, limit int, deadline time.Time) []suggestPhrase {
+	prefix = normalizeSuggest(prefix)
+	if prefix == "" {
+		return nil
+	}
+
+	type candidate struct {
+		phrase int
+		start  bool
+	}
+	seen := make(map[int]int) // phrase -> posisi di candidates
+	var candidates []candidate
+
+	i := sort.Search(len(d.keys), func(i int) bool { return d.keys[i].key >= prefix })
+	for ; i < len(d.keys) && strings.HasPrefix(d.keys[i].key, prefix); i++ {
+		if i%64 == 0 && time.Now().After(deadline) {
+			break
+		}
+		k := d.keys[i]
+		if kind != "" && d.phrases[k.phrase].Kind != kind {
+			continue
+		}
+		if pos, ok := seen[k.phrase]; ok {
+			candidates[pos].start = candidates[pos].start || k.start
+			continue
+		}
+		seen[k.phrase] = len(candidates)
+		candidates = append(candidates, candidate{phrase: k.phrase, start: k.start})
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		ca, cb := candidates[a], candidates[b]
+		if ca.start != cb.start {
+			return ca.start
+		}
+		pa, pb := d.phrases[ca.phrase], d.phrases[cb.phrase]
+		if pa.Count != pb.Count {
+			return pa.Count > pb.Count
+		}
+		return len(pa.Text) < len(pb.Text)
+	})
+
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	out := make([]suggestPhrase, len(candidates))
+	for i, c := range candidates {
+		out[i] = d.phrases[c.phrase]
+	}
+	return out
+}
+
+// Koreksi ejaan per kata memakai kosakata katalog.
+// Mengembalikan "" jika tidak ada kata yang perlu diganti.
+func (d *suggestDict) correct(query string) string {
+	words := suggestWords(query)
+	changed := false
+	for i, w := range words {
+		if _, ok := d.vocab[w]; ok || searchStopwords[w] {
+			continue
+		}
+		maxDist := fuzzyMaxDistance(w)
+		if maxDist == 0 {
+			maxDist = 1
+		}
+
+		best, bestDist, bestFreq := "", maxDist+1, 0
+		for v, freq := range d.vocab {
+			if absInt(len([]rune(v))-len([]rune(w))) > maxDist {
+				continue
+			}
+			dist := editDistance(w, v, maxDist)
+			if dist < bestDist || (dist == bestDist && (freq > bestFreq || (freq == bestFreq && v < best))) {
+				best, bestDist, bestFreq = v, dist, freq
+			}
+		}
+		if best != "" && bestDist <= maxDist {
+			words[i] = best
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(words, " ")
+}
+
+// Saran "did you mean" untuk search tanpa hasil
+func didYouMean(search string) string {
+	if !bookIndex.isReady() {
+		return ""
+	}
+	return bookIndex.suggestions().correct(search)
+}
+
+// GET /api/books/suggest?q=pemro&kind=title|author|genre&limit=8
+func suggestBooksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	started := time.Now()
+	q := r.URL.Query()
+	prefix := strings.TrimSpace(q.Get("q"))
+	kind := q.Get("kind")
+	if kind != "" && kind != "title" && kind != "author" && kind != "genre" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "kind harus title, author atau genre"})
+		return
+	}
+	limit := suggestDefaultLimit
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	if limit > suggestMaxLimit {
+		limit = suggestMaxLimit
+	}
+
+	result := map[string]interface{}{
+		"query":       prefix,
+		"suggestions": []suggestPhrase{},
+		"didYouMean":  nil,
+	}
+
+	if prefix != "" && bookIndex.isReady() {
+		d := bookIndex.suggestions()
+		items := d.complete(prefix, kind, limit, started.Add(suggestBudget))
+		if len(items) > 0 {
+			result["suggestions"] = items
+		} else if fix := d.correct(prefix); fix != "" {
+			result["didYouMean"] = fix
+		}
+	}
+	result["tookMs"] = time.Since(started).Milliseconds()
+
+	// Hasil sama untuk semua user, boleh di-cache sebentar oleh browser
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	json.NewEncoder(w).Encode(result)
+}
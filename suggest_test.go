@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSuggestionsRebuildInBackground(t *testing.T) {
+	ix := newSearchIndex()
+	ix.put(1, searchFields{Title: "Laskar Pelangi", Author: "Andrea Hirata"})
+
+	first := ix.suggestions()
+	if first.version != ix.version || len(first.phrases) != 2 {
+		t.Fatalf("kamus awal = %+v", first)
+	}
+
+	ix.put(2, searchFields{Title: "Bumi", Author: "Tere Liye"})
+	if d := ix.suggestions(); d != first {
+		t.Error("kamus lama harus dipakai selama rebuild berjalan")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		d := ix.suggestions()
+		if d.version == ix.version {
+			if len(d.phrases) != 4 {
+				t.Errorf("kamus baru berisi %d frasa, ingin 4", len(d.phrases))
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("kamus tidak pernah dibangun ulang")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
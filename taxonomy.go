@@ -0,0 +1,546 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ==========================================
+// GENRE & PENULIS TERNORMALISASI
+// Tabel genres/book_genres dan authors/book_authors menjadi sumber kebenaran.
+// Kolom teks books.genre & books.author tetap diisi (dipakai frontend lama)
+// dan selalu dibangun ulang dari tabel relasi.
+// ==========================================
+
+// Konfigurasi satu jenis taksonomi, supaya genre & penulis berbagi kode yang sama
+type taxonomy struct {
+	Name       string // "genre" / "author" (untuk pesan)
+	Table      string // genres / authors
+	LinkTable  string // book_genres / book_authors
+	LinkColumn string // genre_id / author_id
+	BookColumn string // kolom teks lama di books
+	Ordered    bool   // urutan penulis dipertahankan (position)
+}
+
+var (
+	genreTaxonomy  = taxonomy{Name: "genre", Table: "genres", LinkTable: "book_genres", LinkColumn: "genre_id", BookColumn: "genre"}
+	authorTaxonomy = taxonomy{Name: "penulis", Table: "authors", LinkTable: "book_authors", LinkColumn: "author_id", BookColumn: "author", Ordered: true}
+)
+
+var (
+	slugInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+	// Pemisah beberapa penulis: "A; B", "A & B", "A dan B", "A and B".
+	// Koma ditangani terpisah karena bisa berarti nama terbalik (lihat splitAuthorNames).
+	authorSeparator = regexp.MustCompile(`(?i)\s*(?:;|\s&\s|\sdan\s|\sand\s)\s*`)
+	hasLetter       = regexp.MustCompile(`\pL`)
+)
+
+// "Fiksi  Ilmiah" -> "fiksi-ilmiah". Nama yang beda huruf besar/spasi dianggap sama.
+func slugify(s string) string {
+	return strings.Trim(slugInvalidChars.ReplaceAllString(strings.ToLower(strings.TrimSpace(s)), "-"), "-")
+}
+
+// Pecah teks lama jadi daftar nama unik (berdasarkan slug), urutan dipertahankan
+func splitTaxonomyNames(t taxonomy, text string) []string {
+	var parts []string
+	if t.Ordered {
+		for _, chunk := range authorSeparator.Split(text, -1) {
+			parts = append(parts, splitAuthorNames(chunk)...)
+		}
+	} else {
+		parts = strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' })
+	}
+
+	seen := make(map[string]bool)
+	var out []string
+	for _, p := range parts {
+		name := strings.Join(strings.Fields(p), " ")
+		slug := slugify(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		out = append(out, name)
+	}
+	return out
+}
+
+// Pecah daftar penulis yang dipisah koma. Format katalog "Nama Belakang, Nama Depan"
+// (MARC 100/700) dikenali jika tiap bagian genap berupa satu kata, lalu dibalik:
+// "Hirata, Andrea" -> "Andrea Hirata", "Hirata, Andrea, Liye, Tere" -> dua penulis.
+// Bagian tanpa huruf (tahun lahir "1967-") dibuang.
+func splitAuthorNames(text string) []string {
+	var parts []string
+	for _, p := range strings.Split(text, ",") {
+		if p = strings.TrimSpace(p); hasLetter.MatchString(p) {
+			parts = append(parts, p)
+		}
+	}
+
+	inverted := len(parts) > 0 && len(parts)%2 == 0
+	for i := 0; inverted && i < len(parts); i += 2 {
+		inverted = len(strings.Fields(parts[i])) == 1
+	}
+	if !inverted {
+		return parts
+	}
+
+	var names []string
+	for i := 0; i < len(parts); i += 2 {
+		names = append(names, parts[i+1]+" "+parts[i])
+	}
+	return names
+}
+
+// Ambil id berdasarkan slug, buat baru jika belum ada
+func ensureTaxonomyTerm(tx *sql.Tx, t taxonomy, name string) (int, error) {
+	slug := slugify(name)
+	var id int
+	err := tx.QueryRow("SELECT id FROM "+t.Table+" WHERE slug = ?", slug).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	res, err := tx.Exec("INSERT INTO "+t.Table+" (name, slug) VALUES (?, ?)", name, slug)
+	if err != nil {
+		return 0, err
+	}
+	newID, err := res.LastInsertId()
+	return int(newID), err
+}
+
+// Ganti relasi satu buku berdasarkan teks (dari form / import), lalu rapikan teks lama
+func setBookTaxonomy(tx *sql.Tx, t taxonomy, bookID int, text string) error {
+	if _, err := tx.Exec("DELETE FROM "+t.LinkTable+" WHERE book_id = ?", bookID); err != nil {
+		return err
+	}
+	for pos, name := range splitTaxonomyNames(t, text) {
+		termID, err := ensureTaxonomyTerm(tx, t, name)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO "+t.LinkTable+" (book_id, "+t.LinkColumn+", position) VALUES (?, ?, ?)", bookID, termID, pos); err != nil {
+			return err
+		}
+	}
+	return refreshBookTaxonomyText(tx, t, bookID)
+}
+
+// Tulis ulang books.genre / books.author dari tabel relasi (ejaan resmi)
+func refreshBookTaxonomyText(tx *sql.Tx, t taxonomy, bookID int) error {
+	_, err := tx.Exec(`
+		UPDATE books SET `+t.BookColumn+` = (
+			SELECT COALESCE(GROUP_CONCAT(x.name ORDER BY l.position, x.name SEPARATOR ', '), '')
+			FROM `+t.LinkTable+` l JOIN `+t.Table+` x ON x.id = l.`+t.LinkColumn+`
+			WHERE l.book_id = ?)
+		WHERE id = ?`, bookID, bookID)
+	return err
+}
+
+// Sinkronkan genre & penulis satu buku setelah insert / update.
+// Dipanggil addBookHandler, updateBookHandler dan importer.
+func syncBookTaxonomy(bookID int, genreText, authorText string) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Gagal sinkron genre/penulis:", err)
+		return
+	}
+	if err := setBookTaxonomy(tx, genreTaxonomy, bookID, genreText); err != nil {
+		tx.Rollback()
+		log.Println("Gagal sinkron genre:", err)
+		return
+	}
+	if err := setBookTaxonomy(tx, authorTaxonomy, bookID, authorText); err != nil {
+		tx.Rollback()
+		log.Println("Gagal sinkron penulis:", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Gagal sinkron genre/penulis:", err)
+	}
+}
+
+// Migrasi data lama: pecah books.genre & books.author untuk buku yang belum punya relasi.
+// Aman dijalankan berulang kali saat startup.
+func migrateBookTaxonomy() {
+	for _, t := range []taxonomy{genreTaxonomy, authorTaxonomy} {
+		rows, err := db.Query(`
+			SELECT b.id, b.` + t.BookColumn + ` FROM books b
+			WHERE b.` + t.BookColumn + ` IS NOT NULL AND b.` + t.BookColumn + ` <> ''
+			  AND NOT EXISTS (SELECT 1 FROM ` + t.LinkTable + ` l WHERE l.book_id = b.id)`)
+		if err != nil {
+			log.Println("Migrasi "+t.Table+" gagal:", err)
+			continue
+		}
+		pending := make(map[int]string)
+		for rows.Next() {
+			var id int
+			var text string
+			if rows.Scan(&id, &text) == nil {
+				pending[id] = text
+			}
+		}
+		rows.Close()
+
+		for id, text := range pending {
+			tx, err := db.Begin()
+			if err != nil {
+				log.Println("Migrasi "+t.Table+" gagal:", err)
+				break
+			}
+			if err := setBookTaxonomy(tx, t, id, text); err != nil {
+				tx.Rollback()
+				log.Printf("Migrasi %s buku %d gagal: %v", t.Table, id, err)
+				continue
+			}
+			tx.Commit()
+		}
+		if len(pending) > 0 {
+			log.Printf("Migrasi %s: %d buku diproses", t.Table, len(pending))
+		}
+	}
+}
+
+// Kondisi WHERE: buku punya term dengan slug tertentu (dipakai buildBookFilters)
+func taxonomyFilterCondition(t taxonomy) string {
+	return "b.id IN (SELECT l.book_id FROM " + t.LinkTable + " l JOIN " + t.Table + " x ON x.id = l." + t.LinkColumn + " WHERE x.slug = ?)"
+}
+
+// ==========================================
+// ENDPOINT KURASI (ADMIN)
+// GET    /api/genres                 -> daftar + jumlah buku (publik)
+// POST   /api/admin/genres           {"name": "..."}
+// PUT    /api/admin/genres/{id}      {"name": "..."}  (rename)
+// DELETE /api/admin/genres/{id}
+// POST   /api/admin/genres/merge     {"sourceIds": [..], "targetId": 1}
+// Endpoint /api/authors & /api/admin/authors sama persis.
+// ==========================================
+
+type taxonomyTerm struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	BookCount int    `json:"bookCount"`
+}
+
+func taxonomyListHandler(t taxonomy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Method not allowed"})
+			return
+		}
+
+		query := `
+			SELECT x.id, x.name, x.slug, COUNT(l.book_id)
+			FROM ` + t.Table + ` x LEFT JOIN ` + t.LinkTable + ` l ON l.` + t.LinkColumn + ` = x.id`
+		var args []interface{}
+		if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+			query += " WHERE x.name LIKE ?"
+			args = append(args, "%"+q+"%")
+		}
+		query += " GROUP BY x.id, x.name, x.slug ORDER BY x.name"
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: err.Error()})
+			return
+		}
+		defer rows.Close()
+
+		terms := []taxonomyTerm{}
+		for rows.Next() {
+			var term taxonomyTerm
+			if err := rows.Scan(&term.ID, &term.Name, &term.Slug, &term.BookCount); err == nil {
+				terms = append(terms, term)
+			}
+		}
+		json.NewEncoder(w).Encode(terms)
+	}
+}
+
+func taxonomyAdminHandler(t taxonomy, prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		user := getCurrentUser(r)
+		if user.Role != "admin" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: "Unauthorized"})
+			return
+		}
+
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		var status int
+		var msg string
+		var data interface{}
+
+		switch {
+		case rest == "" && r.Method == http.MethodPost:
+			data, status, msg = createTaxonomyTerm(t, r)
+		case rest == "merge" && r.Method == http.MethodPost:
+			data, status, msg = mergeTaxonomyTerms(t, r)
+		case rest != "" && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+			data, status, msg = renameTaxonomyTerm(t, rest, r)
+		case rest != "" && r.Method == http.MethodDelete:
+			data, status, msg = deleteTaxonomyTerm(t, rest)
+		default:
+			status, msg = http.StatusMethodNotAllowed, "Method not allowed"
+		}
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(Response{Success: false, Message: msg})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": msg,
+			"data":    data,
+		})
+	}
+}
+
+func readTaxonomyName(r *http.Request) (string, string) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return "", "Body JSON tidak valid"
+	}
+	name := strings.Join(strings.Fields(body.Name), " ")
+	if slugify(name) == "" {
+		return "", "Nama wajib diisi"
+	}
+	return name, ""
+}
+
+func createTaxonomyTerm(t taxonomy, r *http.Request) (interface{}, int, string) {
+	name, msg := readTaxonomyName(r)
+	if msg != "" {
+		return nil, http.StatusBadRequest, msg
+	}
+
+	var exists int
+	db.QueryRow("SELECT COUNT(*) FROM "+t.Table+" WHERE slug = ?", slugify(name)).Scan(&exists)
+	if exists > 0 {
+		return nil, http.StatusConflict, fmt.Sprintf("%s \"%s\" sudah ada", t.Name, name)
+	}
+
+	res, err := db.Exec("INSERT INTO "+t.Table+" (name, slug) VALUES (?, ?)", name, slugify(name))
+	if err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	id, _ := res.LastInsertId()
+	return taxonomyTerm{ID: int(id), Name: name, Slug: slugify(name)}, http.StatusOK, "Berhasil ditambahkan"
+}
+
+func renameTaxonomyTerm(t taxonomy, idStr string, r *http.Request) (interface{}, int, string) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, http.StatusBadRequest, "ID tidak valid"
+	}
+	name, msg := readTaxonomyName(r)
+	if msg != "" {
+		return nil, http.StatusBadRequest, msg
+	}
+
+	var other int
+	err = db.QueryRow("SELECT id FROM "+t.Table+" WHERE slug = ? AND id <> ?", slugify(name), id).Scan(&other)
+	if err == nil {
+		// Nama baru bentrok dengan term lain: admin sebaiknya memakai merge
+		return map[string]int{"conflictId": other}, http.StatusConflict, fmt.Sprintf("%s \"%s\" sudah ada, gunakan merge", t.Name, name)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE "+t.Table+" SET name = ?, slug = ? WHERE id = ?", name, slugify(name), id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var found int
+		tx.QueryRow("SELECT COUNT(*) FROM "+t.Table+" WHERE id = ?", id).Scan(&found)
+		if found == 0 {
+			return nil, http.StatusNotFound, t.Name + " tidak ditemukan"
+		}
+	}
+
+	bookIDs, err := refreshTaxonomyBooks(tx, t, []int{id})
+	if err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	reindexBooks(bookIDs)
+	return map[string]int{"updatedBooks": len(bookIDs)}, http.StatusOK, "Berhasil diubah"
+}
+
+func deleteTaxonomyTerm(t taxonomy, idStr string) (interface{}, int, string) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, http.StatusBadRequest, "ID tidak valid"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	defer tx.Rollback()
+
+	bookIDs, err := taxonomyBookIDs(tx, t, []int{id})
+	if err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	res, err := tx.Exec("DELETE FROM "+t.Table+" WHERE id = ?", id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, http.StatusNotFound, t.Name + " tidak ditemukan"
+	}
+	// Relasi ikut terhapus (ON DELETE CASCADE), teks lama dirapikan
+	if err := refreshBookTexts(tx, t, bookIDs); err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	reindexBooks(bookIDs)
+	return map[string]int{"updatedBooks": len(bookIDs)}, http.StatusOK, "Berhasil dihapus"
+}
+
+// Gabungkan beberapa term (mis. typo "Horro", "horor ") ke satu term target
+func mergeTaxonomyTerms(t taxonomy, r *http.Request) (interface{}, int, string) {
+	var body struct {
+		SourceIDs []int `json:"sourceIds"`
+		TargetID  int   `json:"targetId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, http.StatusBadRequest, "Body JSON tidak valid"
+	}
+
+	var sources []int
+	for _, id := range body.SourceIDs {
+		if id != body.TargetID {
+			sources = append(sources, id)
+		}
+	}
+	if body.TargetID == 0 || len(sources) == 0 {
+		return nil, http.StatusBadRequest, "targetId dan minimal satu sourceIds (selain target) wajib diisi"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	defer tx.Rollback()
+
+	var found int
+	tx.QueryRow("SELECT COUNT(*) FROM "+t.Table+" WHERE id = ?", body.TargetID).Scan(&found)
+	if found == 0 {
+		return nil, http.StatusNotFound, t.Name + " target tidak ditemukan"
+	}
+
+	bookIDs, err := taxonomyBookIDs(tx, t, sources)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+
+	in, args := intInClause(sources)
+	// Pindahkan relasi ke target; buku yang sudah punya target cukup dibuang relasi lamanya
+	_, err = tx.Exec(`
+		INSERT IGNORE INTO `+t.LinkTable+` (book_id, `+t.LinkColumn+`, position)
+		SELECT book_id, ?, MIN(position) FROM `+t.LinkTable+`
+		WHERE `+t.LinkColumn+` IN `+in+` GROUP BY book_id`, append([]interface{}{body.TargetID}, args...)...)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	if _, err := tx.Exec("DELETE FROM "+t.Table+" WHERE id IN "+in, args...); err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+
+	if err := refreshBookTexts(tx, t, bookIDs); err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	reindexBooks(bookIDs)
+	return map[string]int{"merged": len(sources), "updatedBooks": len(bookIDs)}, http.StatusOK, "Berhasil digabung"
+}
+
+// Tulis ulang teks lama semua buku yang memakai term tertentu
+func refreshTaxonomyBooks(tx *sql.Tx, t taxonomy, termIDs []int) ([]int, error) {
+	bookIDs, err := taxonomyBookIDs(tx, t, termIDs)
+	if err != nil {
+		return nil, err
+	}
+	return bookIDs, refreshBookTexts(tx, t, bookIDs)
+}
+
+// Teks lama berubah = metadata buku berubah, jadi updated_at ikut diperbarui
+func refreshBookTexts(tx *sql.Tx, t taxonomy, bookIDs []int) error {
+	for _, bookID := range bookIDs {
+		if err := refreshBookTaxonomyText(tx, t, bookID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE books SET updated_at = NOW() WHERE id = ?", bookID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func taxonomyBookIDs(tx *sql.Tx, t taxonomy, termIDs []int) ([]int, error) {
+	in, args := intInClause(termIDs)
+	rows, err := tx.Query("SELECT DISTINCT book_id FROM "+t.LinkTable+" WHERE "+t.LinkColumn+" IN "+in, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// "(?,?,?)" beserta argumennya
+func intInClause(ids []int) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return "(" + strings.Join(placeholders, ",") + ")", args
+}
+
+func reindexBooks(ids []int) {
+	for _, id := range ids {
+		reindexBook(id)
+	}
+}
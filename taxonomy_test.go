@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Fiksi":            "fiksi",
+		"  Fiksi  Ilmiah ": "fiksi-ilmiah",
+		"Sci-Fi & Fantasi": "sci-fi-fantasi",
+		"Self-Help!":       "self-help",
+		"Kisah Nyata (2)":  "kisah-nyata-2",
+		"---":              "",
+	}
+	for in, want := range tests {
+		if got := slugify(in); got != want {
+			t.Errorf("slugify(%q) = %q, ingin %q", in, got, want)
+		}
+	}
+}
+
+func TestSplitTaxonomyNames(t *testing.T) {
+	tests := []struct {
+		name string
+		tax  taxonomy
+		text string
+		want []string
+	}{
+		{"genre koma", genreTaxonomy, "Novel, Fiksi; Drama", []string{"Novel", "Fiksi", "Drama"}},
+		{"genre duplikat beda huruf", genreTaxonomy, "Fiksi, fiksi ,  FIKSI", []string{"Fiksi"}},
+		{"genre kosong", genreTaxonomy, " , ;", nil},
+		{"penulis tunggal", authorTaxonomy, "Andrea Hirata", []string{"Andrea Hirata"}},
+		{"penulis koma", authorTaxonomy, "Andrea Hirata, Tere Liye", []string{"Andrea Hirata", "Tere Liye"}},
+		{"penulis dan/&", authorTaxonomy, "Andrea Hirata dan Tere Liye & Dee Lestari", []string{"Andrea Hirata", "Tere Liye", "Dee Lestari"}},
+		{"nama terbalik", authorTaxonomy, "Hirata, Andrea", []string{"Andrea Hirata"}},
+		{"nama terbalik dengan tahun", authorTaxonomy, "Toer, Pramoedya Ananta, 1925-2006", []string{"Pramoedya Ananta Toer"}},
+		{"dua nama terbalik", authorTaxonomy, "Hirata, Andrea, Liye, Tere", []string{"Andrea Hirata", "Tere Liye"}},
+		{"nama terbalik titik koma", authorTaxonomy, "Hirata, Andrea; Liye, Tere", []string{"Andrea Hirata", "Tere Liye"}},
+		{"penulis duplikat", authorTaxonomy, "Tere Liye; tere  liye", []string{"Tere Liye"}},
+		{"penulis kosong", authorTaxonomy, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitTaxonomyNames(tt.tax, tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitTaxonomyNames(%q) = %q, ingin %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// LAYANAN UPLOAD FILE (SAMPUL, EBOOK & FOTO PROFIL)
+// Nama file dari client tidak pernah dipakai. Jenis file ditentukan dari
+// magic bytes, lalu file disimpan dengan nama hash SHA-256 isinya:
+//
+//	uploads/covers/<sha256>.jpg|png|webp
+//	uploads/ebooks/<sha256>.pdf|epub
+//	uploads/users/<sha256>.jpg|png|webp
+//
+// File disimpan lewat BlobStore (lihat blobstore.go).
+// File yang isinya sama otomatis berbagi satu salinan. Saat buku dihapus
+// atau filenya diganti, file lama dihapus jika tidak dipakai buku lain.
+//
+// Batas ukuran per jenis bisa diatur lewat env UPLOAD_MAX_COVER_MB,
+// UPLOAD_MAX_EBOOK_MB dan UPLOAD_MAX_USER_MB.
+// ==========================================
+
+const (
+	uploadKindCover = "cover"
+	uploadKindEbook = "ebook"
+	uploadKindUser  = "foto profil"
+
+	mimeJPEG = "image/jpeg"
+	mimePNG  = "image/png"
+	mimeWebP = "image/webp"
+	mimePDF  = "application/pdf"
+	mimeEPUB = "application/epub+zip"
+
+	defaultCoverPath = "uploads/covers/default_cover.jpg"
+	defaultUserPath  = "uploads/users/default_user.png"
+
+	// Lama file baru dianggap "sedang dipakai" walau belum tercatat di database
+	uploadPinTTL = 10 * time.Minute
+)
+
+var (
+	// Simpan & hapus file yang sama tidak boleh berjalan bersamaan
+	uploadLocks = newKeyedMutex()
+
+	// File yang baru disimpan storeUpload tapi mungkin belum direferensikan buku / user.
+	// releaseUpload tidak menghapusnya sampai pin habis, lalu dicek ulang.
+	uploadPinsMu sync.Mutex
+	uploadPins   = make(map[string]int)
+)
+
+type uploadPolicy struct {
+	Dir     string
+	MaxSize int64
+	Types   map[string]string // mime -> ekstensi
+}
+
+var uploadPolicies = map[string]uploadPolicy{
+	uploadKindCover: {
+		Dir:     "uploads/covers",
+		MaxSize: envMegabytes("UPLOAD_MAX_COVER_MB", 5),
+		Types:   map[string]string{mimeJPEG: ".jpg", mimePNG: ".png", mimeWebP: ".webp"},
+	},
+	uploadKindEbook: {
+		Dir:     "uploads/ebooks",
+		MaxSize: envMegabytes("UPLOAD_MAX_EBOOK_MB", 100),
+		Types:   map[string]string{mimePDF: ".pdf", mimeEPUB: ".epub"},
+	},
+	uploadKindUser: {
+		Dir:     "uploads/users",
+		MaxSize: envMegabytes("UPLOAD_MAX_USER_MB", 2),
+		Types:   map[string]string{mimeJPEG: ".jpg", mimePNG: ".png", mimeWebP: ".webp"},
+	},
+}
+
+func envMegabytes(name string, def int64) int64 {
+	if v, err := strconv.ParseInt(os.Getenv(name), 10, 64); err == nil && v > 0 {
+		return v << 20
+	}
+	return def << 20
+}
+
+// Kesalahan dari isi upload (jenis / ukuran / duplikat): ditampilkan ke admin apa adanya
+type uploadError struct{ msg string }
+
+func (e *uploadError) Error() string { return e.msg }
+
+func isUploadError(err error) bool {
+	var ue *uploadError
+	return errors.As(err, &ue)
+}
+
+type storedUpload struct {
+	Path     string
+	Hash     string
+	Mime     string
+	Size     int64
+	Existing bool // isi yang sama sudah tersimpan sebelumnya
+}
+
+// Jenis file dari magic bytes; "" jika tidak dikenali
+func sniffUploadType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return mimeJPEG
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return mimePNG
+	case len(head) >= 12 && bytes.Equal(head[:4], []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WEBP")):
+		return mimeWebP
+	// Beberapa PDF punya sampah sebelum header; pembaca PDF mencari di 1KB pertama
+	case bytes.Contains(head[:minInt(len(head), 1024)], []byte("%PDF-")):
+		return mimePDF
+	// OCF: entry zip pertama "mimetype" (tanpa kompresi) berisi application/epub+zip
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")) && len(head) >= 58 &&
+		bytes.Equal(head[30:38], []byte("mimetype")) && bytes.HasPrefix(head[38:], []byte(mimeEPUB)):
+		return mimeEPUB
+	}
+	return ""
+}
+
+func allowedTypesText(p uploadPolicy) string {
+	var exts []string
+	for _, ext := range []string{".jpg", ".png", ".webp", ".pdf", ".epub"} {
+		for _, e := range p.Types {
+			if e == ext {
+				exts = append(exts, strings.ToUpper(strings.TrimPrefix(ext, ".")))
+			}
+		}
+	}
+	return strings.Join(exts, "/")
+}
+
+// Simpan isi src sebagai file jenis kind; jenis dicek dari isi, ukuran dibatasi policy
+func storeUpload(kind string, src io.Reader) (*storedUpload, error) {
+	policy, ok := uploadPolicies[kind]
+	if !ok {
+		return nil, fmt.Errorf("jenis upload %q tidak dikenal", kind)
+	}
+
+	br := bufio.NewReaderSize(src, 1024)
+	head, _ := br.Peek(1024)
+	mime := sniffUploadType(head)
+	ext, ok := policy.Types[mime]
+	if !ok {
+		return nil, &uploadError{fmt.Sprintf("File %s harus berformat %s", kind, allowedTypesText(policy))}
+	}
+
+	// File sementara lokal dulu: hash & ukuran harus diketahui sebelum masuk blob store
+	tmp, err := os.CreateTemp("", "libra-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(br, policy.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > policy.MaxSize {
+		return nil, &uploadError{fmt.Sprintf("Ukuran file %s maksimal %d MB", kind, policy.MaxSize>>20)}
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	up := &storedUpload{Path: policy.Dir + "/" + hash + ext, Hash: hash, Mime: mime, Size: n}
+
+	unlock := uploadLocks.Lock(up.Path)
+	defer unlock()
+	if _, err := blobs.Stat(up.Path); err == nil {
+		up.Existing = true
+		pinUpload(up.Path)
+		return up, nil
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := blobs.Put(up.Path, tmp, n, mime); err != nil {
+		return nil, err
+	}
+	pinUpload(up.Path)
+	return up, nil
+}
+
+// Tahan file dari releaseUpload selama uploadPinTTL, memberi waktu pemanggil
+// menyimpan referensinya. Setelah pin habis file dicek ulang: upload yang
+// ternyata tidak jadi dipakai (form gagal divalidasi) ikut terhapus.
+func pinUpload(path string) {
+	uploadPinsMu.Lock()
+	uploadPins[path]++
+	uploadPinsMu.Unlock()
+
+	time.AfterFunc(uploadPinTTL, func() {
+		uploadPinsMu.Lock()
+		uploadPins[path]--
+		left := uploadPins[path]
+		if left <= 0 {
+			delete(uploadPins, path)
+		}
+		uploadPinsMu.Unlock()
+		if left <= 0 {
+			releaseUpload(path)
+		}
+	})
+}
+
+func uploadPinned(path string) bool {
+	uploadPinsMu.Lock()
+	defer uploadPinsMu.Unlock()
+	return uploadPins[path] > 0
+}
+
+// Ambil file dari form multipart lalu simpan; nil, nil jika field tidak diisi
+func saveFormUpload(r *http.Request, field, kind string) (*storedUpload, error) {
+	f, h, err := r.FormFile(field)
+	if err == http.ErrMissingFile {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &uploadError{"Gagal membaca file " + kind}
+	}
+	defer f.Close()
+	if policy := uploadPolicies[kind]; h.Size > policy.MaxSize {
+		return nil, &uploadError{fmt.Sprintf("Ukuran file %s maksimal %d MB", kind, policy.MaxSize>>20)}
+	}
+	return storeUpload(kind, f)
+}
+
+// Simpan gambar dari data URL (data:image/png;base64,...), dipakai foto profil saat registrasi
+func saveDataURLUpload(data, kind string) (*storedUpload, error) {
+	meta, payload, ok := strings.Cut(data, ",")
+	if !ok || !strings.HasPrefix(meta, "data:") || !strings.HasSuffix(meta, ";base64") {
+		return nil, &uploadError{"Format file " + kind + " tidak valid"}
+	}
+	if policy := uploadPolicies[kind]; int64(base64.StdEncoding.DecodedLen(len(payload))) > policy.MaxSize+2 {
+		return nil, &uploadError{fmt.Sprintf("Ukuran file %s maksimal %d MB", kind, policy.MaxSize>>20)}
+	}
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, &uploadError{"Format file " + kind + " tidak valid"}
+	}
+	return storeUpload(kind, bytes.NewReader(raw))
+}
+
+// Batas body request form buku: semua file maksimal + ruang untuk field teks
+func bookFormMaxBytes() int64 {
+	return uploadPolicies[uploadKindCover].MaxSize + uploadPolicies[uploadKindEbook].MaxSize + 1<<20
+}
+
+// Ebook dengan isi sama yang sudah dipakai buku lain (lisensi & watermark per buku)
+func ebookDuplicateOf(path string, exceptBookID int) (int, string, bool) {
+	var id int
+	var title string
+	err := db.QueryRow("SELECT id, title FROM books WHERE ebookFile = ? AND id <> ? LIMIT 1", path, exceptBookID).Scan(&id, &title)
+	return id, title, err == nil
+}
+
+// Hapus file upload jika tidak lagi dipakai buku / user mana pun
+func releaseUpload(path string) {
+	path = filepath.ToSlash(filepath.Clean(path))
+	if path == "." || path == defaultCoverPath || path == defaultUserPath {
+		return
+	}
+	managed := false
+	for _, p := range uploadPolicies {
+		if strings.HasPrefix(path, p.Dir+"/") && !strings.Contains(strings.TrimPrefix(path, p.Dir+"/"), "/") {
+			managed = true
+		}
+	}
+	if !managed {
+		return
+	}
+
+	unlock := uploadLocks.Lock(path)
+	defer unlock()
+	if uploadPinned(path) {
+		return
+	}
+
+	var refs int
+	err := db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM books WHERE coverFile = ? OR ebookFile = ?)
+			+ (SELECT COUNT(*) FROM users WHERE profile_picture = ?)`, path, path, path).Scan(&refs)
+	if err != nil || refs > 0 {
+		return
+	}
+	if err := deleteBlob(path); err != nil {
+		log.Println("Gagal menghapus file tak terpakai:", err)
+		return
+	}
+	if strings.HasPrefix(path, uploadPolicies[uploadKindCover].Dir+"/") {
+		deleteCoverVariants(path)
+	}
+}
+
+// Respon gagal upload: 400 untuk isi yang ditolak, 500 untuk gangguan penyimpanan
+func writeUploadError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	msg := err.Error()
+	if isUploadError(err) {
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+		msg = "Gagal menyimpan file: " + msg
+	}
+	json.NewEncoder(w).Encode(Response{Success: false, Message: msg})
+}
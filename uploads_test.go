@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSniffUploadType(t *testing.T) {
+	epub := append([]byte("PK\x03\x04"), make([]byte, 26)...)
+	epub = append(epub, []byte("mimetype"+mimeEPUB)...)
+	zip := append([]byte("PK\x03\x04"), make([]byte, 26)...)
+	zip = append(zip, []byte("word/document.xml")...)
+
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F'}, mimeJPEG},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), mimePNG},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), mimeWebP},
+		{"riff bukan webp", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), ""},
+		{"pdf", []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3"), mimePDF},
+		{"pdf dengan sampah di depan", append(bytes.Repeat([]byte{' '}, 500), []byte("%PDF-1.4")...), mimePDF},
+		{"pdf terlalu jauh", append(bytes.Repeat([]byte{' '}, 1100), []byte("%PDF-1.4")...), ""},
+		{"epub", epub, mimeEPUB},
+		{"zip biasa", zip, ""},
+		{"teks", []byte("hello world"), ""},
+		{"kosong", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffUploadType(tt.head); got != tt.want {
+				t.Errorf("sniffUploadType = %q, ingin %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseUploadKeepsPinnedFile(t *testing.T) {
+	// db tidak diisi di test: releaseUpload harus berhenti sebelum query referensi
+	path := "uploads/covers/" + string(bytes.Repeat([]byte("a"), 64)) + ".jpg"
+	uploadPinsMu.Lock()
+	uploadPins[path]++
+	uploadPinsMu.Unlock()
+	defer func() {
+		uploadPinsMu.Lock()
+		delete(uploadPins, path)
+		uploadPinsMu.Unlock()
+	}()
+
+	releaseUpload(path)
+	releaseUpload("../etc/passwd")
+	releaseUpload(defaultCoverPath)
+	if len(uploadLocks.locks) != 0 {
+		t.Error("kunci upload tidak dilepas")
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// ==========================================
+// WATERMARK PDF PER PEMINJAM
+// Saat ebook PDF dikirim ke member, tiap halaman diberi tanda nama, nomor
+// anggota, waktu unduh dan kode lacak. File asli di uploads/ebooks tidak
+// diubah; salinan ber-watermark disimpan di cache/watermarks per user & buku
+// dan dibuat ulang jika file asli berganti.
+//
+// Mode (env EBOOK_WATERMARK):
+//
+//	visible    footer kecil di bawah setiap halaman (default)
+//	invisible  teks transparan di halaman + metadata dokumen
+//	off        tanpa watermark
+//
+// Kode lacak dicatat di tabel ebook_watermarks sehingga salinan yang bocor
+// bisa ditelusuri ke peminjamnya.
+// ==========================================
+
+const (
+	watermarkVisible   = "visible"
+	watermarkInvisible = "invisible"
+	watermarkOff       = "off"
+
+	watermarkCacheDir = "cache/watermarks"
+	// Salinan lebih tua dari ini dibuat ulang saat dibaca lagi (kode lacak baru)
+	watermarkCacheMaxAge = 7 * 24 * time.Hour
+	watermarkSweepEvery  = 15 * time.Minute
+)
+
+var (
+	watermarkMode = loadWatermarkMode()
+
+	// Satu proses pembuatan per (user, buku) supaya request Range paralel
+	// dari PDF.js tidak membuat salinan yang sama berkali-kali
+	watermarkLocks = newKeyedMutex()
+)
+
+// Mutex per kunci. Entri dihapus dari map begitu tidak ada yang memegang
+// atau menunggu, jadi map tidak tumbuh terus seiring jumlah user & buku.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: make(map[string]*keyedLock)}
+}
+
+// Kunci key; panggil fungsi yang dikembalikan untuk melepas
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+func loadWatermarkMode() string {
+	switch m := strings.ToLower(os.Getenv("EBOOK_WATERMARK")); m {
+	case watermarkInvisible, watermarkOff:
+		return m
+	}
+	return watermarkVisible
+}
+
+func init() {
+	// pdfcpu cukup memakai konfigurasi bawaan & font standar
+	api.DisableConfigDir()
+}
+
+// Nomor anggota yang dicetak di watermark
+func memberNumber(userID int) string {
+	return fmt.Sprintf("AGT-%06d", userID)
+}
+
+// Path salinan ber-watermark untuk user & buku; dibuat jika belum ada di cache
+func watermarkedEbook(src string, userID, bookID int) (string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+
+	// Versi file asli + mode masuk ke nama file: asli diganti -> cache baru
+	version := fmt.Sprintf("%x-%x-%s", info.Size(), info.ModTime().UnixNano(), watermarkMode)
+	dir := filepath.Join(watermarkCacheDir, fmt.Sprint(bookID))
+	out := filepath.Join(dir, fmt.Sprintf("%d-%s.pdf", userID, version))
+
+	unlock := watermarkLocks.Lock(watermarkKey(bookID, userID))
+	defer unlock()
+
+	if _, err := os.Stat(out); err == nil {
+		return out, nil
+	}
+
+	var fullname string
+	db.QueryRow("SELECT COALESCE(fullname, username, '') FROM users WHERE id = ?", userID).Scan(&fullname)
+	trace, err := newTraceCode()
+	if err != nil {
+		return "", err
+	}
+	issued := time.Now()
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := stampPDF(src, out, fullname, memberNumber(userID), trace, issued); err != nil {
+		return "", err
+	}
+
+	// Salinan versi lama milik user ini sudah tidak dipakai
+	if old, _ := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%d-*.pdf", userID))); len(old) > 0 {
+		for _, f := range old {
+			if f != out {
+				os.Remove(f)
+			}
+		}
+	}
+
+	if _, err := db.Exec("INSERT INTO ebook_watermarks (userId, bookId, traceCode, mode, createdAt) VALUES (?, ?, ?, ?, NOW())",
+		userID, bookID, trace, watermarkMode); err != nil {
+		log.Println("Gagal mencatat watermark:", err)
+	}
+	return out, nil
+}
+
+func newTraceCode() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(b)), nil
+}
+
+// Tulis salinan ber-watermark dari src ke dst (lewat file sementara)
+func stampPDF(src, dst, fullname, memberNo, trace string, issued time.Time) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	text := fmt.Sprintf("Dipinjam oleh %s (%s) - %s - Kode %s", fullname, memberNo, issued.Format("02-01-2006 15:04"), trace)
+	desc := "font:Helvetica, points:7, position:bc, offset:0 10, scalefactor:1 abs, rotation:0, fillcolor:#555555, opacity:0.7"
+	if watermarkMode == watermarkInvisible {
+		desc = "font:Helvetica, points:4, position:bl, offset:4 4, scalefactor:1 abs, rotation:0, opacity:0"
+	}
+	wm, err := api.TextWatermark(text, desc, true, false, types.POINTS)
+	if err != nil {
+		return err
+	}
+
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+
+	var stamped bytes.Buffer
+	if err := api.AddWatermarks(in, &stamped, nil, wm, conf); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-*.pdf")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	props := map[string]string{
+		"Peminjam":     fullname,
+		"NomorAnggota": memberNo,
+		"Diunduh":      issued.Format(time.RFC3339),
+		"KodeLacak":    trace,
+	}
+	if err := api.AddProperties(bytes.NewReader(stamped.Bytes()), tmp, props, conf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func watermarkKey(bookID, userID int) string {
+	return fmt.Sprintf("%d/%d", bookID, userID)
+}
+
+// Hapus semua salinan ber-watermark satu buku (misalnya saat file ebook diganti)
+func purgeWatermarkCache(bookID int) {
+	os.RemoveAll(filepath.Join(watermarkCacheDir, fmt.Sprint(bookID)))
+}
+
+// Hapus salinan milik satu user (pinjaman dikembalikan / kedaluwarsa)
+func purgeWatermarkCopies(bookID, userID int) {
+	unlock := watermarkLocks.Lock(watermarkKey(bookID, userID))
+	defer unlock()
+	files, _ := filepath.Glob(filepath.Join(watermarkCacheDir, fmt.Sprint(bookID), fmt.Sprintf("%d-*.pdf", userID)))
+	for _, f := range files {
+		os.Remove(f)
+	}
+}
+
+// Bersihkan cache: salinan yang sudah lama atau yang pemiliknya tidak lagi
+// berhak membaca (pinjaman berakhir, akses buku diubah jadi pinjaman).
+// Dijalankan berkala oleh sweeper pinjaman ebook.
+func sweepWatermarkCache() {
+	dirs, err := os.ReadDir(watermarkCacheDir)
+	if err != nil {
+		return
+	}
+	for _, d := range dirs {
+		bookID, err := strconv.Atoi(d.Name())
+		if err != nil || !d.IsDir() {
+			continue
+		}
+		dir := filepath.Join(watermarkCacheDir, d.Name())
+		files, _ := os.ReadDir(dir)
+		entitled := make(map[int]bool)
+		for _, f := range files {
+			prefix, _, ok := strings.Cut(f.Name(), "-")
+			userID, err := strconv.Atoi(prefix)
+			if !ok || err != nil {
+				continue
+			}
+			allowed, checked := entitled[userID]
+			if !checked {
+				_, status, _ := ebookEntitlement(userID, "member", bookID)
+				allowed = status == 0
+				entitled[userID] = allowed
+			}
+			info, err := f.Info()
+			if !allowed || (err == nil && time.Since(info.ModTime()) > watermarkCacheMaxAge) {
+				purgeWatermarkCopies(bookID, userID)
+			}
+		}
+		// Folder kosong ikut dihapus (gagal jika masih berisi, itu yang diinginkan)
+		os.Remove(dir)
+	}
+}
+
+// API Handler (admin): cari peminjam dari kode lacak di salinan yang beredar
+// GET /api/admin/ebook/watermarks?code=ABCDEF012345
+func watermarkLookupHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user := getCurrentUser(r)
+	if user.Role != "admin" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Unauthorized"})
+		return
+	}
+
+	code := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("code")))
+	var result struct {
+		TraceCode    string    `json:"traceCode"`
+		Mode         string    `json:"mode"`
+		CreatedAt    time.Time `json:"createdAt"`
+		UserID       int       `json:"userId"`
+		Fullname     string    `json:"fullname"`
+		Email        string    `json:"email"`
+		MemberNumber string    `json:"memberNumber"`
+		BookID       int       `json:"bookId"`
+		Title        string    `json:"title"`
+	}
+	var fullname, email sql.NullString
+	err := db.QueryRow(`
+		SELECT x.traceCode, x.mode, x.createdAt, u.id, u.fullname, u.email, b.id, b.title
+		FROM ebook_watermarks x
+		JOIN users u ON u.id = x.userId
+		JOIN books b ON b.id = x.bookId
+		WHERE x.traceCode = ?`, code).
+		Scan(&result.TraceCode, &result.Mode, &result.CreatedAt, &result.UserID, &fullname, &email, &result.BookID, &result.Title)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{Success: false, Message: "Kode lacak tidak ditemukan"})
+		return
+	}
+	result.Fullname, result.Email = fullname.String, email.String
+	result.MemberNumber = memberNumber(result.UserID)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	k := newKeyedMutex()
+	keys := []string{"1/1", "1/2"}
+	counts := map[string]*int{"1/1": new(int), "1/2": new(int)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		for _, key := range keys {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				unlock := k.Lock(key)
+				*counts[key]++ // race detector menangkap jika kunci per key tidak eksklusif
+				unlock()
+			}(key)
+		}
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if *counts[key] != 50 {
+			t.Errorf("%s: %d, ingin 50", key, *counts[key])
+		}
+	}
+	if len(k.locks) != 0 {
+		t.Errorf("%d kunci tersisa setelah semua dilepas", len(k.locks))
+	}
+}